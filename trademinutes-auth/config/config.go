@@ -1,34 +1,16 @@
 package config
 
 import (
-	"context"
 	"fmt"
-	"log"
-	"os"
-	"time"
 
-    "go.mongodb.org/mongo-driver/mongo"
-    "go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/ElioCloud/trademinutes-common/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var DB *mongo.Database
 
 func ConnectDB() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URI")))
-	if err != nil {
-		log.Fatal("MongoDB Connect Error:", err)
-	}
-
-	// Ping the database
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Fatal("MongoDB Ping Error:", err)
-	}
-
-	DB = client.Database(os.Getenv("DB_NAME"))
+	DB = mongodb.MustConnectFromEnv()
 	fmt.Println("Connected to MongoDB")
 }
 
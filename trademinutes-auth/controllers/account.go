@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/models"
+	"trademinutes-auth/services"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/ElioCloud/trademinutes-common/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recentLoginWindow is how fresh a session must be to delete an account without a password.
+const recentLoginWindow = 10 * time.Minute
+
+// ExportAccountHandler returns everything TradeMinutes stores about the authenticated user,
+// gathered from every service, as JSON or (with ?format=zip) a ZIP with one file per service.
+func ExportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		httpx.Error(w, "format must be json or zip", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	account, err := exportAuthData(ctx, user)
+	if err != nil {
+		httpx.Error(w, "Failed to export account data", http.StatusInternalServerError)
+		return
+	}
+	sections := map[string]interface{}{"account": account}
+
+	// An incomplete export would look complete to the user, so any failing service aborts it
+	for _, svc := range services.All() {
+		data, err := svc.ExportUser(ctx, user.ID.Hex(), user.Email)
+		if err != nil {
+			log.Printf("Data export failed: err=%v", err)
+			httpx.Error(w, "Failed to export data from the "+svc.Name+" service, please try again later", http.StatusBadGateway)
+			return
+		}
+		sections[svc.Name] = data
+	}
+
+	exportedAt := time.Now().UTC()
+	filename := fmt.Sprintf("trademinutes-export-%s", exportedAt.Format("20060102-150405"))
+
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		zw := zip.NewWriter(w)
+		for name, data := range sections {
+			f, err := zw.Create(name + ".json")
+			if err != nil {
+				log.Printf("Failed to write export archive: err=%v", err)
+				return
+			}
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			enc.Encode(data)
+		}
+		if err := zw.Close(); err != nil {
+			log.Printf("Failed to write export archive: err=%v", err)
+		}
+		return
+	}
+
+	sections["exportedAt"] = exportedAt.Unix()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	json.NewEncoder(w).Encode(sections)
+}
+
+// DeleteAccountHandler permanently deletes the authenticated user's account. The other
+// services are cleaned up first; if any of them fails, the account is left in place so
+// the request can be retried. Accounts with a password must confirm it, and a TOTP code
+// is required when 2FA is on.
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpx.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	totpStep, ok, msg := confirmAccountOwner(ctx, r, user, req.Password, req.Code)
+	if !ok {
+		httpx.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	for _, svc := range services.All() {
+		if err := svc.DeleteUser(ctx, user.ID.Hex(), user.Email); err != nil {
+			log.Printf("Account deletion failed: err=%v", err)
+			httpx.Error(w, "Failed to delete data in the "+svc.Name+" service, please try again later", http.StatusBadGateway)
+			return
+		}
+	}
+
+	// The code is only used up once nothing can fail, so a retry can send the same one
+	if user.TwoFactorEnabled {
+		if ok, err := markTOTPUsed(ctx, user, totpStep); err != nil || !ok {
+			httpx.Error(w, "Two-factor code already used, please enter a new one", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if err := deleteAuthData(ctx, user); err != nil {
+		log.Printf("Account deletion failed: err=%v", err)
+		httpx.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account deleted"})
+}
+
+// confirmAccountOwner re-authenticates a destructive request. Password accounts must send
+// their password; OAuth-only accounts must have logged in within recentLoginWindow. With
+// 2FA on, the code is checked but not used up: the caller passes the returned time step to
+// markTOTPUsed once the request has succeeded.
+func confirmAccountOwner(ctx context.Context, r *http.Request, user models.User, password, code string) (int64, bool, string) {
+	if user.Password != "" {
+		if !utils.CheckPasswordHash(password, user.Password) {
+			return 0, false, "Incorrect password"
+		}
+	} else {
+		principal, _ := authn.PrincipalFrom(r.Context())
+		sid, _ := primitive.ObjectIDFromHex(principal.SessionID)
+		var session models.Session
+		err := config.GetDB().Collection("sessions").FindOne(ctx, bson.M{"_id": sid}).Decode(&session)
+		if err != nil || session.CreatedAt < time.Now().Add(-recentLoginWindow).Unix() {
+			return 0, false, "Please log in again before deleting your account"
+		}
+	}
+
+	if !user.TwoFactorEnabled {
+		return 0, true, ""
+	}
+	step, ok := checkTOTP(user, code)
+	if !ok {
+		return 0, false, "Invalid two-factor code"
+	}
+	return step, true, ""
+}
+
+// exportAuthData collects what the auth service stores about user, minus credentials.
+func exportAuthData(ctx context.Context, user models.User) (map[string]interface{}, error) {
+	db := config.GetDB()
+
+	var profile bson.M
+	if err := db.Collection("MyClusterCol").FindOne(ctx, bson.M{"_id": user.ID}).Decode(&profile); err != nil {
+		return nil, err
+	}
+	for _, secret := range []string{"password", "totpSecret", "pendingTotpSecret", "totpLastStep", "recoveryCodes"} {
+		delete(profile, secret)
+	}
+
+	sessions := []models.Session{}
+	if err := findAll(ctx, "sessions", bson.M{"userId": user.ID}, &sessions); err != nil {
+		return nil, err
+	}
+	tokens := []models.APIToken{}
+	if err := findAll(ctx, "api_tokens", bson.M{"userId": user.ID}, &tokens); err != nil {
+		return nil, err
+	}
+	roleChanges := []models.RoleChange{}
+	if err := findAll(ctx, "role_audit", bson.M{"userId": user.ID}, &roleChanges); err != nil {
+		return nil, err
+	}
+	authEvents := []models.AuthEvent{}
+	if err := findAll(ctx, "auth_events", bson.M{"userId": user.ID}, &authEvents); err != nil {
+		return nil, err
+	}
+	impersonations := []models.Impersonation{}
+	if err := findAll(ctx, "impersonations", bson.M{"targetId": user.ID}, &impersonations); err != nil {
+		return nil, err
+	}
+	referrals := []models.Referral{}
+	if err := findAll(ctx, "referrals", bson.M{"$or": []bson.M{{"referrerId": user.ID}, {"refereeId": user.ID}}}, &referrals); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"user":           profile,
+		"sessions":       sessions,
+		"apiTokens":      tokens,
+		"roleChanges":    roleChanges,
+		"authEvents":     authEvents,
+		"referrals":      referrals,
+		"impersonations": impersonations,
+	}, nil
+}
+
+// deleteAuthData removes the user and every credential tied to them. Role audit entries,
+// authentication events and impersonation records are kept for accountability, with
+// personal details removed.
+func deleteAuthData(ctx context.Context, user models.User) error {
+	db := config.GetDB()
+
+	byUser := bson.M{"userId": user.ID}
+	for _, name := range []string{"sessions", "api_tokens", "magic_links", "password_resets", "webauthn_sessions"} {
+		if _, err := db.Collection(name).DeleteMany(ctx, byUser); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Collection("oauth_states").DeleteMany(ctx, bson.M{"linkUserId": user.ID}); err != nil {
+		return err
+	}
+	if _, err := db.Collection(outbox.Collection).DeleteMany(ctx, bson.M{"to": user.Email, "status": bson.M{"$ne": outbox.StatusSent}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("role_audit").UpdateMany(ctx, byUser, bson.M{"$set": bson.M{"userEmail": ""}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("role_audit").UpdateMany(ctx, bson.M{"actorId": user.ID}, bson.M{"$set": bson.M{"actorEmail": ""}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("auth_events").UpdateMany(ctx, bson.M{"$or": []bson.M{byUser, {"email": user.Email}}},
+		bson.M{"$set": bson.M{"email": "", "ip": "", "userAgent": ""}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("impersonations").UpdateMany(ctx, bson.M{"targetId": user.ID}, bson.M{"$set": bson.M{"targetEmail": ""}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("impersonations").UpdateMany(ctx, bson.M{"adminId": user.ID}, bson.M{"$set": bson.M{"adminEmail": "", "ip": "", "userAgent": ""}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("impersonation_actions").UpdateMany(ctx, bson.M{"email": user.Email}, bson.M{"$set": bson.M{"email": ""}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("impersonation_actions").UpdateMany(ctx, bson.M{"adminEmail": user.Email}, bson.M{"$set": bson.M{"adminEmail": ""}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("referrals").DeleteMany(ctx, bson.M{"$or": []bson.M{{"referrerId": user.ID}, {"refereeId": user.ID}}}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("MyClusterCol").UpdateMany(ctx, bson.M{"referredBy": user.ID}, bson.M{"$unset": bson.M{"referredBy": ""}}); err != nil {
+		return err
+	}
+	key := accountKey(user.Email)
+	accountLimiter.Reset(ctx, key)
+	resetLimiter.Reset(ctx, key)
+	magicLinkLimiter.Reset(ctx, key)
+
+	_, err := db.Collection("MyClusterCol").DeleteOne(ctx, bson.M{"_id": user.ID})
+	return err
+}
+
+func findAll(ctx context.Context, collection string, filter bson.M, out interface{}) error {
+	cursor, err := config.GetDB().Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, out)
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/models"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GrantRoleHandler sets the role of a user. Admin only.
+func GrantRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role   string `json:"role"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !authn.ValidRole(req.Role) {
+		httpx.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+	changeRole(w, r, req.Role, req.Reason)
+}
+
+// RevokeRoleHandler demotes a user back to member. Admin only.
+func RevokeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	changeRole(w, r, authn.RoleMember, r.URL.Query().Get("reason"))
+}
+
+func changeRole(w http.ResponseWriter, r *http.Request, role, reason string) {
+	targetID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	actor, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if actor.ID == targetID && role != authn.RoleAdmin {
+		httpx.Error(w, "You cannot revoke your own admin role", http.StatusBadRequest)
+		return
+	}
+
+	var target models.User
+	if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"_id": targetID}).Decode(&target); err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := setRole(ctx, target, role, actor, reason); err != nil {
+		httpx.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated", "role": role})
+}
+
+// setRole updates the user's role, records the change and signs the user out
+// everywhere so the new role is reflected in their next token.
+func setRole(ctx context.Context, target models.User, role string, actor models.User, reason string) error {
+	oldRole := userRole(target)
+	if oldRole == role {
+		return nil
+	}
+
+	if _, err := config.GetDB().Collection("MyClusterCol").UpdateByID(ctx, target.ID,
+		bson.M{"$set": bson.M{"role": role}}); err != nil {
+		return err
+	}
+
+	entry := models.RoleChange{
+		UserID:     target.ID,
+		UserEmail:  target.Email,
+		OldRole:    oldRole,
+		NewRole:    role,
+		ActorID:    actor.ID,
+		ActorEmail: actor.Email,
+		Reason:     reason,
+		ChangedAt:  time.Now().Unix(),
+	}
+	if _, err := config.GetDB().Collection("role_audit").InsertOne(ctx, entry); err != nil {
+		return err
+	}
+
+	return revokeUserSessions(ctx, target.ID)
+}
+
+// ListRoleAuditHandler returns role changes, newest first, optionally filtered by ?userId=. Admin only.
+func ListRoleAuditHandler(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if idHex := r.URL.Query().Get("userId"); idHex != "" {
+		userID, err := primitive.ObjectIDFromHex(idHex)
+		if err != nil {
+			httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		filter["userId"] = userID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "changedAt", Value: -1}}).SetLimit(200)
+	cursor, err := config.GetDB().Collection("role_audit").Find(ctx, filter, opts)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.RoleChange{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// BootstrapAdmin promotes the account with the given email to admin at startup, so the
+// first admin can be created without database access. It is a no-op for an empty email.
+func BootstrapAdmin(email string) {
+	if email == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		log.Printf("Bootstrap admin %s not found: %v", email, err)
+		return
+	}
+
+	system := models.User{Email: "system"}
+	if err := setRole(ctx, user, authn.RoleAdmin, system, "BOOTSTRAP_ADMIN_EMAIL"); err != nil {
+		log.Printf("Failed to bootstrap admin %s: %v", email, err)
+	}
+}
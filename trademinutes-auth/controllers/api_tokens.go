@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultAPITokenDays = 30
+	maxAPITokenDays     = 365
+	maxAPITokensPerUser = 20
+)
+
+// CreateAPITokenHandler issues a personal access token for the authenticated user.
+// The plaintext token is returned once and cannot be retrieved again.
+func CreateAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expiresInDays"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		httpx.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		httpx.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !models.ValidScope(scope) {
+			httpx.Error(w, "Invalid scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAPITokenDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxAPITokenDays {
+		httpx.Error(w, "expiresInDays must be between 1 and 365", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	tokens := config.GetDB().Collection("api_tokens")
+	now := time.Now()
+	count, err := tokens.CountDocuments(ctx, bson.M{"userId": user.ID, "revoked": false, "expiresAt": bson.M{"$gt": now.Unix()}})
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxAPITokensPerUser {
+		httpx.Error(w, "Too many active tokens, revoke one first", http.StatusConflict)
+		return
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		httpx.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	plaintext := models.APITokenPrefix + secret
+
+	token := models.APIToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		TokenHash: utils.HashToken(plaintext),
+		Hint:      plaintext[len(plaintext)-4:],
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.AddDate(0, 0, req.ExpiresInDays).Unix(),
+	}
+	if _, err := tokens.InsertOne(ctx, token); err != nil {
+		httpx.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventAPITokenCreated, UserID: user.ID, Email: user.Email, Detail: "token " + token.ID.Hex()})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":    plaintext,
+		"apiToken": token,
+	})
+}
+
+// ListAPITokensHandler returns the authenticated user's personal access tokens, newest first.
+func ListAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := config.GetDB().Collection("api_tokens").Find(ctx, bson.M{"userId": user.ID}, opts)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []models.APIToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// RevokeAPITokenHandler revokes one of the authenticated user's personal access tokens.
+func RevokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	res, err := config.GetDB().Collection("api_tokens").UpdateOne(ctx,
+		bson.M{"_id": tokenID, "userId": user.ID, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true, "revokedAt": time.Now().Unix()}},
+	)
+	if err != nil {
+		httpx.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if res.MatchedCount == 0 {
+		httpx.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventAPITokenRevoked, UserID: user.ID, Email: user.Email, Detail: "token " + tokenID.Hex()})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Token revoked"})
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultAuthEventLimit = 50
+	maxAuthEventLimit     = 200
+)
+
+// recordEvent stores an authentication event with the caller's IP and user agent.
+// Auditing never fails the request it describes; errors are only logged.
+func recordEvent(ctx context.Context, r *http.Request, event models.AuthEvent) {
+	event.IP = utils.ClientIP(r)
+	event.UserAgent = r.UserAgent()
+	event.CreatedAt = time.Now().Unix()
+	if _, err := config.GetDB().Collection("auth_events").InsertOne(ctx, event); err != nil {
+		log.Printf("Failed to record %s event: err=%v", event.Type, err)
+	}
+}
+
+// ListMyAuthEventsHandler returns the authenticated user's own authentication events,
+// newest first. Supports ?type=, ?before=<unix> and ?limit=.
+func ListMyAuthEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	filter, limit, ok := authEventQuery(w, r)
+	if !ok {
+		return
+	}
+	filter["userId"] = user.ID
+	writeAuthEvents(ctx, w, filter, limit)
+}
+
+// ListAuthEventsHandler returns authentication events across all accounts, newest first,
+// optionally filtered by ?userId=, ?email= and ?ip= as well as ?type=, ?before= and ?limit=. Admin only.
+func ListAuthEventsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, limit, ok := authEventQuery(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if idHex := query.Get("userId"); idHex != "" {
+		userID, err := primitive.ObjectIDFromHex(idHex)
+		if err != nil {
+			httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		filter["userId"] = userID
+	}
+	if email := query.Get("email"); email != "" {
+		filter["email"] = email
+	}
+	if ip := query.Get("ip"); ip != "" {
+		filter["ip"] = ip
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	writeAuthEvents(ctx, w, filter, limit)
+}
+
+// authEventQuery parses the filters shared by both event listings.
+func authEventQuery(w http.ResponseWriter, r *http.Request) (bson.M, int64, bool) {
+	query := r.URL.Query()
+	filter := bson.M{}
+	if eventType := query.Get("type"); eventType != "" {
+		filter["type"] = eventType
+	}
+	if raw := query.Get("before"); raw != "" {
+		before, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			httpx.Error(w, "Invalid before timestamp", http.StatusBadRequest)
+			return nil, 0, false
+		}
+		filter["createdAt"] = bson.M{"$lt": before}
+	}
+
+	limit := int64(defaultAuthEventLimit)
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > maxAuthEventLimit {
+			httpx.Error(w, "limit must be between 1 and 200", http.StatusBadRequest)
+			return nil, 0, false
+		}
+		limit = n
+	}
+	return filter, limit, true
+}
+
+func writeAuthEvents(ctx context.Context, w http.ResponseWriter, filter bson.M, limit int64) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := config.GetDB().Collection("auth_events").Find(ctx, filter, opts)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.AuthEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
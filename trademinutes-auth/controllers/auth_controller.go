@@ -4,33 +4,50 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"trademinutes-auth/config"
-	"trademinutes-auth/middleware"
+	"trademinutes-auth/lockout"
 	"trademinutes-auth/models"
 	"trademinutes-auth/utils"
 
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Helper for consistent error responses
-func writeJSONError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
-}
-
 // ✅ RegisterHandler
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	collection := config.GetDB().Collection("MyClusterCol")
 
-	var user models.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		writeJSONError(w, "Invalid input", http.StatusBadRequest)
+	// Only these fields come from the client; everything else about the account is
+	// set here. inviteCode is the code of whoever invited the new user, not the user's own code.
+	var req struct {
+		Name       string `json:"name"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		InviteCode string `json:"inviteCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		httpx.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+	user := models.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+	}
+
+	if err := utils.ValidatePassword(user.Password); err != nil {
+		httpx.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -39,27 +56,52 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	count, err := collection.CountDocuments(ctx, bson.M{"email": user.Email})
 	if err != nil {
-		writeJSONError(w, "Database error", http.StatusInternalServerError)
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 	if count > 0 {
-		writeJSONError(w, "User already exists", http.StatusConflict)
+		httpx.Error(w, "User already exists", http.StatusConflict)
 		return
 	}
 
+	var referrer models.User
+	if req.InviteCode != "" {
+		if referrer, err = resolveInviteCode(ctx, req.InviteCode); err != nil {
+			httpx.Error(w, "Invalid invite code", http.StatusBadRequest)
+			return
+		}
+	}
+
 	user.Password, err = utils.HashPassword(user.Password)
 	if err != nil {
-		writeJSONError(w, "Password hashing failed", http.StatusInternalServerError)
+		httpx.Error(w, "Password hashing failed", http.StatusInternalServerError)
 		return
 	}
 
-	if _, err := collection.InsertOne(ctx, user); err != nil {
-		writeJSONError(w, "User creation failed", http.StatusInternalServerError)
+	// Accounts start unverified until the emailed link is used
+	user.VerificationSentAt = time.Now().Unix()
+	user.Role = authn.RoleMember
+	user.ReferredBy = referrer.ID
+
+	if err := insertUser(ctx, &user); err != nil {
+		httpx.Error(w, "User creation failed", http.StatusInternalServerError)
 		return
 	}
+	userID := user.ID
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventRegister, UserID: userID, Email: user.Email, Method: "password"})
+
+	if !referrer.ID.IsZero() {
+		if err := recordReferral(ctx, referrer, userID); err != nil {
+			log.Printf("Failed to record referral: err=%v", err)
+		}
+	}
+
+	if err := sendVerificationEmail(ctx, user.Email); err != nil {
+		fmt.Println("❌ Failed to send verification email:", err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully, please check your email to verify your account"})
 }
 
 // ✅ LoginHandler
@@ -70,42 +112,73 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var foundUser models.User
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		writeJSONError(w, "Invalid input", http.StatusBadRequest)
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&foundUser)
-	if err != nil {
-		writeJSONError(w, "User not found", http.StatusUnauthorized)
+	ip := utils.ClientIP(r)
+	if checkLocked(ctx, w, map[*lockout.Limiter]string{accountLimiter: accountKey(input.Email), ipLimiter: ip}) {
 		return
 	}
 
-	if !utils.CheckPasswordHash(input.Password, foundUser.Password) {
-		writeJSONError(w, "Invalid password", http.StatusUnauthorized)
+	// Unknown emails and wrong passwords get the same response and the same bcrypt cost,
+	// so the endpoint cannot be used to discover which accounts exist.
+	err := collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&foundUser)
+	hash := foundUser.Password
+	if err != nil || hash == "" {
+		hash = dummyPasswordHash
+	}
+	if !utils.CheckPasswordHash(input.Password, hash) || err != nil || foundUser.Password == "" {
+		recordFailure(ctx, input.Email, ip)
+		recordEvent(ctx, r, models.AuthEvent{Type: models.EventLoginFailed, UserID: foundUser.ID, Email: input.Email, Method: "password", Detail: "invalid credentials"})
+		httpx.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	fmt.Println("🔐 Logging in:", foundUser.Email)
-	token, err := utils.GenerateJWT(foundUser.Email)
+	completeLogin(ctx, w, r, foundUser, "password")
+}
+
+// completeLogin finishes a first-factor login (password or magic link). With 2FA on,
+// it only earns a challenge for /login/2fa; otherwise a session is issued.
+func completeLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, user models.User, method string) {
+	reply, err := loginReply(ctx, r, user, models.EventLogin, method)
 	if err != nil {
-		writeJSONError(w, "Failed to generate token", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
-	fmt.Println("✅ Token issued:", token)
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(reply)
+}
+
+// loginReply is the response to a first-factor login: a 2FA challenge if the user has
+// 2FA on, or else the token pair of a new session, whose login is recorded as event.
+func loginReply(ctx context.Context, r *http.Request, user models.User, event, method string) (map[string]interface{}, error) {
+	if user.TwoFactorEnabled {
+		challenge, err := utils.GenerateTwoFactorChallenge(user.ID.Hex())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+		}, nil
+	}
+
+	clearFailures(ctx, user.Email)
+	token, refreshToken, err := createSession(ctx, r, user)
+	if err != nil {
+		return nil, err
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: event, UserID: user.ID, Email: user.Email, Method: method})
+	return tokenPair(token, refreshToken), nil
 }
 
 // ✅ ProfileHandler
 func ProfileHandler(w http.ResponseWriter, r *http.Request) {
-	rawEmail := r.Context().Value(middleware.EmailKey)
-	fmt.Println("📥 Email from JWT context:", rawEmail)
-
-	email := rawEmail.(string)
+	email := authn.Email(r)
 	collection := config.GetDB().Collection("MyClusterCol")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -113,112 +186,36 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 
 	var user models.User
 	if err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
-		writeJSONError(w, "User not found", http.StatusNotFound)
+		httpx.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
 	user.Password = "" // Never expose password
-	fmt.Println("✅ Profile found for:", user.Email)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
-func GitHubOAuthHandler(w http.ResponseWriter, r *http.Request) {
-	collection := config.GetDB().Collection("MyClusterCol")
-
-	var input struct {
-		Email string `json:"email"`
-		Name  string `json:"name"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		fmt.Println("❌ Failed to decode GitHub input:", err)
-		writeJSONError(w, "Invalid input", http.StatusBadRequest)
-		return
-	}
-
-	fmt.Println("📩 GitHub Login for:", input.Email)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var user models.User
-	err := collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
-	if err != nil {
-		fmt.Println("👤 New GitHub user, registering:", input.Email)
-		user = models.User{
-			Email:    input.Email,
-			Name:     input.Name,
-			Password: "",
-		}
-		if _, err := collection.InsertOne(ctx, user); err != nil {
-			fmt.Println("❌ Failed to insert GitHub user:", err)
-			writeJSONError(w, "Registration failed", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	// 🧪 Generate JWT
-	token, err := utils.GenerateJWT(input.Email)
-	if err != nil {
-		fmt.Println("❌ Token generation failed:", err)
-		writeJSONError(w, "Token error", http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Println("✅ GitHub JWT issued:", token)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
-}
-
-func GoogleOAuthHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email string `json:"email"`
-		Name  string `json:"name"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		writeJSONError(w, "Invalid input", http.StatusBadRequest)
-		return
-	}
-
-	collection := config.GetDB().Collection("MyClusterCol")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var user models.User
-	err := collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
-	if err != nil {
-		// Not found → register
-		user = models.User{Email: input.Email, Name: input.Name}
-		if _, err := collection.InsertOne(ctx, user); err != nil {
-			writeJSONError(w, "Failed to register", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	token, err := utils.GenerateJWT(input.Email)
-	if err != nil {
-		writeJSONError(w, "Token generation failed", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+// publicProfile is what anyone may see of a user: no credentials, linked identities,
+// passkeys, invite code or contact addresses.
+type publicProfile struct {
+	ID              primitive.ObjectID `json:"id"`
+	Name            string             `json:"name"`
+	VerifiedStudent bool               `json:"verifiedStudent"`
+	Institution     string             `json:"institution,omitempty"`
 }
 
-// GetUserByIDHandler returns user info by MongoDB ObjectID
+// GetUserByIDHandler returns the public profile of a user by MongoDB ObjectID
 func GetUserByIDHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idHex := vars["id"]
 	if idHex == "" {
-		writeJSONError(w, "Missing user ID", http.StatusBadRequest)
+		httpx.Error(w, "Missing user ID", http.StatusBadRequest)
 		return
 	}
 	objID, err := primitive.ObjectIDFromHex(idHex)
 	if err != nil {
-		writeJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 	collection := config.GetDB().Collection("MyClusterCol")
@@ -227,10 +224,14 @@ func GetUserByIDHandler(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	err = collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
 	if err != nil {
-		writeJSONError(w, "User not found", http.StatusNotFound)
+		httpx.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
-	user.Password = "" // Never expose password
+	profile := publicProfile{ID: user.ID, Name: user.Name}
+	if sv := user.StudentVerification; sv != nil {
+		profile.VerifiedStudent = true
+		profile.Institution = sv.Institution
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(profile)
 }
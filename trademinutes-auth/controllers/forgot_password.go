@@ -3,69 +3,114 @@ package controllers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
 	"net/http"
-	"net/smtp"
-	"os"
+	"net/url"
 	"time"
-	"log"
-	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson"
 	"trademinutes-auth/config"
+	"trademinutes-auth/lockout"
+	"trademinutes-auth/mailer"
 	"trademinutes-auth/models"
 	"trademinutes-auth/utils"
 )
 
+// passwordResetTTL is how long an emailed reset link stays valid.
+const passwordResetTTL = 15 * time.Minute
+
 func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		httpx.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	// Check if user exists
 	collection := config.GetDB().Collection("MyClusterCol")
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
+	// Every request counts, successful or not, so the endpoint cannot be used to flood an inbox
+	ip := utils.ClientIP(r)
+	if checkLocked(ctx, w, map[*lockout.Limiter]string{resetLimiter: accountKey(req.Email), ipLimiter: ip}) {
+		return
+	}
+	now := time.Now()
+	if err := resetLimiter.Fail(ctx, accountKey(req.Email), now); err != nil {
+		log.Printf("Failed to record reset request: err=%v", err)
+	}
+	if err := ipLimiter.Fail(ctx, ip, now); err != nil {
+		log.Printf("Failed to record reset request: err=%v", err)
+	}
+
+	// The response is the same whether or not the account exists
+	const sentMessage = "If an account exists for this email, a password reset link has been sent"
 	var user models.User
 	err := collection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventPasswordResetRequested, UserID: user.ID, Email: req.Email})
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		w.Write([]byte(sentMessage))
 		return
 	}
 
-	// Generate reset token
-	resetToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email": req.Email,
-		"exp":   time.Now().Add(15 * time.Minute).Unix(),
-	})
-	secret := []byte(os.Getenv("JWT_RESET_SECRET"))
-	tokenString, _ := resetToken.SignedString(secret)
+	tokenString, err := createPasswordReset(ctx, user, ip)
+	if err != nil {
+		log.Printf("Failed to create reset token: err=%v", err)
+		httpx.Error(w, "Failed to create reset token", http.StatusInternalServerError)
+		return
+	}
 
-	// Send email
-	resetURL := fmt.Sprintf("%s/reset-password?token=%s", os.Getenv("FRONTEND_URL"), tokenString)
-	sendEmail(req.Email, "Password Reset", fmt.Sprintf("Click to reset password: %s", resetURL))
+	// Queue email
+	resetURL := frontendURL("/reset-password?token=" + url.QueryEscape(tokenString))
+	if err := mailer.Enqueue(ctx, user.Email, mailer.TemplatePasswordReset, map[string]interface{}{
+		"Link":      resetURL,
+		"ExpiresIn": "15 minutes",
+	}); err != nil {
+		log.Printf("Failed to queue reset email: err=%v", err)
+		httpx.Error(w, "Failed to send reset email", http.StatusInternalServerError)
+		return
+	}
 
-	w.Write([]byte("Password reset email sent"))
+	w.Write([]byte(sentMessage))
 }
 
-func sendEmail(to, subject, body string) {
-	from := os.Getenv("EMAIL_FROM")
-	auth := smtp.PlainAuth("", os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASS"), os.Getenv("SMTP_HOST"))
+// createPasswordReset invalidates the user's outstanding reset tokens and stores a new one.
+// Only the hash is persisted; the returned plaintext goes into the emailed link.
+func createPasswordReset(ctx context.Context, user models.User, ip string) (string, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
 
-	msg := []byte("To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n\r\n" +
-		body + "\r\n")
+	resets := config.GetDB().Collection("password_resets")
+	if _, err := resets.UpdateMany(ctx,
+		bson.M{"userId": user.ID, "used": false, "invalidated": false},
+		bson.M{"$set": bson.M{"invalidated": true}},
+	); err != nil {
+		return "", err
+	}
 
-	_ = smtp.SendMail(os.Getenv("SMTP_HOST")+":"+os.Getenv("SMTP_PORT"), auth, from, []string{to}, msg)
+	now := time.Now()
+	reset := models.PasswordReset{
+		ID:        utils.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		IP:        ip,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(passwordResetTTL).Unix(),
+	}
+	if _, err := resets.InsertOne(ctx, reset); err != nil {
+		return "", err
+	}
+	return token, nil
 }
 
+// ResetPasswordHandler sets a new password from a reset token. The token is consumed
+// atomically, so a link works only once, and every session is signed out afterwards.
 func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("ResetPasswordHandler invoked")
-
 	var req struct {
 		Token       string `json:"token"`
 		NewPassword string `json:"newPassword"`
@@ -73,65 +118,77 @@ func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Decode request body
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.NewPassword == "" {
-		log.Printf("Invalid request body: err=%v, token=%s, newPassword=%s", err, req.Token, req.NewPassword)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		httpx.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	log.Println("Request body decoded successfully")
 
-	// Parse the JWT token
-	secret := []byte(os.Getenv("JWT_RESET_SECRET"))
-	token, err := jwt.Parse(req.Token, func(token *jwt.Token) (interface{}, error) {
-		return secret, nil
-	})
-	if err != nil || !token.Valid {
-		log.Printf("Token parse error or invalid token: err=%v, valid=%v", err, token.Valid)
-		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+	// Check the policy before consuming the token, so a weak password doesn't burn the link
+	if err := utils.ValidatePassword(req.NewPassword); err != nil {
+		httpx.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Println("JWT token parsed successfully")
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || claims["email"] == nil {
-		log.Println("Invalid token claims or missing email")
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("Password hashing failed: err=%v", err)
+		httpx.Error(w, "Password hashing failed", http.StatusInternalServerError)
 		return
 	}
-	email := claims["email"].(string)
-	log.Printf("Token claims extracted: email=%s", email)
-
-	// Get DB collection
-	collection := config.GetDB().Collection("MyClusterCol")
-	log.Println("MongoDB collection accessed")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Hash the new password
-	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	now := time.Now()
+	var reset models.PasswordReset
+	err = config.GetDB().Collection("password_resets").FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":         utils.HashToken(req.Token),
+			"used":        false,
+			"invalidated": false,
+			"expiresAt":   bson.M{"$gt": now.Unix()},
+		},
+		bson.M{"$set": bson.M{"used": true, "usedAt": now.Unix()}},
+	).Decode(&reset)
 	if err != nil {
-		log.Printf("Password hashing failed: err=%v", err)
-		http.Error(w, "Password hashing failed", http.StatusInternalServerError)
+		httpx.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 		return
 	}
-	log.Println("Password hashed successfully")
 
 	// Update password in DB
-	res, err := collection.UpdateOne(ctx,
-		bson.M{"email": email},
+	var user models.User
+	err = config.GetDB().Collection("MyClusterCol").FindOneAndUpdate(ctx,
+		bson.M{"_id": reset.UserID},
 		bson.M{"$set": bson.M{"password": hashedPassword}},
-	)
+	).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to update password in DB: err=%v", err)
-		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to update password", http.StatusInternalServerError)
 		return
 	}
-	if res.MatchedCount == 0 {
-		log.Printf("No user found with email: %s", email)
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventPasswordReset, UserID: user.ID, Email: user.Email})
+
+	// Any other link sent before this reset is now stale
+	if _, err := config.GetDB().Collection("password_resets").UpdateMany(ctx,
+		bson.M{"userId": user.ID, "used": false, "invalidated": false},
+		bson.M{"$set": bson.M{"invalidated": true}},
+	); err != nil {
+		log.Printf("Failed to invalidate reset tokens: err=%v", err)
+	}
+
+	// Sign out every device that was logged in with the old password
+	if err := revokeUserSessions(ctx, user.ID); err != nil {
+		log.Printf("Failed to revoke sessions: err=%v", err)
+	}
+
+	if err := mailer.Enqueue(ctx, user.Email, mailer.TemplatePasswordChanged, map[string]interface{}{
+		"Link": frontendURL("/forgot-password"),
+	}); err != nil {
+		log.Printf("Failed to queue password changed email: err=%v", err)
 	}
-	log.Printf("Password updated successfully for email: %s", email)
 
 	w.Write([]byte("Password updated successfully"))
 }
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StartImpersonationHandler issues a short-lived token that lets an admin act as another
+// user for support. A reason is required. Tokens are read-only unless allowWrites is set.
+// Admin only.
+func StartImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	targetID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Reason      string `json:"reason"`
+		AllowWrites bool   `json:"allowWrites"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > 500 {
+		httpx.Error(w, "A reason of at most 500 characters is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	admin, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	var target models.User
+	if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"_id": targetID}).Decode(&target); err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	// Acting as another admin would hand out their admin rights under a different name
+	if target.ID == admin.ID || authn.RoleAtLeast(userRole(target), authn.RoleAdmin) {
+		httpx.Error(w, "Admins cannot be impersonated", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	imp := models.Impersonation{
+		AdminID:     admin.ID,
+		AdminEmail:  admin.Email,
+		TargetID:    target.ID,
+		TargetEmail: target.Email,
+		Reason:      req.Reason,
+		ReadOnly:    !req.AllowWrites,
+		IP:          utils.ClientIP(r),
+		UserAgent:   r.UserAgent(),
+		CreatedAt:   now.Unix(),
+		ExpiresAt:   now.Add(utils.ImpersonationTTL).Unix(),
+	}
+	res, err := config.GetDB().Collection("impersonations").InsertOne(ctx, imp)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	imp.ID = res.InsertedID.(primitive.ObjectID)
+
+	token, err := utils.GenerateImpersonationToken(target.Email, imp.ID.Hex(), userRole(target), admin.ID.Hex(), admin.Email, imp.ReadOnly)
+	if err != nil {
+		httpx.Error(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+
+	// Recorded on the target's account, so they can see who acted as them and why
+	detail := "by " + admin.Email + ": " + req.Reason
+	if !imp.ReadOnly {
+		detail += " (writes allowed)"
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventImpersonationStarted, UserID: target.ID, Email: target.Email, Detail: detail})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":         token,
+		"expiresIn":     int(utils.ImpersonationTTL.Seconds()),
+		"impersonation": imp,
+	})
+}
+
+// EndImpersonationHandler revokes an impersonation before it expires. Admin only.
+func EndImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid impersonation ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var imp models.Impersonation
+	err = config.GetDB().Collection("impersonations").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true, "revokedAt": time.Now().Unix()}},
+	).Decode(&imp)
+	if err == mongo.ErrNoDocuments {
+		httpx.Error(w, "Impersonation not found or already ended", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventImpersonationEnded, UserID: imp.TargetID, Email: imp.TargetEmail, Detail: "by " + imp.AdminEmail})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Impersonation ended"})
+}
+
+// ListImpersonationsHandler returns impersonations, newest first, optionally filtered by
+// ?adminId= or ?userId= (the impersonated user). Admin only.
+func ListImpersonationsHandler(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	for param, field := range map[string]string{"adminId": "adminId", "userId": "targetId"} {
+		if idHex := r.URL.Query().Get(param); idHex != "" {
+			id, err := primitive.ObjectIDFromHex(idHex)
+			if err != nil {
+				httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+			filter[field] = id
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(200)
+	cursor, err := config.GetDB().Collection("impersonations").Find(ctx, filter, opts)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.Impersonation{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ListImpersonatedActionsHandler returns the writes made through one impersonation, as
+// recorded by the services that handled them. Admin only.
+func ListImpersonatedActionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid impersonation ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetLimit(500)
+	cursor, err := config.GetDB().Collection("impersonation_actions").Find(ctx, bson.M{"impersonationId": id}, opts)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	actions := []models.ImpersonatedAction{}
+	if err := cursor.All(ctx, &actions); err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(actions)
+}
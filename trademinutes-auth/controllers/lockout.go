@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/lockout"
+	"trademinutes-auth/models"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// attemptStore holds the failure counters for every limiter below.
+var attemptStore lockout.Store = lockout.NewMongoStore("login_attempts")
+
+var (
+	// Failed password or 2FA attempts per account
+	accountLimiter = &lockout.Limiter{Store: attemptStore, Prefix: "account:", Policy: lockout.Policy{
+		FreeAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, Window: 24 * time.Hour,
+	}}
+	// Failed attempts per client IP, across all accounts
+	ipLimiter = &lockout.Limiter{Store: attemptStore, Prefix: "ip:", Policy: lockout.Policy{
+		FreeAttempts: 20, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, Window: 24 * time.Hour,
+	}}
+	// Password reset requests per address; every request counts
+	resetLimiter = &lockout.Limiter{Store: attemptStore, Prefix: "reset:", Policy: lockout.Policy{
+		FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour,
+	}}
+	// Magic link requests per address; every request counts
+	magicLinkLimiter = &lockout.Limiter{Store: attemptStore, Prefix: "magic:", Policy: lockout.Policy{
+		FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour,
+	}}
+)
+
+// dummyPasswordHash is compared against when the email is unknown, so a missing
+// account takes as long to reject as a wrong password.
+const dummyPasswordHash = "$2a$14$OmZ5Swb1taZZbAx0n2C/H.NKPMkITnKVLHLMaIZY3OdUsOHzmw3jO"
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLocked writes a 429 and returns true if any of the given limiter/key pairs is locked.
+// A store error fails open: locking everyone out because the counters are down is worse.
+func checkLocked(ctx context.Context, w http.ResponseWriter, checks map[*lockout.Limiter]string) bool {
+	now := time.Now()
+	var wait time.Duration
+	for limiter, key := range checks {
+		d, err := limiter.RetryAfter(ctx, key, now)
+		if err != nil {
+			log.Printf("Lockout check failed: err=%v", err)
+			continue
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	if wait == 0 {
+		return false
+	}
+
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	httpx.Error(w, "Too many attempts, please try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// recordFailure counts a failed attempt against the account and the client IP.
+func recordFailure(ctx context.Context, email, ip string) {
+	now := time.Now()
+	if err := accountLimiter.Fail(ctx, accountKey(email), now); err != nil {
+		log.Printf("Failed to record login failure: err=%v", err)
+	}
+	if err := ipLimiter.Fail(ctx, ip, now); err != nil {
+		log.Printf("Failed to record login failure: err=%v", err)
+	}
+}
+
+// clearFailures resets the account counter after a successful login. The IP counter is
+// left alone so one valid account cannot be used to reset a spraying attacker's budget.
+func clearFailures(ctx context.Context, email string) {
+	if err := accountLimiter.Reset(ctx, accountKey(email)); err != nil {
+		log.Printf("Failed to reset login failures: err=%v", err)
+	}
+}
+
+// UnlockAccountHandler clears the failed-login counters of a user. Admin only.
+func UnlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := accountLimiter.Reset(ctx, accountKey(user.Email)); err != nil {
+		httpx.Error(w, "Failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+	if err := resetLimiter.Reset(ctx, accountKey(user.Email)); err != nil {
+		httpx.Error(w, "Failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+	if err := magicLinkLimiter.Reset(ctx, accountKey(user.Email)); err != nil {
+		httpx.Error(w, "Failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account unlocked"})
+}
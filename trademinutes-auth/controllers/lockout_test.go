@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"trademinutes-auth/lockout"
+)
+
+// useMemoryLockout points every limiter at a fresh in-memory store for one test.
+func useMemoryLockout(t *testing.T) {
+	t.Helper()
+	limiters := []*lockout.Limiter{accountLimiter, ipLimiter, resetLimiter, magicLinkLimiter}
+	saved := make([]lockout.Store, len(limiters))
+	store := lockout.NewMemoryStore()
+	for i, l := range limiters {
+		saved[i], l.Store = l.Store, store
+	}
+	t.Cleanup(func() {
+		for i, l := range limiters {
+			l.Store = saved[i]
+		}
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	useMemoryLockout(t)
+	ctx := context.Background()
+	checks := map[*lockout.Limiter]string{accountLimiter: accountKey(" A@Example.com "), ipLimiter: "203.0.113.7"}
+
+	for i := 0; i < accountLimiter.Policy.FreeAttempts; i++ {
+		if checkLocked(ctx, httptest.NewRecorder(), checks) {
+			t.Fatalf("locked after %d failures", i)
+		}
+		recordFailure(ctx, "a@example.com", "203.0.113.7")
+	}
+	if checkLocked(ctx, httptest.NewRecorder(), checks) {
+		t.Fatal("locked while the free attempts last")
+	}
+
+	recordFailure(ctx, "a@example.com", "203.0.113.7")
+	w := httptest.NewRecorder()
+	if !checkLocked(ctx, w, checks) {
+		t.Fatal("not locked after the free attempts")
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("got %d with Retry-After %q, want 429 with a Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// A successful login clears the account but not the address
+	clearFailures(ctx, "A@example.com")
+	if checkLocked(ctx, httptest.NewRecorder(), map[*lockout.Limiter]string{accountLimiter: accountKey("a@example.com")}) {
+		t.Fatal("account still locked after a successful login")
+	}
+	if rec, _ := ipLimiter.Store.Get(ctx, ipLimiter.Prefix+"203.0.113.7"); rec.Failures != accountLimiter.Policy.FreeAttempts+1 {
+		t.Fatalf("address has %d failures after a successful login, want them kept", rec.Failures)
+	}
+}
+
+func TestIPLockoutSpansAccounts(t *testing.T) {
+	useMemoryLockout(t)
+	ctx := context.Background()
+
+	for i := 0; i <= ipLimiter.Policy.FreeAttempts; i++ {
+		recordFailure(ctx, "user"+string(rune('a'+i))+"@example.com", "203.0.113.9")
+	}
+	if !checkLocked(ctx, httptest.NewRecorder(), map[*lockout.Limiter]string{accountLimiter: "new@example.com", ipLimiter: "203.0.113.9"}) {
+		t.Fatal("spraying one address across accounts is not locked")
+	}
+	if checkLocked(ctx, httptest.NewRecorder(), map[*lockout.Limiter]string{ipLimiter: "203.0.113.10"}) {
+		t.Fatal("another address is locked")
+	}
+}
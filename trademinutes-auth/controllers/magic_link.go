@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/lockout"
+	"trademinutes-auth/mailer"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// magicLinkTTL is how long an emailed login link stays valid.
+const magicLinkTTL = 10 * time.Minute
+
+// MagicLinkHandler emails a single-use login link. The response is the same whether
+// or not the address belongs to an account.
+func MagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Every request counts, like password resets, so the endpoint cannot flood an inbox
+	ip := utils.ClientIP(r)
+	if checkLocked(ctx, w, map[*lockout.Limiter]string{magicLinkLimiter: accountKey(req.Email), ipLimiter: ip}) {
+		return
+	}
+	now := time.Now()
+	if err := magicLinkLimiter.Fail(ctx, accountKey(req.Email), now); err != nil {
+		log.Printf("Failed to record magic link request: err=%v", err)
+	}
+	if err := ipLimiter.Fail(ctx, ip, now); err != nil {
+		log.Printf("Failed to record magic link request: err=%v", err)
+	}
+
+	var user models.User
+	if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"email": req.Email}).Decode(&user); err == nil {
+		if err := sendMagicLink(ctx, user, ip); err != nil {
+			log.Printf("Failed to send magic link: err=%v", err)
+			httpx.Error(w, "Failed to send login link", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "If an account exists for this email, a login link has been sent"})
+}
+
+// sendMagicLink invalidates the user's outstanding links, stores a new one and queues the email.
+func sendMagicLink(ctx context.Context, user models.User, ip string) error {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	links := config.GetDB().Collection("magic_links")
+	if _, err := links.UpdateMany(ctx,
+		bson.M{"userId": user.ID, "used": false, "invalidated": false},
+		bson.M{"$set": bson.M{"invalidated": true}},
+	); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := links.InsertOne(ctx, models.MagicLink{
+		ID:        utils.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		IP:        ip,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(magicLinkTTL).Unix(),
+	}); err != nil {
+		return err
+	}
+
+	return mailer.Enqueue(ctx, user.Email, mailer.TemplateMagicLink, map[string]interface{}{
+		"Link":      frontendURL("/magic-link?token=" + url.QueryEscape(token)),
+		"ExpiresIn": "10 minutes",
+	})
+}
+
+// MagicLinkVerifyHandler exchanges a magic link token for a session, exactly like a
+// password login: accounts with 2FA still have to pass the second factor.
+func MagicLinkVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var link models.MagicLink
+	err := config.GetDB().Collection("magic_links").FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":         utils.HashToken(req.Token),
+			"used":        false,
+			"invalidated": false,
+			"expiresAt":   bson.M{"$gt": now.Unix()},
+		},
+		bson.M{"$set": bson.M{"used": true, "usedAt": now.Unix()}},
+	).Decode(&link)
+	if err != nil {
+		httpx.Error(w, "Invalid or expired link", http.StatusUnauthorized)
+		return
+	}
+
+	// Opening the link proves the user controls the address
+	var user models.User
+	err = config.GetDB().Collection("MyClusterCol").FindOneAndUpdate(ctx,
+		bson.M{"_id": link.UserID},
+		bson.M{"$set": bson.M{"emailVerified": true}},
+	).Decode(&user)
+	if err != nil {
+		httpx.Error(w, "Invalid or expired link", http.StatusUnauthorized)
+		return
+	}
+
+	completeLogin(ctx, w, r, user, "magic_link")
+}
@@ -0,0 +1,398 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/models"
+	"trademinutes-auth/oauth"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	oauthStateTTL = 10 * time.Minute
+	// oauthCookie holds a nonce tying a pending flow to the browser that started it,
+	// so a consent URL handed to someone else cannot be completed in their browser.
+	oauthCookie     = "oauth_nonce"
+	oauthCookiePath = "/api/auth/oauth/"
+)
+
+var (
+	errIdentityLinked  = errors.New("this account is already linked to another user")
+	errEmailUnverified = errors.New("an account with this email exists; log in and link the provider from settings")
+)
+
+// OAuthStartHandler redirects the browser to the provider's consent page.
+func OAuthStartHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauth.Get(mux.Vars(r)["provider"])
+	if !ok {
+		httpx.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	authURL, err := beginOAuth(ctx, w, provider, primitive.NilObjectID)
+	if err != nil {
+		httpx.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OAuthLinkHandler starts a flow that links a provider account to the authenticated user.
+// It returns the consent URL instead of redirecting, since the request carries a bearer token.
+// The callback hands the code back to the frontend, which finishes the link with
+// OAuthLinkCompleteHandler under the same user's session.
+func OAuthLinkHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauth.Get(mux.Vars(r)["provider"])
+	if !ok {
+		httpx.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	authURL, err := beginOAuth(ctx, w, provider, user.ID)
+	if err != nil {
+		httpx.Error(w, "Failed to start linking", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"url": authURL})
+}
+
+// OAuthCallbackHandler completes the authorization-code flow: it consumes the state,
+// exchanges the code with the PKCE verifier and logs in (or links) the provider identity.
+func OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauth.Get(mux.Vars(r)["provider"])
+	if !ok {
+		httpx.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		httpx.Error(w, "Provider returned error: "+e, http.StatusBadRequest)
+		return
+	}
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		httpx.Error(w, "Missing code or state", http.StatusBadRequest)
+		return
+	}
+
+	// Only the browser that started the flow holds the nonce
+	nonce := takeOAuthNonce(w, r)
+	if nonce == "" {
+		httpx.Error(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	states := config.GetDB().Collection("oauth_states")
+	filter := bson.M{
+		"_id":       utils.HashToken(state),
+		"provider":  provider.Name(),
+		"nonceHash": utils.HashToken(nonce),
+	}
+	var pending models.OAuthState
+	if err := states.FindOne(ctx, filter).Decode(&pending); err != nil || pending.ExpiresAt < time.Now().Unix() {
+		httpx.Error(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	}
+
+	// Links are finished by the frontend, which proves the session of the user who
+	// started them; the state stays pending until then.
+	if !pending.LinkUserID.IsZero() {
+		fragment := url.Values{"provider": {provider.Name()}, "code": {code}, "state": {state}}
+		http.Redirect(w, r, frontendURL("/settings")+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	// States are single-use: deleting on read stops replays of the callback URL.
+	if res, err := states.DeleteOne(ctx, filter); err != nil || res.DeletedCount == 0 {
+		httpx.Error(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, err := provider.Exchange(ctx, code, pending.CodeVerifier)
+	if err != nil {
+		fmt.Println("❌ OAuth code exchange failed:", err)
+		httpx.Error(w, "Code exchange failed", http.StatusBadGateway)
+		return
+	}
+	identity, err := provider.UserInfo(ctx, accessToken)
+	if err != nil {
+		fmt.Println("❌ OAuth user info failed:", err)
+		httpx.Error(w, "Failed to fetch user info", http.StatusBadGateway)
+		return
+	}
+
+	user, err := findOrCreateOAuthUser(ctx, r, provider.Name(), identity)
+	if err != nil {
+		recordEvent(ctx, r, models.AuthEvent{Type: models.EventLoginFailed, UserID: user.ID, Email: identity.Email, Method: provider.Name(), Detail: err.Error()})
+		writeOAuthError(w, err)
+		return
+	}
+
+	// Accounts with 2FA get a challenge for /login/2fa instead of a session
+	reply, err := loginReply(ctx, r, user, models.EventOAuthLogin, provider.Name())
+	if err != nil {
+		httpx.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	// Tokens travel in the fragment so they never reach server logs or Referer headers.
+	fragment := url.Values{}
+	for k, v := range reply {
+		fragment.Set(k, fmt.Sprint(v))
+	}
+	http.Redirect(w, r, frontendURL("/"+provider.Name()+"-auth")+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// OAuthLinkCompleteHandler finishes a link flow: the state must have been started by the
+// authenticated user, whose session the callback itself cannot see.
+func OAuthLinkCompleteHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauth.Get(mux.Vars(r)["provider"])
+	if !ok {
+		httpx.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.State == "" {
+		httpx.Error(w, "Missing code or state", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var pending models.OAuthState
+	err = config.GetDB().Collection("oauth_states").FindOneAndDelete(ctx, bson.M{
+		"_id":        utils.HashToken(req.State),
+		"provider":   provider.Name(),
+		"linkUserId": user.ID,
+	}).Decode(&pending)
+	if err != nil || pending.ExpiresAt < time.Now().Unix() {
+		httpx.Error(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, err := provider.Exchange(ctx, req.Code, pending.CodeVerifier)
+	if err != nil {
+		fmt.Println("❌ OAuth code exchange failed:", err)
+		httpx.Error(w, "Code exchange failed", http.StatusBadGateway)
+		return
+	}
+	identity, err := provider.UserInfo(ctx, accessToken)
+	if err != nil {
+		fmt.Println("❌ OAuth user info failed:", err)
+		httpx.Error(w, "Failed to fetch user info", http.StatusBadGateway)
+		return
+	}
+	if err := linkIdentity(ctx, user.ID, provider.Name(), identity); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"linked": provider.Name()})
+}
+
+// beginOAuth stores a fresh state/PKCE pair, binds it to the browser with a nonce cookie
+// and returns the provider consent URL.
+func beginOAuth(ctx context.Context, w http.ResponseWriter, provider oauth.Provider, linkUserID primitive.ObjectID) (string, error) {
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	pending := models.OAuthState{
+		ID:           utils.HashToken(state),
+		Provider:     provider.Name(),
+		CodeVerifier: verifier,
+		NonceHash:    utils.HashToken(nonce),
+		LinkUserID:   linkUserID,
+		CreatedAt:    now.Unix(),
+		ExpiresAt:    now.Add(oauthStateTTL).Unix(),
+	}
+	if _, err := config.GetDB().Collection("oauth_states").InsertOne(ctx, pending); err != nil {
+		return "", err
+	}
+
+	setOAuthNonce(w, nonce, oauthStateTTL)
+	return provider.AuthCodeURL(state, oauth.CodeChallenge(verifier)), nil
+}
+
+// setOAuthNonce sets the nonce cookie; a zero maxAge clears it. Lax lets the cookie
+// ride along on the provider's top-level redirect back to the callback.
+func setOAuthNonce(w http.ResponseWriter, nonce string, maxAge time.Duration) {
+	cookie := &http.Cookie{
+		Name:     oauthCookie,
+		Value:    nonce,
+		Path:     oauthCookiePath,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(os.Getenv("OAUTH_CALLBACK_BASE_URL"), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge <= 0 {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// takeOAuthNonce returns the nonce cookie of the request, clearing it in the response.
+func takeOAuthNonce(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(oauthCookie)
+	if err != nil {
+		return ""
+	}
+	setOAuthNonce(w, "", 0)
+	return cookie.Value
+}
+
+// findOrCreateOAuthUser resolves a provider identity to a user. Known identities log in
+// directly; a verified email matching an existing account links to it; otherwise a new user is created.
+func findOrCreateOAuthUser(ctx context.Context, r *http.Request, provider string, identity oauth.Identity) (models.User, error) {
+	collection := config.GetDB().Collection("MyClusterCol")
+
+	var user models.User
+	err := collection.FindOne(ctx, identityFilter(provider, identity.Subject)).Decode(&user)
+	if err == nil {
+		return user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	linked := models.Identity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: time.Now().Unix(),
+	}
+
+	err = collection.FindOne(ctx, bson.M{"email": identity.Email}).Decode(&user)
+	if err == nil {
+		// Only trust the provider's email for linking if the provider verified it,
+		// otherwise anyone could claim an existing account.
+		if !identity.EmailVerified {
+			return user, errEmailUnverified
+		}
+		if _, err := collection.UpdateByID(ctx, user.ID, bson.M{"$push": bson.M{"identities": linked}}); err != nil {
+			return user, err
+		}
+		user.Identities = append(user.Identities, linked)
+		return user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	user = models.User{
+		Email:         identity.Email,
+		Name:          identity.Name,
+		Identities:    []models.Identity{linked},
+		EmailVerified: identity.EmailVerified,
+		Role:          authn.RoleMember,
+	}
+	if err := insertUser(ctx, &user); err != nil {
+		return user, err
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventRegister, UserID: user.ID, Email: user.Email, Method: provider})
+	return user, nil
+}
+
+// linkIdentity attaches a provider identity to an existing user.
+func linkIdentity(ctx context.Context, userID primitive.ObjectID, provider string, identity oauth.Identity) error {
+	collection := config.GetDB().Collection("MyClusterCol")
+
+	var owner models.User
+	err := collection.FindOne(ctx, identityFilter(provider, identity.Subject)).Decode(&owner)
+	if err == nil {
+		if owner.ID == userID {
+			return nil
+		}
+		return errIdentityLinked
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	_, err = collection.UpdateByID(ctx, userID, bson.M{"$push": bson.M{"identities": models.Identity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: time.Now().Unix(),
+	}}})
+	return err
+}
+
+func identityFilter(provider, subject string) bson.M {
+	return bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+}
+
+func writeOAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errIdentityLinked) || errors.Is(err, errEmailUnverified) {
+		httpx.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	fmt.Println("❌ OAuth login failed:", err)
+	httpx.Error(w, "Login failed", http.StatusInternalServerError)
+}
+
+func frontendURL(path string) string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return base + path
+}
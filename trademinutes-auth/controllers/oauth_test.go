@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"trademinutes-auth/oauth"
+
+	"github.com/gorilla/mux"
+)
+
+// stubProvider fails the test if a flow gets as far as the code exchange.
+type stubProvider struct{ t *testing.T }
+
+func (stubProvider) Name() string { return "stub" }
+func (stubProvider) AuthCodeURL(state, challenge string) string {
+	return "https://idp.example/authorize"
+}
+
+func (p stubProvider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	p.t.Error("code exchanged")
+	return "", errors.New("unexpected exchange")
+}
+
+func (p stubProvider) UserInfo(ctx context.Context, accessToken string) (oauth.Identity, error) {
+	p.t.Error("user info fetched")
+	return oauth.Identity{}, errors.New("unexpected user info")
+}
+
+func TestOAuthCallbackWithoutNonce(t *testing.T) {
+	oauth.Register(stubProvider{t})
+
+	// A consent URL opened in another browser arrives with a valid state but no cookie;
+	// it is refused before the state is looked up.
+	r := httptest.NewRequest(http.MethodGet, "/api/auth/oauth/stub/callback?code=c&state=s", nil)
+	r = mux.SetURLVars(r, map[string]string{"provider": "stub"})
+	w := httptest.NewRecorder()
+	OAuthCallbackHandler(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400", w.Code)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("set a cookie on a request that had none")
+	}
+}
+
+func TestOAuthNonceCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	setOAuthNonce(w, "nonce", oauthStateTTL)
+	set := w.Result().Cookies()
+	if len(set) != 1 {
+		t.Fatalf("%d cookies set", len(set))
+	}
+	c := set[0]
+	if c.Value != "nonce" || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode || c.Path != oauthCookiePath || c.MaxAge != int(oauthStateTTL/time.Second) {
+		t.Fatalf("cookie %+v", c)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, oauthCookiePath+"stub/callback", nil)
+	r.AddCookie(c)
+	w = httptest.NewRecorder()
+	if got := takeOAuthNonce(w, r); got != "nonce" {
+		t.Fatalf("took %q", got)
+	}
+	if cleared := w.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Fatalf("cookie not cleared: %+v", cleared)
+	}
+}
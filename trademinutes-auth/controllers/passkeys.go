@@ -0,0 +1,607 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/lockout"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	passkeyCeremonyTTL = 5 * time.Minute
+	maxPasskeysPerUser = 10
+)
+
+var errCeremonyInvalid = errors.New("invalid or expired passkey ceremony")
+
+// passkeyUser adapts a user to the webauthn library. The user handle is the ObjectID,
+// which lets a discoverable login find the account without asking for an email.
+type passkeyUser struct {
+	models.User
+}
+
+func (u passkeyUser) WebAuthnID() []byte {
+	id := u.ID
+	return id[:]
+}
+
+func (u passkeyUser) WebAuthnName() string { return u.Email }
+
+func (u passkeyUser) WebAuthnDisplayName() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Email
+}
+
+func (u passkeyUser) WebAuthnIcon() string { return "" }
+
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, 0, len(u.Passkeys))
+	for _, p := range u.Passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(p.ID)
+		if err != nil {
+			continue
+		}
+		transports := make([]protocol.AuthenticatorTransport, len(p.Transports))
+		for i, t := range p.Transports {
+			transports[i] = protocol.AuthenticatorTransport(t)
+		}
+		creds = append(creds, webauthn.Credential{
+			ID:              id,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.CredentialFlags{BackupEligible: p.BackupEligible, BackupState: p.BackupState},
+			Authenticator:   webauthn.Authenticator{AAGUID: p.AAGUID, SignCount: p.SignCount, CloneWarning: p.CloneWarning},
+		})
+	}
+	return creds
+}
+
+func newPasskey(cred *webauthn.Credential, name string) models.Passkey {
+	transports := make([]string, len(cred.Transport))
+	for i, t := range cred.Transport {
+		transports[i] = string(t)
+	}
+	if name == "" {
+		name = "Passkey"
+	}
+	return models.Passkey{
+		ID:              base64.RawURLEncoding.EncodeToString(cred.ID),
+		Name:            name,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      transports,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+		CreatedAt:       time.Now().Unix(),
+	}
+}
+
+// relyingParty configures WebAuthn from WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS. The origins
+// default to FRONTEND_URL and the RP ID to the host of the first origin.
+func relyingParty() (*webauthn.WebAuthn, error) {
+	origins := strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",")
+	if os.Getenv("WEBAUTHN_ORIGINS") == "" {
+		origins = []string{frontendURL("")}
+	}
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		u, err := url.Parse(origins[0])
+		if err != nil {
+			return nil, err
+		}
+		rpID = u.Hostname()
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "TradeMinutes",
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		},
+	})
+}
+
+// beginCeremony stores the server half of a ceremony and returns the ID the client sends back.
+func beginCeremony(ctx context.Context, ceremony models.PasskeyCeremony, session *webauthn.SessionData) (string, error) {
+	ceremonyID, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	ceremony.ID = utils.HashToken(ceremonyID)
+	ceremony.Challenge = session.Challenge
+	ceremony.UserVerification = string(session.UserVerification)
+	ceremony.CreatedAt = now.Unix()
+	ceremony.ExpiresAt = now.Add(passkeyCeremonyTTL).Unix()
+	if _, err := config.GetDB().Collection("webauthn_sessions").InsertOne(ctx, ceremony); err != nil {
+		return "", err
+	}
+	return ceremonyID, nil
+}
+
+// consumeCeremony deletes and returns a pending ceremony, so each challenge is answered once.
+func consumeCeremony(ctx context.Context, ceremonyID, purpose string) (models.PasskeyCeremony, webauthn.SessionData, error) {
+	var ceremony models.PasskeyCeremony
+	err := config.GetDB().Collection("webauthn_sessions").FindOneAndDelete(ctx, bson.M{
+		"_id":     utils.HashToken(ceremonyID),
+		"purpose": purpose,
+	}).Decode(&ceremony)
+	if err != nil || ceremony.ExpiresAt < time.Now().Unix() {
+		return ceremony, webauthn.SessionData{}, errCeremonyInvalid
+	}
+
+	session := webauthn.SessionData{
+		Challenge:        ceremony.Challenge,
+		UserVerification: protocol.UserVerificationRequirement(ceremony.UserVerification),
+	}
+	if !ceremony.UserID.IsZero() {
+		session.UserID = ceremony.UserID[:]
+	}
+	return ceremony, session, nil
+}
+
+func writeCeremony(w http.ResponseWriter, ceremonyID string, options interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ceremonyId": ceremonyID,
+		"options":    options,
+	})
+}
+
+// passkeyFinishRequest is the body of every finish step: the ceremony ID from the begin
+// step and the PublicKeyCredential returned by navigator.credentials.
+type passkeyFinishRequest struct {
+	CeremonyID string          `json:"ceremonyId"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+func decodeFinishRequest(w http.ResponseWriter, r *http.Request) (passkeyFinishRequest, bool) {
+	var req passkeyFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CeremonyID == "" || len(req.Credential) == 0 {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.Name) > 100 {
+		httpx.Error(w, "Name must be at most 100 characters", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// createCredential verifies an attestation against the ceremony it answers.
+func createCredential(user passkeyUser, session webauthn.SessionData, raw json.RawMessage) (*webauthn.Credential, error) {
+	rp, err := relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	return rp.CreateCredential(user, session, parsed)
+}
+
+// BeginPasskeyRegistrationHandler starts adding a passkey to the authenticated account.
+func BeginPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if len(user.Passkeys) >= maxPasskeysPerUser {
+		httpx.Error(w, "Too many passkeys, remove one first", http.StatusConflict)
+		return
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		log.Printf("WebAuthn configuration error: err=%v", err)
+		httpx.Error(w, "Passkeys are not configured", http.StatusInternalServerError)
+		return
+	}
+
+	pu := passkeyUser{user}
+	exclude := make([]protocol.CredentialDescriptor, 0, len(user.Passkeys))
+	for _, cred := range pu.WebAuthnCredentials() {
+		exclude = append(exclude, cred.Descriptor())
+	}
+	creation, session, err := rp.BeginRegistration(pu, webauthn.WithExclusions(exclude))
+	if err != nil {
+		httpx.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+
+	ceremonyID, err := beginCeremony(ctx, models.PasskeyCeremony{Purpose: models.CeremonyRegister, UserID: user.ID}, session)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeCeremony(w, ceremonyID, creation)
+}
+
+// FinishPasskeyRegistrationHandler verifies the authenticator's attestation and stores the passkey.
+func FinishPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeFinishRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	ceremony, session, err := consumeCeremony(ctx, req.CeremonyID, models.CeremonyRegister)
+	if err != nil || ceremony.UserID != user.ID {
+		httpx.Error(w, "Invalid or expired passkey request", http.StatusBadRequest)
+		return
+	}
+
+	cred, err := createCredential(passkeyUser{user}, session, req.Credential)
+	if err != nil {
+		log.Printf("Passkey registration rejected: err=%v", err)
+		httpx.Error(w, "Passkey could not be verified", http.StatusBadRequest)
+		return
+	}
+
+	passkey := newPasskey(cred, req.Name)
+	collection := config.GetDB().Collection("MyClusterCol")
+	if n, err := collection.CountDocuments(ctx, bson.M{"passkeys.id": passkey.ID}); err != nil || n > 0 {
+		httpx.Error(w, "This passkey is already registered", http.StatusConflict)
+		return
+	}
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "$expr": bson.M{"$lt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$passkeys", bson.A{}}}}, maxPasskeysPerUser}}},
+		bson.M{"$push": bson.M{"passkeys": passkey}},
+	)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		httpx.Error(w, "Too many passkeys, remove one first", http.StatusConflict)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventPasskeyAdded, UserID: user.ID, Email: user.Email, Detail: passkey.Name})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(passkey)
+}
+
+// BeginPasskeySignupHandler starts creating an account that has a passkey and no password.
+func BeginPasskeySignupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email      string `json:"email"`
+		Name       string `json:"name"`
+		InviteCode string `json:"inviteCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := config.GetDB().Collection("MyClusterCol").CountDocuments(ctx, bson.M{"email": req.Email})
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		httpx.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+	if req.InviteCode != "" {
+		if _, err := resolveInviteCode(ctx, req.InviteCode); err != nil {
+			httpx.Error(w, "Invalid invite code", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		log.Printf("WebAuthn configuration error: err=%v", err)
+		httpx.Error(w, "Passkeys are not configured", http.StatusInternalServerError)
+		return
+	}
+
+	// The account's ID is chosen now, since it becomes the passkey's user handle
+	pending := models.User{ID: primitive.NewObjectID(), Email: req.Email, Name: req.Name}
+	creation, session, err := rp.BeginRegistration(passkeyUser{pending})
+	if err != nil {
+		httpx.Error(w, "Failed to start passkey registration", http.StatusInternalServerError)
+		return
+	}
+
+	ceremonyID, err := beginCeremony(ctx, models.PasskeyCeremony{
+		Purpose:    models.CeremonySignup,
+		UserID:     pending.ID,
+		Email:      pending.Email,
+		Name:       pending.Name,
+		InviteCode: req.InviteCode,
+	}, session)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeCeremony(w, ceremonyID, creation)
+}
+
+// FinishPasskeySignupHandler verifies the new passkey and creates the passwordless account.
+// Like password registration, the email address still has to be verified.
+func FinishPasskeySignupHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeFinishRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	ceremony, session, err := consumeCeremony(ctx, req.CeremonyID, models.CeremonySignup)
+	if err != nil {
+		httpx.Error(w, "Invalid or expired passkey request", http.StatusBadRequest)
+		return
+	}
+
+	user := models.User{
+		ID:                 ceremony.UserID,
+		Email:              ceremony.Email,
+		Name:               ceremony.Name,
+		Role:               authn.RoleMember,
+		EmailVerified:      false,
+		VerificationSentAt: time.Now().Unix(),
+	}
+	cred, err := createCredential(passkeyUser{user}, session, req.Credential)
+	if err != nil {
+		log.Printf("Passkey signup rejected: err=%v", err)
+		httpx.Error(w, "Passkey could not be verified", http.StatusBadRequest)
+		return
+	}
+	user.Passkeys = []models.Passkey{newPasskey(cred, req.Name)}
+
+	var referrer models.User
+	if ceremony.InviteCode != "" {
+		if referrer, err = resolveInviteCode(ctx, ceremony.InviteCode); err != nil {
+			httpx.Error(w, "Invalid invite code", http.StatusBadRequest)
+			return
+		}
+		user.ReferredBy = referrer.ID
+	}
+
+	collection := config.GetDB().Collection("MyClusterCol")
+	count, err := collection.CountDocuments(ctx, bson.M{"$or": []bson.M{
+		{"email": user.Email},
+		{"passkeys.id": user.Passkeys[0].ID},
+	}})
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		httpx.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+	if err := insertUser(ctx, &user); err != nil {
+		httpx.Error(w, "User creation failed", http.StatusInternalServerError)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventRegister, UserID: user.ID, Email: user.Email, Method: "passkey"})
+
+	if !referrer.ID.IsZero() {
+		if err := recordReferral(ctx, referrer, user.ID); err != nil {
+			log.Printf("Failed to record referral: err=%v", err)
+		}
+	}
+
+	if err := sendVerificationEmail(ctx, user.Email); err != nil {
+		log.Printf("Failed to send verification email: err=%v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully, please check your email to verify your account"})
+}
+
+// BeginPasskeyLoginHandler starts a discoverable login: the browser offers every passkey
+// it holds for this site, so no email is needed and none is revealed.
+func BeginPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	rp, err := relyingParty()
+	if err != nil {
+		log.Printf("WebAuthn configuration error: err=%v", err)
+		httpx.Error(w, "Passkeys are not configured", http.StatusInternalServerError)
+		return
+	}
+
+	assertion, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		httpx.Error(w, "Failed to start passkey login", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ceremonyID, err := beginCeremony(ctx, models.PasskeyCeremony{Purpose: models.CeremonyLogin}, session)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeCeremony(w, ceremonyID, assertion)
+}
+
+// FinishPasskeyLoginHandler verifies the assertion and issues a session. The passkey is
+// user-verified (PIN or biometric), so it also satisfies two-factor authentication.
+func FinishPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeFinishRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ip := utils.ClientIP(r)
+	if checkLocked(ctx, w, map[*lockout.Limiter]string{ipLimiter: ip}) {
+		return
+	}
+
+	_, session, err := consumeCeremony(ctx, req.CeremonyID, models.CeremonyLogin)
+	if err != nil {
+		httpx.Error(w, "Invalid or expired passkey request", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	rejectLogin := func(detail string) {
+		if err := ipLimiter.Fail(ctx, ip, time.Now()); err != nil {
+			log.Printf("Failed to record login failure: err=%v", err)
+		}
+		recordEvent(ctx, r, models.AuthEvent{Type: models.EventLoginFailed, UserID: user.ID, Email: user.Email, Method: "passkey", Detail: detail})
+		httpx.Error(w, "Passkey not recognised", http.StatusUnauthorized)
+	}
+
+	rp, err := relyingParty()
+	if err != nil {
+		httpx.Error(w, "Passkeys are not configured", http.StatusInternalServerError)
+		return
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		rejectLogin("malformed assertion")
+		return
+	}
+	cred, err := rp.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		if len(userHandle) != len(primitive.ObjectID{}) {
+			return nil, errors.New("unknown user handle")
+		}
+		var id primitive.ObjectID
+		copy(id[:], userHandle)
+		if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+			return nil, err
+		}
+		return passkeyUser{user}, nil
+	}, session, parsed)
+	if err != nil {
+		log.Printf("Passkey login rejected: err=%v", err)
+		rejectLogin("invalid assertion")
+		return
+	}
+
+	// A signature counter that goes backwards means the key may have been cloned
+	credID := base64.RawURLEncoding.EncodeToString(cred.ID)
+	set := bson.M{"passkeys.$.lastUsedAt": time.Now().Unix(), "passkeys.$.backupState": cred.Flags.BackupState}
+	if cred.Authenticator.CloneWarning {
+		set["passkeys.$.cloneWarning"] = true
+	} else {
+		set["passkeys.$.signCount"] = cred.Authenticator.SignCount
+	}
+	if _, err := config.GetDB().Collection("MyClusterCol").UpdateOne(ctx,
+		bson.M{"_id": user.ID, "passkeys.id": credID}, bson.M{"$set": set}); err != nil {
+		log.Printf("Failed to update passkey: err=%v", err)
+	}
+	if cred.Authenticator.CloneWarning {
+		rejectLogin("signature counter did not increase")
+		return
+	}
+
+	clearFailures(ctx, user.Email)
+	issueSession(ctx, w, r, user, "passkey")
+}
+
+// ListPasskeysHandler returns the authenticated user's passkeys.
+func ListPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	passkeys := user.Passkeys
+	if passkeys == nil {
+		passkeys = []models.Passkey{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(passkeys)
+}
+
+// DeletePasskeyHandler removes one of the authenticated user's passkeys. The last passkey
+// of an account without a password or linked provider cannot be removed.
+func DeletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	credID := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var name string
+	for _, p := range user.Passkeys {
+		if p.ID == credID {
+			name = p.Name
+		}
+	}
+	if name == "" {
+		httpx.Error(w, "Passkey not found", http.StatusNotFound)
+		return
+	}
+	if len(user.Passkeys) == 1 && user.Password == "" && len(user.Identities) == 0 {
+		httpx.Error(w, "Set a password or add another passkey before removing your last one", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := config.GetDB().Collection("MyClusterCol").UpdateByID(ctx, user.ID,
+		bson.M{"$pull": bson.M{"passkeys": bson.M{"id": credID}}}); err != nil {
+		httpx.Error(w, "Failed to remove passkey", http.StatusInternalServerError)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventPasskeyRemoved, UserID: user.ID, Email: user.Email, Detail: name})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Passkey removed"})
+}
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"trademinutes-auth/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testOrigin = "https://app.example"
+
+// softAuthenticator is a platform authenticator in software: one P-256 credential that
+// answers registration and login ceremonies the way a browser would relay them.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+	// flags are added to user presence on every response; user verification by default
+	flags byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credentialID: id, flags: 0x04}
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func (a *softAuthenticator) clientData(t *testing.T, typ, challenge, origin string) []byte {
+	data, err := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// authData builds authenticator data for the RP, with the attested credential when
+// attested is set.
+func (a *softAuthenticator) authData(t *testing.T, rpID string, attested bool) []byte {
+	rpHash := sha256.Sum256([]byte(rpID))
+	flags := 0x01 | a.flags
+	if attested {
+		flags |= 0x40
+	}
+	data := append(rpHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1, // P-256
+		XCoord:        a.key.X.FillBytes(make([]byte, 32)),
+		YCoord:        a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	return append(data, coseKey...)
+}
+
+// register answers a registration ceremony with a "none" attestation.
+func (a *softAuthenticator) register(t *testing.T, challenge, origin string) json.RawMessage {
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(t, "app.example", true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(map[string]interface{}{
+		"id":    b64(a.credentialID),
+		"rawId": b64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(a.clientData(t, "webauthn.create", challenge, origin)),
+			"attestationObject": b64(attestation),
+		},
+	})
+	return raw
+}
+
+// login answers a login ceremony as the credential of userHandle.
+func (a *softAuthenticator) login(t *testing.T, challenge, origin string, userHandle []byte) json.RawMessage {
+	a.signCount++
+	authData := a.authData(t, "app.example", false)
+	clientData := a.clientData(t, "webauthn.get", challenge, origin)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(map[string]interface{}{
+		"id":    b64(a.credentialID),
+		"rawId": b64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(userHandle),
+		},
+	})
+	return raw
+}
+
+func testRelyingParty(t *testing.T) *webauthn.WebAuthn {
+	t.Setenv("WEBAUTHN_ORIGINS", testOrigin)
+	t.Setenv("WEBAUTHN_RP_ID", "")
+	rp, err := relyingParty()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+// registerPasskey runs a registration ceremony and stores the passkey on user.
+func registerPasskey(t *testing.T, rp *webauthn.WebAuthn, user *models.User, a *softAuthenticator) {
+	t.Helper()
+	_, session, err := rp.BeginRegistration(passkeyUser{*user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := createCredential(passkeyUser{*user}, *session, a.register(t, session.Challenge, testOrigin))
+	if err != nil {
+		t.Fatalf("registration rejected: %v", err)
+	}
+	user.Passkeys = append(user.Passkeys, newPasskey(cred, ""))
+}
+
+// loginWith runs a discoverable login ceremony against the stored passkeys of user.
+func loginWith(t *testing.T, rp *webauthn.WebAuthn, user models.User, respond func(challenge string) json.RawMessage) (*webauthn.Credential, error) {
+	t.Helper()
+	_, session, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(respond(session.Challenge)))
+	if err != nil {
+		return nil, err
+	}
+	return rp.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		if string(userHandle) != string(user.ID[:]) {
+			t.Fatalf("user handle %x, want %x", userHandle, user.ID[:])
+		}
+		return passkeyUser{user}, nil
+	}, *session, parsed)
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	rp := testRelyingParty(t)
+	user := models.User{ID: primitive.NewObjectID(), Email: "a@example.com"}
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, rp, &user, a)
+
+	stored := user.Passkeys[0]
+	if stored.ID != b64(a.credentialID) || stored.Name != "Passkey" || len(stored.PublicKey) == 0 {
+		t.Fatalf("stored passkey %+v", stored)
+	}
+
+	cred, err := loginWith(t, rp, user, func(challenge string) json.RawMessage {
+		return a.login(t, challenge, testOrigin, user.ID[:])
+	})
+	if err != nil {
+		t.Fatalf("login rejected: %v", err)
+	}
+	if cred.Authenticator.CloneWarning || cred.Authenticator.SignCount != 1 {
+		t.Fatalf("sign count %d, clone warning %v", cred.Authenticator.SignCount, cred.Authenticator.CloneWarning)
+	}
+}
+
+func TestPasskeyLoginRejected(t *testing.T) {
+	rp := testRelyingParty(t)
+	user := models.User{ID: primitive.NewObjectID(), Email: "a@example.com"}
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, rp, &user, a)
+
+	tests := []struct {
+		name    string
+		respond func(challenge string) json.RawMessage
+	}{
+		{"other origin", func(challenge string) json.RawMessage {
+			return a.login(t, challenge, "https://evil.example", user.ID[:])
+		}},
+		{"replayed challenge", func(string) json.RawMessage {
+			return a.login(t, b64([]byte("an earlier challenge, 32 bytes..")), testOrigin, user.ID[:])
+		}},
+		{"unknown key", func(challenge string) json.RawMessage {
+			other := newSoftAuthenticator(t)
+			other.credentialID = a.credentialID
+			return other.login(t, challenge, testOrigin, user.ID[:])
+		}},
+		{"without user verification", func(challenge string) json.RawMessage {
+			a.flags = 0
+			defer func() { a.flags = 0x04 }()
+			return a.login(t, challenge, testOrigin, user.ID[:])
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loginWith(t, rp, user, tt.respond); err == nil {
+				t.Fatal("login accepted")
+			}
+		})
+	}
+}
+
+func TestPasskeyCloneWarning(t *testing.T) {
+	rp := testRelyingParty(t)
+	user := models.User{ID: primitive.NewObjectID(), Email: "a@example.com"}
+	a := newSoftAuthenticator(t)
+	registerPasskey(t, rp, &user, a)
+	user.Passkeys[0].SignCount = 5
+
+	// A counter below the stored one means another copy of the key has been used
+	cred, err := loginWith(t, rp, user, func(challenge string) json.RawMessage {
+		return a.login(t, challenge, testOrigin, user.ID[:])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cred.Authenticator.CloneWarning {
+		t.Fatal("no clone warning for a signature counter that went backwards")
+	}
+}
+
+func TestPasskeyRegistrationRejected(t *testing.T) {
+	rp := testRelyingParty(t)
+	user := passkeyUser{models.User{ID: primitive.NewObjectID(), Email: "a@example.com"}}
+	a := newSoftAuthenticator(t)
+
+	_, session, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createCredential(user, *session, a.register(t, session.Challenge, "https://evil.example")); err == nil {
+		t.Fatal("registration from another origin accepted")
+	}
+	other := passkeyUser{models.User{ID: primitive.NewObjectID()}}
+	if _, err := createCredential(other, *session, a.register(t, session.Challenge, testOrigin)); err == nil {
+		t.Fatal("registration for another user's ceremony accepted")
+	}
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errInvalidInviteCode = errors.New("invalid invite code")
+
+// resolveInviteCode returns the owner of an invite code. Codes are case-insensitive.
+func resolveInviteCode(ctx context.Context, code string) (models.User, error) {
+	var referrer models.User
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return referrer, errInvalidInviteCode
+	}
+	err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"inviteCode": code}).Decode(&referrer)
+	if err == mongo.ErrNoDocuments {
+		return referrer, errInvalidInviteCode
+	}
+	return referrer, err
+}
+
+// recordReferral adds the referrer -> referee edge to the referral graph. The bonus is
+// granted later by task-core, when the referee completes their first booking.
+func recordReferral(ctx context.Context, referrer models.User, refereeID primitive.ObjectID) error {
+	_, err := config.GetDB().Collection("referrals").InsertOne(ctx, models.Referral{
+		ReferrerID: referrer.ID,
+		RefereeID:  refereeID,
+		InviteCode: referrer.InviteCode,
+		Status:     models.ReferralPending,
+		CreatedAt:  time.Now().Unix(),
+	})
+	return err
+}
+
+// EnsureUserIndexes creates the index that keeps invite codes unique, so each code
+// resolves to one referrer.
+func EnsureUserIndexes(ctx context.Context) error {
+	_, err := config.GetDB().Collection("MyClusterCol").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "inviteCode", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"inviteCode": bson.M{"$exists": true}}),
+	})
+	return err
+}
+
+// duplicateInviteCode reports whether a write failed because the invite code was taken.
+func duplicateInviteCode(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "inviteCode")
+}
+
+// insertUser inserts a new user with a freshly generated invite code, setting the user's
+// ID if it has none. Invite codes are never taken from the client.
+func insertUser(ctx context.Context, user *models.User) error {
+	collection := config.GetDB().Collection("MyClusterCol")
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := utils.GenerateInviteCode()
+		if err != nil {
+			return err
+		}
+		user.InviteCode = code
+		res, err := collection.InsertOne(ctx, user)
+		if duplicateInviteCode(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		user.ID = res.InsertedID.(primitive.ObjectID)
+		return nil
+	}
+	return errors.New("could not generate a unique invite code")
+}
+
+// ensureInviteCode returns the user's invite code, generating one for users created
+// before codes were assigned at signup.
+func ensureInviteCode(ctx context.Context, user models.User) (string, error) {
+	if user.InviteCode != "" {
+		return user.InviteCode, nil
+	}
+
+	collection := config.GetDB().Collection("MyClusterCol")
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := utils.GenerateInviteCode()
+		if err != nil {
+			return "", err
+		}
+
+		// Only set the code if a concurrent request has not already done so
+		var updated models.User
+		err = collection.FindOneAndUpdate(ctx,
+			bson.M{"_id": user.ID, "inviteCode": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"inviteCode": code}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if duplicateInviteCode(err) {
+			continue
+		}
+		if err == mongo.ErrNoDocuments {
+			err = collection.FindOne(ctx, bson.M{"_id": user.ID}).Decode(&updated)
+		}
+		if err != nil {
+			return "", err
+		}
+		return updated.InviteCode, nil
+	}
+	return "", errors.New("could not generate a unique invite code")
+}
+
+// GetReferralsHandler returns the authenticated user's invite code and link, and the
+// people who signed up with it.
+func GetReferralsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	code, err := ensureInviteCode(ctx, user)
+	if err != nil {
+		httpx.Error(w, "Failed to create invite code", http.StatusInternalServerError)
+		return
+	}
+
+	referrals := []models.Referral{}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := config.GetDB().Collection("referrals").Find(ctx, bson.M{"referrerId": user.ID}, opts)
+	if err == nil {
+		err = cursor.All(ctx, &referrals)
+	}
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Only the referee's name is shown, never their email
+	names := map[primitive.ObjectID]string{}
+	ids := make([]primitive.ObjectID, len(referrals))
+	for i, ref := range referrals {
+		ids[i] = ref.RefereeID
+	}
+	var referees []models.User
+	cursor, err = config.GetDB().Collection("MyClusterCol").Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"name": 1}))
+	if err == nil && cursor.All(ctx, &referees) == nil {
+		for _, u := range referees {
+			names[u.ID] = u.Name
+		}
+	}
+
+	entries := make([]map[string]interface{}, len(referrals))
+	earned := 0
+	for i, ref := range referrals {
+		entries[i] = map[string]interface{}{
+			"name":       names[ref.RefereeID],
+			"status":     ref.Status,
+			"bonus":      ref.Bonus,
+			"createdAt":  ref.CreatedAt,
+			"rewardedAt": ref.RewardedAt,
+		}
+		earned += ref.Bonus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"inviteCode":    code,
+		"inviteLink":    frontendURL("/register?invite=" + code),
+		"referrals":     entries,
+		"creditsEarned": earned,
+	})
+}
+
+// ListReferralsHandler returns edges of the referral graph, newest first, optionally
+// limited to those involving ?userId= as referrer or referee. Admin only.
+func ListReferralsHandler(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if idHex := r.URL.Query().Get("userId"); idHex != "" {
+		userID, err := primitive.ObjectIDFromHex(idHex)
+		if err != nil {
+			httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		filter["$or"] = []bson.M{{"referrerId": userID}, {"refereeId": userID}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(500)
+	cursor, err := config.GetDB().Collection("referrals").Find(ctx, filter, opts)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	referrals := []models.Referral{}
+	if err := cursor.All(ctx, &referrals); err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(referrals)
+}
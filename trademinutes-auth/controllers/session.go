@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// createSession persists a new session for user and returns its access and refresh tokens.
+func createSession(ctx context.Context, r *http.Request, user models.User) (string, string, error) {
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:               primitive.NewObjectID(),
+		UserID:           user.ID,
+		Email:            user.Email,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        r.UserAgent(),
+		IP:               utils.ClientIP(r),
+		CreatedAt:        now.Unix(),
+		LastUsedAt:       now.Unix(),
+		ExpiresAt:        now.Add(utils.RefreshTokenTTL).Unix(),
+	}
+	if _, err := config.GetDB().Collection("sessions").InsertOne(ctx, session); err != nil {
+		return "", "", err
+	}
+
+	token, err := utils.GenerateJWT(user.Email, session.ID.Hex(), userRole(user))
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// issueSession creates a new session for user, records the login made with method
+// and writes the access/refresh token pair.
+func issueSession(ctx context.Context, w http.ResponseWriter, r *http.Request, user models.User, method string) {
+	token, refreshToken, err := createSession(ctx, r, user)
+	if err != nil {
+		httpx.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventLogin, UserID: user.ID, Email: user.Email, Method: method})
+
+	writeTokenPair(w, token, refreshToken)
+}
+
+func writeTokenPair(w http.ResponseWriter, token, refreshToken string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokenPair(token, refreshToken))
+}
+
+func tokenPair(token, refreshToken string) map[string]interface{} {
+	return map[string]interface{}{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"expiresIn":    int(utils.AccessTokenTTL.Seconds()),
+	}
+}
+
+// userRole returns the user's role, defaulting accounts created before roles existed to member.
+func userRole(user models.User) string {
+	if user.Role == "" {
+		return authn.RoleMember
+	}
+	return user.Role
+}
+
+// revokeUserSessions revokes every active session of a user, e.g. on logout or password reset.
+func revokeUserSessions(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := config.GetDB().Collection("sessions").UpdateMany(ctx,
+		bson.M{"userId": userID, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true, "revokedAt": time.Now().Unix()}},
+	)
+	return err
+}
+
+// currentUser loads the user behind the JWT in the request context.
+func currentUser(ctx context.Context, r *http.Request) (models.User, error) {
+	var user models.User
+	err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"email": authn.Email(r)}).Decode(&user)
+	return user, err
+}
+
+// RefreshHandler exchanges a refresh token for a new access token and rotates the refresh token.
+// Presenting an already-rotated refresh token is treated as theft and revokes the session.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	sessions := config.GetDB().Collection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := utils.HashToken(req.RefreshToken)
+	var session models.Session
+	err := sessions.FindOne(ctx, bson.M{"refreshTokenHash": hash}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		if sessions.FindOne(ctx, bson.M{"previousTokenHash": hash}).Decode(&session) == nil {
+			sessions.UpdateByID(ctx, session.ID, bson.M{"$set": bson.M{"revoked": true, "revokedAt": time.Now().Unix()}})
+			recordEvent(ctx, r, models.AuthEvent{Type: models.EventRefreshTokenReuse, UserID: session.UserID, Email: session.Email, Detail: "session " + session.ID.Hex()})
+		}
+		httpx.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	if session.Revoked || session.ExpiresAt < now.Unix() {
+		httpx.Error(w, "Session expired", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"_id": session.UserID}).Decode(&user); err != nil {
+		httpx.Error(w, "Session expired", http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		httpx.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	// Match on the old hash so two concurrent refreshes cannot both succeed.
+	res, err := sessions.UpdateOne(ctx,
+		bson.M{"_id": session.ID, "refreshTokenHash": hash, "revoked": false},
+		bson.M{"$set": bson.M{
+			"refreshTokenHash":  utils.HashToken(refreshToken),
+			"previousTokenHash": hash,
+			"lastUsedAt":        now.Unix(),
+			"expiresAt":         now.Add(utils.RefreshTokenTTL).Unix(),
+			"ip":                utils.ClientIP(r),
+			"userAgent":         r.UserAgent(),
+		}},
+	)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		httpx.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := utils.GenerateJWT(user.Email, session.ID.Hex(), userRole(user))
+	if err != nil {
+		httpx.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenPair(w, token, refreshToken)
+}
+
+// LogoutHandler revokes every session of the authenticated user.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := revokeUserSessions(ctx, user.ID); err != nil {
+		httpx.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventLogout, UserID: user.ID, Email: user.Email})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out from all devices"})
+}
+
+// ListSessionsHandler returns the authenticated user's active sessions.
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	filter := bson.M{
+		"userId":    user.ID,
+		"revoked":   false,
+		"expiresAt": bson.M{"$gt": time.Now().Unix()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "lastUsedAt", Value: -1}})
+	cursor, err := config.GetDB().Collection("sessions").Find(ctx, filter, opts)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	principal, _ := authn.PrincipalFrom(r.Context())
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == principal.SessionID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSessionHandler revokes a single session belonging to the authenticated user.
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	res, err := config.GetDB().Collection("sessions").UpdateOne(ctx,
+		bson.M{"_id": sessionID, "userId": user.ID, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true, "revokedAt": time.Now().Unix()}},
+	)
+	if err != nil {
+		httpx.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if res.MatchedCount == 0 {
+		httpx.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	recordEvent(ctx, r, models.AuthEvent{Type: models.EventSessionRevoked, UserID: user.ID, Email: user.Email, Detail: "session " + sessionID.Hex()})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
+
+// JWKSHandler publishes the public signing keys so other services can verify access tokens.
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(utils.JWKS())
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/lockout"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const recoveryCodeCount = 10
+
+// EnrollTwoFactorHandler generates a pending TOTP secret for the authenticated user.
+// 2FA is only switched on once a code from the authenticator is confirmed.
+func EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TwoFactorEnabled {
+		httpx.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		httpx.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = config.GetDB().Collection("MyClusterCol").UpdateByID(ctx, user.ID,
+		bson.M{"$set": bson.M{"pendingTotpSecret": secret}})
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":     secret,
+		"otpauthUri": utils.TOTPURI(secret, user.Email),
+	})
+}
+
+// ConfirmTwoFactorHandler enables 2FA once the user proves their authenticator works,
+// and returns a fresh set of recovery codes. The codes are only ever shown here.
+func ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.PendingTOTPSecret == "" {
+		httpx.Error(w, "No two-factor enrolment in progress", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(user.PendingTOTPSecret, req.Code, time.Now())
+	if !ok {
+		httpx.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		httpx.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = config.GetDB().Collection("MyClusterCol").UpdateByID(ctx, user.ID, bson.M{
+		"$set": bson.M{
+			"twoFactorEnabled": true,
+			"totpSecret":       user.PendingTOTPSecret,
+			"totpLastStep":     step,
+			"recoveryCodes":    hashes,
+		},
+		"$unset": bson.M{"pendingTotpSecret": ""},
+	})
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTwoFactorHandler turns 2FA off. A current authenticator code is required,
+// so a stolen access token alone cannot remove the second factor.
+func DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !user.TwoFactorEnabled {
+		httpx.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if ok, err := consumeTOTP(ctx, user, req.Code); err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	} else if !ok {
+		httpx.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	_, err = config.GetDB().Collection("MyClusterCol").UpdateByID(ctx, user.ID, bson.M{
+		"$set":   bson.M{"twoFactorEnabled": false},
+		"$unset": bson.M{"totpSecret": "", "totpLastStep": "", "recoveryCodes": "", "pendingTotpSecret": ""},
+	})
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// LoginTwoFactorHandler is the second login step: it exchanges the challenge token from
+// LoginHandler plus a TOTP or recovery code for a real session.
+func LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := utils.ParseTwoFactorChallenge(req.ChallengeToken)
+	if err != nil {
+		httpx.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(sub)
+	if err != nil {
+		httpx.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		httpx.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+	if !user.TwoFactorEnabled {
+		httpx.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	ip := utils.ClientIP(r)
+	if checkLocked(ctx, w, map[*lockout.Limiter]string{accountLimiter: accountKey(user.Email), ipLimiter: ip}) {
+		return
+	}
+
+	var ok bool
+	method := "totp"
+	if req.RecoveryCode != "" {
+		method = "recovery_code"
+		ok, err = consumeRecoveryCode(ctx, user, req.RecoveryCode)
+	} else {
+		ok, err = consumeTOTP(ctx, user, req.Code)
+	}
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		recordFailure(ctx, user.Email, ip)
+		recordEvent(ctx, r, models.AuthEvent{Type: models.EventLoginFailed, UserID: user.ID, Email: user.Email, Method: method, Detail: "invalid two-factor code"})
+		httpx.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	clearFailures(ctx, user.Email)
+	issueSession(ctx, w, r, user, method)
+}
+
+// consumeTOTP validates a code and records its time step, so each code works only once.
+func consumeTOTP(ctx context.Context, user models.User, code string) (bool, error) {
+	step, ok := checkTOTP(user, code)
+	if !ok {
+		return false, nil
+	}
+	return markTOTPUsed(ctx, user, step)
+}
+
+// checkTOTP validates a code without using it up, returning its time step for markTOTPUsed.
+// Codes from a step that was already used are rejected.
+func checkTOTP(user models.User, code string) (int64, bool) {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return 0, false
+	}
+	return step, true
+}
+
+// markTOTPUsed records step as used. It reports false if that step, or a later one, was
+// used in the meantime.
+func markTOTPUsed(ctx context.Context, user models.User, step int64) (bool, error) {
+	res, err := config.GetDB().Collection("MyClusterCol").UpdateOne(ctx,
+		bson.M{"_id": user.ID, "totpLastStep": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"totpLastStep": step}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// consumeRecoveryCode removes a matching recovery code from the user; each code works once.
+func consumeRecoveryCode(ctx context.Context, user models.User, code string) (bool, error) {
+	hash := utils.HashToken(strings.ToLower(strings.TrimSpace(code)))
+	res, err := config.GetDB().Collection("MyClusterCol").UpdateOne(ctx,
+		bson.M{"_id": user.ID, "recoveryCodes": hash},
+		bson.M{"$pull": bson.M{"recoveryCodes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = utils.HashToken(c)
+	}
+	return codes, hashes, nil
+}
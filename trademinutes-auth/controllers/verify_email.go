@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"trademinutes-auth/config"
+	"trademinutes-auth/mailer"
+	"trademinutes-auth/models"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// verificationResendInterval is the minimum time between two verification emails for one account.
+const verificationResendInterval = 2 * time.Minute
+
+// sendVerificationEmail queues a signed verification link for the given address.
+func sendVerificationEmail(ctx context.Context, email string) error {
+	token, err := utils.GenerateEmailVerificationToken(email)
+	if err != nil {
+		return err
+	}
+
+	verifyURL := frontendURL("/verify-email?token=" + url.QueryEscape(token))
+	return mailer.Enqueue(ctx, email, mailer.TemplateVerifyEmail, map[string]interface{}{"Link": verifyURL})
+}
+
+// VerifyEmailHandler marks the address in a valid verification token as verified.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	email, err := utils.ParseEmailVerificationToken(req.Token)
+	if err != nil {
+		httpx.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := config.GetDB().Collection("MyClusterCol").UpdateOne(ctx,
+		bson.M{"email": email},
+		bson.M{"$set": bson.M{"emailVerified": true}, "$unset": bson.M{"verificationSentAt": ""}},
+	)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if res.MatchedCount == 0 {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified successfully"})
+}
+
+// ResendVerificationHandler sends a new verification link, at most once per verificationResendInterval.
+// The response is the same whether or not the address belongs to an unverified account,
+// and whether or not the request was throttled.
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := config.GetDB().Collection("MyClusterCol")
+	now := time.Now()
+
+	// Claim the send slot atomically so parallel requests cannot bypass the throttle.
+	var user models.User
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"email":         req.Email,
+			"emailVerified": false,
+			"$or": []bson.M{
+				{"verificationSentAt": bson.M{"$exists": false}},
+				{"verificationSentAt": bson.M{"$lt": now.Add(-verificationResendInterval).Unix()}},
+			},
+		},
+		bson.M{"$set": bson.M{"verificationSentAt": now.Unix()}},
+	).Decode(&user)
+	if err == nil {
+		if err := sendVerificationEmail(ctx, user.Email); err != nil {
+			log.Printf("Failed to send verification email: err=%v", err)
+		}
+	} else if err != mongo.ErrNoDocuments {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	// A throttled request is answered like any other, so the reply never tells which
+	// addresses have unverified accounts
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the account exists and is unverified, a verification email has been sent"})
+}
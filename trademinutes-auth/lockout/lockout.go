@@ -0,0 +1,90 @@
+// Package lockout tracks failed attempts per key (an account, an IP) and derives an
+// exponential backoff from them. Counters live behind Store so they can be kept in
+// MongoDB in production and in memory in tests.
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Record is the failure history of one key.
+type Record struct {
+	Key           string `bson:"_id"`
+	Failures      int    `bson:"failures"`
+	LastFailureAt int64  `bson:"lastFailureAt"`
+}
+
+// Store persists failure counters.
+type Store interface {
+	// Get returns the record for key, or a zero record if there is none.
+	Get(ctx context.Context, key string) (Record, error)
+	// Increment records a failure at now and returns the updated record. Failures older
+	// than window are forgotten, so the count restarts from one.
+	Increment(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error)
+	// Reset forgets every failure for key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy describes how quickly a key is locked out.
+type Policy struct {
+	// FreeAttempts is the number of failures allowed before any delay applies.
+	FreeAttempts int
+	// BaseDelay is the lockout after the first failure beyond FreeAttempts; it doubles
+	// with each further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long a key must stay quiet before its failures are forgotten.
+	Window time.Duration
+}
+
+// Delay returns how long a key with the given failure count stays locked after its last failure.
+func (p Policy) Delay(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < over && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Limiter applies a Policy to the counters in a Store.
+type Limiter struct {
+	Store  Store
+	Policy Policy
+	// Prefix namespaces keys so several limiters can share one store.
+	Prefix string
+}
+
+// RetryAfter returns how long key is still locked, or zero if it may try now.
+func (l *Limiter) RetryAfter(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	rec, err := l.Store.Get(ctx, l.Prefix+key)
+	if err != nil {
+		return 0, err
+	}
+	if rec.Failures == 0 || now.Sub(time.Unix(rec.LastFailureAt, 0)) > l.Policy.Window {
+		return 0, nil
+	}
+	until := time.Unix(rec.LastFailureAt, 0).Add(l.Policy.Delay(rec.Failures))
+	if !until.After(now) {
+		return 0, nil
+	}
+	return until.Sub(now), nil
+}
+
+// Fail records a failed attempt for key.
+func (l *Limiter) Fail(ctx context.Context, key string, now time.Time) error {
+	_, err := l.Store.Increment(ctx, l.Prefix+key, now, l.Policy.Window)
+	return err
+}
+
+// Reset clears the failures for key, e.g. after a successful login or an admin unlock.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, l.Prefix+key)
+}
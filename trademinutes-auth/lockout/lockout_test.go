@@ -0,0 +1,96 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 8 * time.Second, Window: time.Hour}
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{20, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := testPolicy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterLocksAfterFreeAttempts(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{Store: NewMemoryStore(), Policy: testPolicy, Prefix: "login:"}
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		if err := l.Fail(ctx, "a@example.com", now); err != nil {
+			t.Fatal(err)
+		}
+		if wait, _ := l.RetryAfter(ctx, "a@example.com", now); wait != 0 {
+			t.Fatalf("locked for %v after %d failures", wait, i+1)
+		}
+	}
+
+	l.Fail(ctx, "a@example.com", now)
+	if wait, _ := l.RetryAfter(ctx, "a@example.com", now); wait != time.Second {
+		t.Fatalf("RetryAfter = %v, want 1s", wait)
+	}
+	if wait, _ := l.RetryAfter(ctx, "a@example.com", now.Add(time.Second)); wait != 0 {
+		t.Fatalf("still locked for %v once the delay has passed", wait)
+	}
+	if wait, _ := l.RetryAfter(ctx, "b@example.com", now); wait != 0 {
+		t.Fatalf("another key is locked for %v", wait)
+	}
+}
+
+func TestLimiterForgetsAfterWindow(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	l := &Limiter{Store: store, Policy: testPolicy}
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 5; i++ {
+		l.Fail(ctx, "k", now)
+	}
+	later := now.Add(testPolicy.Window + time.Second)
+	if wait, _ := l.RetryAfter(ctx, "k", later); wait != 0 {
+		t.Fatalf("locked for %v after the window", wait)
+	}
+	l.Fail(ctx, "k", later)
+	if rec, _ := store.Get(ctx, "k"); rec.Failures != 1 {
+		t.Fatalf("failures = %d after the window, want 1", rec.Failures)
+	}
+}
+
+func TestLimiterReset(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	a := &Limiter{Store: store, Policy: testPolicy, Prefix: "account:"}
+	b := &Limiter{Store: store, Policy: testPolicy, Prefix: "ip:"}
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 5; i++ {
+		a.Fail(ctx, "k", now)
+		b.Fail(ctx, "k", now)
+	}
+	if err := a.Reset(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := a.RetryAfter(ctx, "k", now); wait != 0 {
+		t.Fatalf("locked for %v after a reset", wait)
+	}
+	if wait, _ := b.RetryAfter(ctx, "k", now); wait == 0 {
+		t.Fatal("resetting one prefix cleared another")
+	}
+}
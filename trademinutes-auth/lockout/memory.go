@@ -0,0 +1,46 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in process memory. It is meant for tests and single-instance
+// development; counters are lost on restart and not shared between replicas.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.records[key]
+	if now.Sub(time.Unix(rec.LastFailureAt, 0)) > window {
+		rec.Failures = 0
+	}
+	rec.Key = key
+	rec.Failures++
+	rec.LastFailureAt = now.Unix()
+	s.records[key] = rec
+	return rec, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
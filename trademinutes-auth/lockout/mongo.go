@@ -0,0 +1,59 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"trademinutes-auth/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps counters in a MongoDB collection, one document per key, so every
+// auth replica sees the same counts.
+type MongoStore struct {
+	collection string
+}
+
+func NewMongoStore(collection string) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) coll() *mongo.Collection {
+	return config.GetDB().Collection(s.collection)
+}
+
+func (s *MongoStore) Get(ctx context.Context, key string) (Record, error) {
+	var rec Record
+	err := s.coll().FindOne(ctx, bson.M{"_id": key}).Decode(&rec)
+	if err == mongo.ErrNoDocuments {
+		return Record{Key: key}, nil
+	}
+	return rec, err
+}
+
+// Increment uses a pipeline update so the window check and the increment happen in one
+// atomic operation, even with concurrent failures for the same key.
+func (s *MongoStore) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (Record, error) {
+	cutoff := now.Add(-window).Unix()
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$lastFailureAt", 0}}, cutoff}},
+			1,
+			bson.M{"$add": bson.A{"$failures", 1}},
+		}},
+		"lastFailureAt": now.Unix(),
+	}}}}
+
+	var rec Record
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := s.coll().FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&rec)
+	return rec, err
+}
+
+func (s *MongoStore) Reset(ctx context.Context, key string) error {
+	_, err := s.coll().DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,55 @@
+// Package mailer renders and delivers email. Mail is not sent inline by handlers:
+// they enqueue it in the outbox collection and RunOutbox delivers it through a
+// Mailer backend, retrying with backoff when the backend fails.
+package mailer
+
+import (
+	"context"
+	"os"
+)
+
+// Message is a rendered email ready for delivery.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers a message. Implementations must return an error on failure so the
+// outbox can retry; they must not drop mail silently.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromEnv picks the backend from MAIL_BACKEND: "smtp", "file" (writes .eml files to
+// MAIL_FILE_DIR) or "log". Without MAIL_BACKEND, SMTP is used if SMTP_HOST is set
+// and the log backend otherwise.
+func FromEnv() Mailer {
+	backend := os.Getenv("MAIL_BACKEND")
+	if backend == "" {
+		backend = "log"
+		if os.Getenv("SMTP_HOST") != "" {
+			backend = "smtp"
+		}
+	}
+
+	switch backend {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     os.Getenv("EMAIL_FROM"),
+		}
+	case "file":
+		dir := os.Getenv("MAIL_FILE_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir, From: os.Getenv("EMAIL_FROM")}
+	default:
+		return LogMailer{}
+	}
+}
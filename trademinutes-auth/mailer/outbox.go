@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"trademinutes-auth/config"
+
+	"github.com/ElioCloud/trademinutes-common/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxAttempts  = 8
+	baseBackoff  = 30 * time.Second
+	maxBackoff   = 2 * time.Hour
+	sendingLease = 2 * time.Minute
+	pollInterval = 5 * time.Second
+)
+
+// Enqueue stores an email for delivery by the outbox worker.
+func Enqueue(ctx context.Context, to, template string, data map[string]interface{}) error {
+	return outbox.Enqueue(ctx, config.GetDB().Collection(outbox.Collection), to, template, data)
+}
+
+// RunOutbox delivers queued email through m until ctx is cancelled. Several replicas
+// can run it at once: each email is claimed with a lease before it is sent, and a
+// lease that runs out (e.g. the replica crashed mid-send) makes it claimable again.
+func RunOutbox(ctx context.Context, m Mailer) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for deliverNext(ctx, m) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverNext claims and sends one due email. It returns false when there is nothing to do.
+func deliverNext(ctx context.Context, m Mailer) bool {
+	collection := config.GetDB().Collection(outbox.Collection)
+	now := time.Now()
+
+	claimCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var email outbox.Email
+	err := collection.FindOneAndUpdate(claimCtx,
+		bson.M{"$or": []bson.M{
+			{"status": outbox.StatusPending, "nextAttemptAt": bson.M{"$lte": now.Unix()}},
+			{"status": outbox.StatusSending, "lockedUntil": bson.M{"$lt": now.Unix()}},
+		}},
+		bson.M{
+			"$set": bson.M{"status": outbox.StatusSending, "lockedUntil": now.Add(sendingLease).Unix()},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&email)
+	if err != nil {
+		if err != mongo.ErrNoDocuments && ctx.Err() == nil {
+			log.Printf("Outbox claim failed: err=%v", err)
+		}
+		return false
+	}
+
+	msg, err := Render(email.Template, email.To, email.Data)
+	if err != nil {
+		// A template that doesn't render won't render on retry either
+		markFailed(ctx, email, err, true)
+		return true
+	}
+
+	sendCtx, cancelSend := context.WithTimeout(ctx, time.Minute)
+	defer cancelSend()
+	if err := m.Send(sendCtx, msg); err != nil {
+		markFailed(ctx, email, err, email.Attempts >= maxAttempts)
+		return true
+	}
+
+	updateCtx, cancelUpdate := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelUpdate()
+	if _, err := collection.UpdateByID(updateCtx, email.ID, bson.M{
+		"$set":   bson.M{"status": outbox.StatusSent, "sentAt": time.Now().Unix()},
+		"$unset": bson.M{"lockedUntil": "", "lastError": ""},
+	}); err != nil {
+		log.Printf("Outbox update failed for %s: err=%v", email.ID.Hex(), err)
+	}
+	return true
+}
+
+// markFailed schedules a retry with exponential backoff, or gives up for good.
+func markFailed(ctx context.Context, email outbox.Email, sendErr error, permanent bool) {
+	set := bson.M{"lastError": sendErr.Error()}
+	if permanent {
+		set["status"] = outbox.StatusFailed
+		log.Printf("❌ Giving up on email %s (%s) after %d attempts: %v", email.ID.Hex(), email.Template, email.Attempts, sendErr)
+	} else {
+		set["status"] = outbox.StatusPending
+		set["nextAttemptAt"] = time.Now().Add(backoff(email.Attempts)).Unix()
+		log.Printf("Email %s (%s) failed, attempt %d: %v", email.ID.Hex(), email.Template, email.Attempts, sendErr)
+	}
+
+	updateCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if _, err := config.GetDB().Collection(outbox.Collection).UpdateByID(updateCtx, email.ID, bson.M{
+		"$set":   set,
+		"$unset": bson.M{"lockedUntil": ""},
+	}); err != nil {
+		log.Printf("Outbox update failed for %s: err=%v", email.ID.Hex(), err)
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Every email has a text template, which also defines its "subject", and an HTML
+// template of the same name. HTML output is escaped by html/template, so user
+// content such as task titles is safe to pass as data.
+//
+//go:embed templates/*.txt templates/*.html
+var templateFS embed.FS
+
+// Template names understood by Render and Enqueue.
+const (
+	TemplateVerifyEmail      = "verify_email"
+	TemplatePasswordReset    = "password_reset"
+	TemplatePasswordChanged  = "password_changed"
+	TemplateMagicLink        = "magic_link"
+	TemplateBookingRequested = "booking_requested"
+	TemplateBookingAccepted  = "booking_accepted"
+	TemplateBookingCompleted = "booking_completed"
+	TemplateInstitutionCode  = "institution_code"
+)
+
+// Render builds the message for template name with the given data.
+func Render(name, to string, data map[string]interface{}) (Message, error) {
+	text, err := texttemplate.ParseFS(templateFS, "templates/"+name+".txt")
+	if err != nil {
+		return Message{}, fmt.Errorf("unknown template %q: %w", name, err)
+	}
+	html, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html")
+	if err != nil {
+		return Message{}, fmt.Errorf("unknown template %q: %w", name, err)
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.ExecuteTemplate(&textBody, name+".txt", data); err != nil {
+		return Message{}, err
+	}
+	if err := html.ExecuteTemplate(&htmlBody, "layout.html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(textBody.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
@@ -1,45 +1,55 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/ElioCloud/trademinutes-common/env"
+	"github.com/ElioCloud/trademinutes-common/httpx"
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 
 	"trademinutes-auth/config"
+	"trademinutes-auth/controllers"
+	"trademinutes-auth/mailer"
+	"trademinutes-auth/oauth"
 	"trademinutes-auth/routes"
+	"trademinutes-auth/utils"
 )
-func CORSMiddleware(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-        w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-
-        if r.Method == "OPTIONS" {
-            w.WriteHeader(http.StatusNoContent)
-            return
-        }
-
-        next.ServeHTTP(w, r)
-    })
-}
 
 func main() {
 	// Load .env file
-	if os.Getenv("ENV") != "production" {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println(".env file not found, assuming production environment variables")
-	}
-}
+	env.Load()
+	env.MustRequire("MONGO_URI", "DB_NAME", "JWT_VERIFY_SECRET", "JWT_CHALLENGE_SECRET")
 
 	// Connect to MongoDB
 	config.ConnectDB()
 	fmt.Println("✅ Connected to MongoDB:", config.GetDB().Name())
 
+	// Keep invite codes unique
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := controllers.EnsureUserIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create user indexes: %v", err)
+	}
+	cancel()
+
+	// Load JWT signing keys
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatal("Signing key error:", err)
+	}
+
+	// Promote the configured bootstrap admin, if any
+	controllers.BootstrapAdmin(os.Getenv("BOOTSTRAP_ADMIN_EMAIL"))
+
+	// Deliver queued email in the background
+	go mailer.RunOutbox(context.Background(), mailer.FromEnv())
+
+	// Register configured OAuth providers
+	oauth.LoadFromEnv()
+
 	// Set up router
 	router := mux.NewRouter()
 
@@ -53,12 +63,9 @@ func main() {
 	routes.AuthRoutes(router)
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	port := env.Get("PORT", "8080")
 
 	fmt.Println("🚀 Server running on port", port)
-	log.Fatal(http.ListenAndServe(":"+port, CORSMiddleware(router)))
+	log.Fatal(http.ListenAndServe(":"+port, httpx.CORS(router)))
 
 }
@@ -1,57 +1,45 @@
 package middleware
 
 import (
-	"context"
-	"fmt"
 	"net/http"
-	"os"
-	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
+	"trademinutes-auth/config"
+	"trademinutes-auth/utils"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
 )
 
-type contextKey string
+// sessionAuth accepts access tokens signed by this service. Credentials and account
+// settings are never changed on someone else's behalf, so impersonation tokens can only
+// read here, whatever they allow elsewhere.
+var sessionAuth = &authn.Authenticator{
+	Service:                 "auth",
+	DB:                      config.GetDB,
+	KeyFunc:                 utils.AccessTokenKey,
+	SessionActive:           authn.SessionActive(config.GetDB),
+	BlockImpersonatedWrites: true,
+}
 
-const EmailKey contextKey = "email"
+// apiAuth additionally accepts personal access tokens.
+var apiAuth = &authn.Authenticator{
+	Service:                 "auth",
+	DB:                      config.GetDB,
+	KeyFunc:                 utils.AccessTokenKey,
+	APITokens:               true,
+	SessionActive:           authn.SessionActive(config.GetDB),
+	BlockImpersonatedWrites: true,
+}
 
 func JWTAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		fmt.Println("🛡️ Authorization Header:", authHeader)
-
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			fmt.Println("❌ Missing or invalid Authorization header")
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		fmt.Println("🔐 Token received:", tokenString)
-
-		secret := []byte(os.Getenv("JWT_SECRET"))
-		fmt.Println("🧪 JWT_SECRET in Middleware:", os.Getenv("JWT_SECRET"))
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return secret, nil
-		})
-
-		if err != nil || !token.Valid {
-			fmt.Println("❌ Token validation error:", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || claims["email"] == nil {
-			fmt.Println("❌ Invalid token claims")
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		email := claims["email"].(string)
-		fmt.Println("✅ JWT valid for:", email)
+	return sessionAuth.Middleware(next)
+}
 
-		ctx := context.WithValue(r.Context(), EmailKey, email)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// APITokenMiddleware accepts either a session JWT or a personal access token that
+// holds the read or write scope of resource. Account management routes use
+// JWTAuthMiddleware instead, so a leaked API token can't be used to mint more tokens
+// or change security settings.
+func APITokenMiddleware(resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return apiAuth.Middleware(authn.RequireScope(resource)(next))
+	}
 }
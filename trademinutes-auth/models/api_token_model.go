@@ -0,0 +1,55 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// APITokenPrefix marks personal access tokens so middleware can tell them apart from JWTs.
+const APITokenPrefix = "tm_pat_"
+
+// Scopes a personal access token can be granted. Each service checks the read or
+// write scope of its own resource.
+const (
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+	ScopeCreditsRead   = "credits:read"
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+	ScopeReviewsRead   = "reviews:read"
+	ScopeReviewsWrite  = "reviews:write"
+)
+
+var apiScopes = map[string]bool{
+	ScopeTasksRead:     true,
+	ScopeTasksWrite:    true,
+	ScopeProfileRead:   true,
+	ScopeProfileWrite:  true,
+	ScopeCreditsRead:   true,
+	ScopeMessagesRead:  true,
+	ScopeMessagesWrite: true,
+	ScopeReviewsRead:   true,
+	ScopeReviewsWrite:  true,
+}
+
+// ValidScope reports whether scope can be granted to a token.
+func ValidScope(scope string) bool {
+	return apiScopes[scope]
+}
+
+// APIToken is a named, scoped personal access token for scripts and integrations.
+// Only the SHA-256 hash of the token is stored; the plaintext is shown once on creation.
+type APIToken struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"userId" bson:"userId"`
+	Email      string             `json:"-" bson:"email"`
+	Name       string             `json:"name" bson:"name"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	TokenHash  string             `json:"-" bson:"tokenHash"`
+	Hint       string             `json:"hint" bson:"hint"`
+	CreatedAt  int64              `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  int64              `json:"expiresAt" bson:"expiresAt"`
+	LastUsedAt int64              `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	LastUsedIP string             `json:"lastUsedIp,omitempty" bson:"lastUsedIp,omitempty"`
+	Revoked    bool               `json:"revoked" bson:"revoked"`
+	RevokedAt  int64              `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Authentication event types recorded in the auth_events collection.
+const (
+	EventRegister               = "register"
+	EventLogin                  = "login"
+	EventLoginFailed            = "login_failed"
+	EventOAuthLogin             = "oauth_login"
+	EventPasswordResetRequested = "password_reset_requested"
+	EventPasswordReset          = "password_reset"
+	EventLogout                 = "logout"
+	EventSessionRevoked         = "session_revoked"
+	EventRefreshTokenReuse      = "refresh_token_reuse"
+	EventAPITokenCreated        = "api_token_created"
+	EventAPITokenRevoked        = "api_token_revoked"
+	EventPasskeyAdded           = "passkey_added"
+	EventPasskeyRemoved         = "passkey_removed"
+	EventImpersonationStarted   = "impersonation_started"
+	EventImpersonationEnded     = "impersonation_ended"
+)
+
+// AuthEvent is an audit record of something that happened to an account's credentials.
+// UserID is empty for events about emails that do not belong to an account.
+type AuthEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Type      string             `json:"type" bson:"type"`
+	UserID    primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	Email     string             `json:"email,omitempty" bson:"email,omitempty"`
+	Method    string             `json:"method,omitempty" bson:"method,omitempty"`
+	Detail    string             `json:"detail,omitempty" bson:"detail,omitempty"`
+	IP        string             `json:"ip" bson:"ip"`
+	UserAgent string             `json:"userAgent" bson:"userAgent"`
+	CreatedAt int64              `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Impersonation is an admin acting as another user for support. The impersonation
+// token's sid is the record's ID, so ending the record ends the token everywhere.
+type Impersonation struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	AdminID     primitive.ObjectID `json:"adminId" bson:"adminId"`
+	AdminEmail  string             `json:"adminEmail" bson:"adminEmail"`
+	TargetID    primitive.ObjectID `json:"targetId" bson:"targetId"`
+	TargetEmail string             `json:"targetEmail" bson:"targetEmail"`
+	Reason      string             `json:"reason" bson:"reason"`
+	ReadOnly    bool               `json:"readOnly" bson:"readOnly"`
+	IP          string             `json:"ip" bson:"ip"`
+	UserAgent   string             `json:"userAgent" bson:"userAgent"`
+	CreatedAt   int64              `json:"createdAt" bson:"createdAt"`
+	ExpiresAt   int64              `json:"expiresAt" bson:"expiresAt"`
+	Revoked     bool               `json:"revoked" bson:"revoked"`
+	RevokedAt   int64              `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// ImpersonatedAction is a write made through an impersonation token, recorded by the
+// service that handled it.
+type ImpersonatedAction struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ImpersonationID primitive.ObjectID `json:"impersonationId" bson:"impersonationId"`
+	AdminEmail      string             `json:"adminEmail" bson:"adminEmail"`
+	Email           string             `json:"email" bson:"email"`
+	Service         string             `json:"service" bson:"service"`
+	Method          string             `json:"method" bson:"method"`
+	Path            string             `json:"path" bson:"path"`
+	CreatedAt       int64              `json:"createdAt" bson:"createdAt"`
+}
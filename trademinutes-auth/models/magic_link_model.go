@@ -0,0 +1,17 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// MagicLink is an emailed passwordless login link, keyed by the hash of its token.
+// It can be exchanged once, and requesting a new link invalidates older ones.
+type MagicLink struct {
+	ID          string             `bson:"_id"`
+	UserID      primitive.ObjectID `bson:"userId"`
+	Email       string             `bson:"email"`
+	IP          string             `bson:"ip"`
+	CreatedAt   int64              `bson:"createdAt"`
+	ExpiresAt   int64              `bson:"expiresAt"`
+	Used        bool               `bson:"used"`
+	UsedAt      int64              `bson:"usedAt,omitempty"`
+	Invalidated bool               `bson:"invalidated"`
+}
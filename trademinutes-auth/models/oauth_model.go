@@ -0,0 +1,14 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// OAuthState is a pending authorization-code flow, keyed by the hash of its state parameter.
+type OAuthState struct {
+	ID           string             `bson:"_id"`
+	Provider     string             `bson:"provider"`
+	CodeVerifier string             `bson:"codeVerifier"`
+	NonceHash    string             `bson:"nonceHash"`
+	LinkUserID   primitive.ObjectID `bson:"linkUserId,omitempty"`
+	CreatedAt    int64              `bson:"createdAt"`
+	ExpiresAt    int64              `bson:"expiresAt"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Passkey is a WebAuthn credential registered to a user. ID is the base64url credential ID.
+type Passkey struct {
+	ID              string   `json:"id" bson:"id"`
+	Name            string   `json:"name" bson:"name"`
+	PublicKey       []byte   `json:"-" bson:"publicKey"`
+	AttestationType string   `json:"-" bson:"attestationType"`
+	Transports      []string `json:"transports,omitempty" bson:"transports,omitempty"`
+	AAGUID          []byte   `json:"-" bson:"aaguid,omitempty"`
+	SignCount       uint32   `json:"-" bson:"signCount"`
+	CloneWarning    bool     `json:"cloneWarning,omitempty" bson:"cloneWarning,omitempty"`
+	BackupEligible  bool     `json:"backupEligible" bson:"backupEligible"`
+	BackupState     bool     `json:"backupState" bson:"backupState"`
+	CreatedAt       int64    `json:"createdAt" bson:"createdAt"`
+	LastUsedAt      int64    `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+}
+
+// Passkey ceremony purposes.
+const (
+	CeremonyRegister = "register" // adding a passkey to a logged-in account
+	CeremonySignup   = "signup"   // creating a passkey-only account
+	CeremonyLogin    = "login"
+)
+
+// PasskeyCeremony is the server side of an in-progress WebAuthn registration or login.
+// It is keyed by the hash of the ceremony ID handed to the client and is single-use.
+type PasskeyCeremony struct {
+	ID               string             `bson:"_id"`
+	Purpose          string             `bson:"purpose"`
+	Challenge        string             `bson:"challenge"`
+	UserID           primitive.ObjectID `bson:"userId,omitempty"`
+	UserVerification string             `bson:"userVerification"`
+	Email            string             `bson:"email,omitempty"`      // signup only
+	Name             string             `bson:"name,omitempty"`       // signup only
+	InviteCode       string             `bson:"inviteCode,omitempty"` // signup only
+	CreatedAt        int64              `bson:"createdAt"`
+	ExpiresAt        int64              `bson:"expiresAt"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// PasswordReset is an outstanding reset link, keyed by the hash of its token.
+// A token can be used once; requesting a new one invalidates older ones.
+type PasswordReset struct {
+	ID          string             `bson:"_id"`
+	UserID      primitive.ObjectID `bson:"userId"`
+	Email       string             `bson:"email"`
+	IP          string             `bson:"ip"`
+	CreatedAt   int64              `bson:"createdAt"`
+	ExpiresAt   int64              `bson:"expiresAt"`
+	Used        bool               `bson:"used"`
+	UsedAt      int64              `bson:"usedAt,omitempty"`
+	Invalidated bool               `bson:"invalidated"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Referral statuses. A referral is rewarded by task-core once the referee completes
+// their first booking.
+const (
+	ReferralPending  = "pending"
+	ReferralRewarded = "rewarded"
+)
+
+// Referral is an edge of the referral graph: ReferrerID invited RefereeID. Each user
+// has at most one referral as referee.
+type Referral struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ReferrerID primitive.ObjectID `json:"referrerId" bson:"referrerId"`
+	RefereeID  primitive.ObjectID `json:"refereeId" bson:"refereeId"`
+	InviteCode string             `json:"inviteCode" bson:"inviteCode"`
+	Status     string             `json:"status" bson:"status"`
+	Bonus      int                `json:"bonus,omitempty" bson:"bonus,omitempty"`
+	BookingID  primitive.ObjectID `json:"bookingId,omitempty" bson:"bookingId,omitempty"`
+	CreatedAt  int64              `json:"createdAt" bson:"createdAt"`
+	RewardedAt int64              `json:"rewardedAt,omitempty" bson:"rewardedAt,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Roles and their ordering are defined in the shared authn package.
+
+// RoleChange is an audit record of a role being granted or revoked.
+type RoleChange struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"userId" bson:"userId"`
+	UserEmail  string             `json:"userEmail" bson:"userEmail"`
+	OldRole    string             `json:"oldRole" bson:"oldRole"`
+	NewRole    string             `json:"newRole" bson:"newRole"`
+	ActorID    primitive.ObjectID `json:"actorId,omitempty" bson:"actorId,omitempty"`
+	ActorEmail string             `json:"actorEmail" bson:"actorEmail"`
+	Reason     string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	ChangedAt  int64              `json:"changedAt" bson:"changedAt"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Session is a logged-in device. The refresh token itself is never stored,
+// only its SHA-256 hash, and it is rotated on every refresh.
+type Session struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID            primitive.ObjectID `json:"userId" bson:"userId"`
+	Email             string             `json:"email" bson:"email"`
+	RefreshTokenHash  string             `json:"-" bson:"refreshTokenHash"`
+	PreviousTokenHash string             `json:"-" bson:"previousTokenHash,omitempty"`
+	UserAgent         string             `json:"userAgent" bson:"userAgent"`
+	IP                string             `json:"ip" bson:"ip"`
+	CreatedAt         int64              `json:"createdAt" bson:"createdAt"`
+	LastUsedAt        int64              `json:"lastUsedAt" bson:"lastUsedAt"`
+	ExpiresAt         int64              `json:"expiresAt" bson:"expiresAt"`
+	Revoked           bool               `json:"revoked" bson:"revoked"`
+	RevokedAt         int64              `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+	Current           bool               `json:"current" bson:"-"`
+}
@@ -3,9 +3,45 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type User struct {
-	ID       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name     string             `json:"name,omitempty" bson:"name,omitempty"`
-	Email    string             `json:"email" bson:"email"`
-	Password string             `json:"password" bson:"password"`
-	Credits  int                `json:"credits" bson:"credits"`
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name       string             `json:"name,omitempty" bson:"name,omitempty"`
+	Email      string             `json:"email" bson:"email"`
+	Password   string             `json:"password" bson:"password"`
+	Credits    int                `json:"credits" bson:"credits"`
+	Role       string             `json:"role" bson:"role,omitempty"`
+	Identities []Identity         `json:"identities,omitempty" bson:"identities,omitempty"`
+
+	EmailVerified      bool  `json:"emailVerified" bson:"emailVerified"`
+	VerificationSentAt int64 `json:"-" bson:"verificationSentAt,omitempty"`
+
+	TwoFactorEnabled  bool     `json:"twoFactorEnabled" bson:"twoFactorEnabled"`
+	TOTPSecret        string   `json:"-" bson:"totpSecret,omitempty"`
+	PendingTOTPSecret string   `json:"-" bson:"pendingTotpSecret,omitempty"`
+	TOTPLastStep      int64    `json:"-" bson:"totpLastStep,omitempty"`
+	RecoveryCodes     []string `json:"-" bson:"recoveryCodes,omitempty"` // SHA-256 hashes
+
+	Passkeys []Passkey `json:"passkeys,omitempty" bson:"passkeys,omitempty"`
+
+	InviteCode string             `json:"inviteCode,omitempty" bson:"inviteCode,omitempty"`
+	ReferredBy primitive.ObjectID `json:"referredBy,omitempty" bson:"referredBy,omitempty"`
+
+	// Set by the profile service once the user proves they own an institution email
+	StudentVerification *StudentVerification `json:"studentVerification,omitempty" bson:"studentVerification,omitempty"`
+}
+
+// StudentVerification is the institution email address a user has verified, which
+// gives them the verified-student badge.
+type StudentVerification struct {
+	InstitutionID string `json:"institutionId" bson:"institutionId"`
+	Institution   string `json:"institution" bson:"institution"`
+	Email         string `json:"email" bson:"email"`
+	VerifiedAt    int64  `json:"verifiedAt" bson:"verifiedAt"`
+}
+
+// Identity links an external OAuth account to a user.
+type Identity struct {
+	Provider string `json:"provider" bson:"provider"`
+	Subject  string `json:"subject" bson:"subject"`
+	Email    string `json:"email" bson:"email"`
+	LinkedAt int64  `json:"linkedAt" bson:"linkedAt"`
 }
@@ -0,0 +1,56 @@
+package oauth
+
+import (
+	"context"
+	"strconv"
+)
+
+// GitHubProvider logs users in with a GitHub OAuth app.
+type GitHubProvider struct {
+	Config
+	APIURL string
+}
+
+func NewGitHubProvider(c Config) *GitHubProvider {
+	return &GitHubProvider{Config: c, APIURL: envOr("GITHUB_API_URL", "https://api.github.com")}
+}
+
+func (p *GitHubProvider) Name() string { return "github" }
+
+// UserInfo reads the profile and, since the public profile email is optional,
+// falls back to the primary verified address from /user/emails.
+func (p *GitHubProvider) UserInfo(ctx context.Context, accessToken string) (Identity, error) {
+	var profile struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, p.APIURL+"/user", accessToken, &profile); err != nil {
+		return Identity{}, err
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.APIURL+"/user/emails", accessToken, &emails); err != nil {
+		return Identity{}, err
+	}
+
+	identity := Identity{Subject: strconv.FormatInt(profile.ID, 10), Name: profile.Name}
+	if identity.Name == "" {
+		identity.Name = profile.Login
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			identity.Email = e.Email
+			identity.EmailVerified = true
+			break
+		}
+	}
+	if identity.Email == "" {
+		return Identity{}, errNoEmail
+	}
+	return identity, nil
+}
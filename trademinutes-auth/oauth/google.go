@@ -0,0 +1,36 @@
+package oauth
+
+import "context"
+
+// GoogleProvider logs users in with Google's OpenID Connect endpoints.
+type GoogleProvider struct {
+	Config
+	UserInfoURL string
+}
+
+func NewGoogleProvider(c Config) *GoogleProvider {
+	return &GoogleProvider{Config: c, UserInfoURL: envOr("GOOGLE_USERINFO_URL", "https://openidconnect.googleapis.com/v1/userinfo")}
+}
+
+func (p *GoogleProvider) Name() string { return "google" }
+
+func (p *GoogleProvider) UserInfo(ctx context.Context, accessToken string) (Identity, error) {
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := getJSON(ctx, p.UserInfoURL, accessToken, &info); err != nil {
+		return Identity{}, err
+	}
+	if info.Email == "" {
+		return Identity{}, errNoEmail
+	}
+	return Identity{
+		Subject:       info.Sub,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Name:          info.Name,
+	}, nil
+}
@@ -0,0 +1,196 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// fakeProvider is a local authorization server: it issues one code for the PKCE
+// challenge it was given and serves GitHub- and Google-style profile endpoints.
+type fakeProvider struct {
+	*httptest.Server
+	challenge string
+	emails    []map[string]interface{}
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	f := &fakeProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Form.Get("client_id") != "client" || r.Form.Get("client_secret") != "secret":
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		case r.Form.Get("code") != "good-code" || r.Form.Get("redirect_uri") != "http://localhost/callback":
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		case CodeChallenge(r.Form.Get("code_verifier")) != f.challenge:
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		default:
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "token_type": "bearer"})
+		}
+	})
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer access" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("/user", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "octo", "name": ""})
+	}))
+	mux.HandleFunc("/user/emails", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(f.emails)
+	}))
+	mux.HandleFunc("/userinfo", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"sub": "g-1", "email": "g@example.com", "email_verified": true, "name": "G"})
+	}))
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeProvider) config() Config {
+	return Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AuthURL:      f.URL + "/authorize",
+		TokenURL:     f.URL + "/token",
+		RedirectURL:  "http://localhost/callback",
+		Scopes:       []string{"read:user", "user:email"},
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	c := Config{ClientID: "client", AuthURL: "https://idp.example/authorize?prompt=consent", RedirectURL: "http://localhost/callback", Scopes: []string{"openid", "email"}}
+	u, err := url.Parse(c.AuthCodeURL("state-1", CodeChallenge("verifier")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"prompt":                "consent",
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "http://localhost/callback",
+		"scope":                 "openid email",
+		"state":                 "state-1",
+		"code_challenge":        CodeChallenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
+
+func TestGitHubLogin(t *testing.T) {
+	f := newFakeProvider(t)
+	f.challenge = CodeChallenge("verifier")
+	f.emails = []map[string]interface{}{
+		{"email": "old@example.com", "primary": false, "verified": true},
+		{"email": "octo@example.com", "primary": true, "verified": true},
+	}
+	p := &GitHubProvider{Config: f.config(), APIURL: f.URL}
+	ctx := context.Background()
+
+	token, err := p.Exchange(ctx, "good-code", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := p.UserInfo(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Subject: "42", Email: "octo@example.com", EmailVerified: true, Name: "octo"}
+	if identity != want {
+		t.Fatalf("identity = %+v, want %+v", identity, want)
+	}
+}
+
+func TestGitHubRequiresVerifiedPrimaryEmail(t *testing.T) {
+	f := newFakeProvider(t)
+	f.emails = []map[string]interface{}{{"email": "octo@example.com", "primary": true, "verified": false}}
+	p := &GitHubProvider{Config: f.config(), APIURL: f.URL}
+
+	if _, err := p.UserInfo(context.Background(), "access"); err != errNoEmail {
+		t.Fatalf("err = %v, want errNoEmail", err)
+	}
+}
+
+func TestGoogleLogin(t *testing.T) {
+	f := newFakeProvider(t)
+	f.challenge = CodeChallenge("verifier")
+	p := &GoogleProvider{Config: f.config(), UserInfoURL: f.URL + "/userinfo"}
+	ctx := context.Background()
+
+	token, err := p.Exchange(ctx, "good-code", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := p.UserInfo(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Subject: "g-1", Email: "g@example.com", EmailVerified: true, Name: "G"}
+	if identity != want {
+		t.Fatalf("identity = %+v, want %+v", identity, want)
+	}
+}
+
+func TestExchangeRejected(t *testing.T) {
+	f := newFakeProvider(t)
+	f.challenge = CodeChallenge("verifier")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		config   func(Config) Config
+		code     string
+		verifier string
+	}{
+		{"wrong verifier", func(c Config) Config { return c }, "good-code", "other-verifier"},
+		{"wrong code", func(c Config) Config { return c }, "bad-code", "verifier"},
+		{"wrong secret", func(c Config) Config { c.ClientSecret = "guess"; return c }, "good-code", "verifier"},
+		{"wrong redirect", func(c Config) Config { c.RedirectURL = "http://evil/callback"; return c }, "good-code", "verifier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if token, err := tt.config(f.config()).Exchange(ctx, tt.code, tt.verifier); err == nil {
+				t.Fatalf("got token %q, want an error", token)
+			}
+		})
+	}
+}
+
+func TestUserInfoRejectsBadToken(t *testing.T) {
+	f := newFakeProvider(t)
+	p := &GoogleProvider{Config: f.config(), UserInfoURL: f.URL + "/userinfo"}
+	if _, err := p.UserInfo(context.Background(), "stolen"); err == nil {
+		t.Fatal("UserInfo accepted a token the provider rejected")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	f := newFakeProvider(t)
+	Register(&GoogleProvider{Config: f.config(), UserInfoURL: f.URL + "/userinfo"})
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(providers, "google")
+		mu.Unlock()
+	})
+	if p, ok := Get("google"); !ok || p.Name() != "google" {
+		t.Fatalf("Get(google) = %v, %v", p, ok)
+	}
+	if _, ok := Get("unknown"); ok {
+		t.Fatal("Get(unknown) found a provider")
+	}
+}
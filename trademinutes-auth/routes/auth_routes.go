@@ -5,18 +5,79 @@ import (
 	"trademinutes-auth/controllers" // controller handlers
 	"trademinutes-auth/middleware"  // JWT middleware
 
+	"github.com/ElioCloud/trademinutes-common/authn"
 	"github.com/gorilla/mux"
 )
 
 func AuthRoutes(router *mux.Router) {
+	// Public keys for verifying access tokens in other services
+	router.HandleFunc("/.well-known/jwks.json", controllers.JWKSHandler).Methods("GET")
+
 	authRouter := router.PathPrefix("/api/auth").Subrouter()
 
 	authRouter.HandleFunc("/register", controllers.RegisterHandler).Methods("POST")
 	authRouter.HandleFunc("/login", controllers.LoginHandler).Methods("POST")
-	authRouter.Handle("/profile", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.ProfileHandler))).Methods("GET")
+	authRouter.HandleFunc("/login/2fa", controllers.LoginTwoFactorHandler).Methods("POST")
+	authRouter.HandleFunc("/magic-link", controllers.MagicLinkHandler).Methods("POST")
+	authRouter.HandleFunc("/magic-link/verify", controllers.MagicLinkVerifyHandler).Methods("POST")
+	authRouter.Handle("/profile", middleware.APITokenMiddleware("profile")(http.HandlerFunc(controllers.ProfileHandler))).Methods("GET")
 	authRouter.HandleFunc("/forgot-password", controllers.ForgotPasswordHandler).Methods("POST")
 	authRouter.HandleFunc("/reset-password", controllers.ResetPasswordHandler).Methods("POST")
-	authRouter.HandleFunc("/github", controllers.GitHubOAuthHandler).Methods("POST")
-	authRouter.HandleFunc("/google", controllers.GitHubOAuthHandler).Methods("POST")
 	authRouter.HandleFunc("/user/{id}", controllers.GetUserByIDHandler).Methods("GET")
+	authRouter.HandleFunc("/verify-email", controllers.VerifyEmailHandler).Methods("POST")
+	authRouter.HandleFunc("/resend-verification", controllers.ResendVerificationHandler).Methods("POST")
+
+	// OAuth (authorization code + PKCE)
+	authRouter.HandleFunc("/oauth/{provider}/start", controllers.OAuthStartHandler).Methods("GET")
+	authRouter.HandleFunc("/oauth/{provider}/callback", controllers.OAuthCallbackHandler).Methods("GET")
+	authRouter.Handle("/oauth/{provider}/link", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.OAuthLinkHandler))).Methods("POST")
+	authRouter.Handle("/oauth/{provider}/link/complete", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.OAuthLinkCompleteHandler))).Methods("POST")
+
+	// Passkeys (WebAuthn)
+	authRouter.HandleFunc("/passkeys/login/begin", controllers.BeginPasskeyLoginHandler).Methods("POST")
+	authRouter.HandleFunc("/passkeys/login/finish", controllers.FinishPasskeyLoginHandler).Methods("POST")
+	authRouter.HandleFunc("/passkeys/signup/begin", controllers.BeginPasskeySignupHandler).Methods("POST")
+	authRouter.HandleFunc("/passkeys/signup/finish", controllers.FinishPasskeySignupHandler).Methods("POST")
+	authRouter.Handle("/passkeys/register/begin", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.BeginPasskeyRegistrationHandler))).Methods("POST")
+	authRouter.Handle("/passkeys/register/finish", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.FinishPasskeyRegistrationHandler))).Methods("POST")
+	authRouter.Handle("/passkeys", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.ListPasskeysHandler))).Methods("GET")
+	authRouter.Handle("/passkeys/{id}", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.DeletePasskeyHandler))).Methods("DELETE")
+
+	// Two-factor authentication
+	authRouter.Handle("/2fa/enroll", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.EnrollTwoFactorHandler))).Methods("POST")
+	authRouter.Handle("/2fa/confirm", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.ConfirmTwoFactorHandler))).Methods("POST")
+	authRouter.Handle("/2fa/disable", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.DisableTwoFactorHandler))).Methods("POST")
+
+	// Sessions
+	authRouter.HandleFunc("/refresh", controllers.RefreshHandler).Methods("POST")
+	authRouter.Handle("/logout", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.LogoutHandler))).Methods("POST")
+	authRouter.Handle("/sessions", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.ListSessionsHandler))).Methods("GET")
+	authRouter.Handle("/sessions/{id}", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.RevokeSessionHandler))).Methods("DELETE")
+
+	// Personal access tokens
+	authRouter.Handle("/tokens", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.CreateAPITokenHandler))).Methods("POST")
+	authRouter.Handle("/tokens", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.ListAPITokensHandler))).Methods("GET")
+	authRouter.Handle("/tokens/{id}", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.RevokeAPITokenHandler))).Methods("DELETE")
+
+	// Authentication event history
+	authRouter.Handle("/events", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.ListMyAuthEventsHandler))).Methods("GET")
+	authRouter.Handle("/referrals", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.GetReferralsHandler))).Methods("GET")
+
+	// Account deletion and data export
+	authRouter.Handle("/account", middleware.JWTAuthMiddleware(http.HandlerFunc(controllers.DeleteAccountHandler))).Methods("DELETE")
+	authRouter.Handle("/account/export", middleware.JWTAuthMiddleware(authn.RejectImpersonation(http.HandlerFunc(controllers.ExportAccountHandler)))).Methods("GET")
+
+	// Admin
+	adminRouter := authRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.JWTAuthMiddleware, authn.RequireRole(authn.RoleAdmin))
+	adminRouter.HandleFunc("/users/{id}/role", controllers.GrantRoleHandler).Methods("PUT")
+	adminRouter.HandleFunc("/users/{id}/role", controllers.RevokeRoleHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/users/{id}/lockout", controllers.UnlockAccountHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/role-audit", controllers.ListRoleAuditHandler).Methods("GET")
+	adminRouter.HandleFunc("/auth-events", controllers.ListAuthEventsHandler).Methods("GET")
+	adminRouter.HandleFunc("/referrals", controllers.ListReferralsHandler).Methods("GET")
+	adminRouter.HandleFunc("/users/{id}/impersonate", controllers.StartImpersonationHandler).Methods("POST")
+	adminRouter.HandleFunc("/impersonations", controllers.ListImpersonationsHandler).Methods("GET")
+	adminRouter.HandleFunc("/impersonations/{id}", controllers.EndImpersonationHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/impersonations/{id}/actions", controllers.ListImpersonatedActionsHandler).Methods("GET")
 }
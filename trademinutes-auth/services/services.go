@@ -0,0 +1,90 @@
+// Package services calls the internal endpoints of the other TradeMinutes services,
+// which the auth service uses to export and delete a user's data everywhere.
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// InternalTokenHeader carries the shared INTERNAL_API_TOKEN on service-to-service calls.
+const InternalTokenHeader = "X-Internal-Token"
+
+// Service is another TradeMinutes service holding user data.
+type Service struct {
+	Name    string
+	BaseURL string
+}
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+// All returns the services that hold user data, with base URLs from the environment.
+func All() []Service {
+	return []Service{
+		{Name: "profile", BaseURL: envOr("PROFILE_SERVICE_URL", "http://localhost:8081")},
+		{Name: "tasks", BaseURL: envOr("TASK_SERVICE_URL", "http://localhost:8084")},
+		{Name: "messaging", BaseURL: envOr("MESSAGING_SERVICE_URL", "http://localhost:8085")},
+		{Name: "reviews", BaseURL: envOr("REVIEW_SERVICE_URL", "http://localhost:8086")},
+	}
+}
+
+// ExportUser returns everything the service stores about the user, as JSON.
+func (s Service) ExportUser(ctx context.Context, userID, email string) (json.RawMessage, error) {
+	body, err := s.call(ctx, http.MethodGet, userID, "/export", email)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("%s: invalid JSON in export", s.Name)
+	}
+	return body, nil
+}
+
+// DeleteUser removes the user's data from the service, anonymising records other users
+// still need. It is idempotent, so a failed account deletion can simply be retried.
+func (s Service) DeleteUser(ctx context.Context, userID, email string) error {
+	_, err := s.call(ctx, http.MethodDelete, userID, "", email)
+	return err
+}
+
+func (s Service) call(ctx context.Context, method, userID, suffix, email string) ([]byte, error) {
+	token := os.Getenv("INTERNAL_API_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("INTERNAL_API_TOKEN not configured")
+	}
+
+	endpoint := fmt.Sprintf("%s/internal/users/%s%s?email=%s", s.BaseURL, url.PathEscape(userID), suffix, url.QueryEscape(email))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(InternalTokenHeader, token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 50<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: status %d", s.Name, resp.StatusCode)
+	}
+	return body, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -1,25 +1,136 @@
 package utils
 
 import (
-	"time"
+	"fmt"
 	"os"
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
-	"fmt"
 )
 
-func GenerateJWT(email string) (string, error) {
-	secret := []byte(os.Getenv("JWT_SECRET"))
-
-	fmt.Println("🧪 Issuing token for:", email)
-	fmt.Println("🧪 JWT_SECRET in GenerateJWT:", os.Getenv("JWT_SECRET"))
+const (
+	// AccessTokenTTL is deliberately short; clients renew through /api/auth/refresh.
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
 
+// GenerateJWT issues an access token bound to the session identified by sessionID
+// and carrying the user's role for authorization in every service.
+// It is signed with the active asymmetric key so other services can verify it via the
+// JWKS endpoint without being able to mint tokens themselves.
+func GenerateJWT(email, sessionID, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"email": email,
-		"exp":   time.Now().Add(time.Hour * 72).Unix(),
+		"sid":   sessionID,
+		"role":  role,
+		"exp":   time.Now().Add(AccessTokenTTL).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secret)
+	return signClaims(claims)
+}
+
+// ImpersonationTTL bounds how long an admin can act as another user with one token.
+const ImpersonationTTL = 10 * time.Minute
+
+// GenerateImpersonationToken issues an access token for the target user that names the
+// admin behind it in an RFC 8693 "act" claim. Services honour it like a normal token but
+// refuse writes unless readonly is false, and it is never paired with a refresh token.
+func GenerateImpersonationToken(email, impersonationID, role, adminID, adminEmail string, readOnly bool) (string, error) {
+	claims := jwt.MapClaims{
+		"email":    email,
+		"sid":      impersonationID,
+		"role":     role,
+		"act":      map[string]string{"sub": adminID, "email": adminEmail},
+		"readonly": readOnly,
+		"exp":      time.Now().Add(ImpersonationTTL).Unix(),
+	}
+
+	return signClaims(claims)
+}
+
+// hmacSecret returns the HMAC key held in the environment variable name. An empty key
+// would let anyone sign tokens, so it is refused rather than used.
+func hmacSecret(name string) ([]byte, error) {
+	secret := os.Getenv(name)
+	if secret == "" {
+		return nil, fmt.Errorf("%s is not set", name)
+	}
+	return []byte(secret), nil
+}
+
+// signHMAC signs claims with HS256 under the secret in the environment variable name.
+func signHMAC(claims jwt.MapClaims, name string) (string, error) {
+	secret, err := hmacSecret(name)
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+// parseHMAC verifies an HS256 token against the secret in the environment variable name.
+func parseHMAC(tokenString, name string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return hmacSecret(name)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 }
 
+const EmailVerificationTTL = 24 * time.Hour
 
+// GenerateEmailVerificationToken signs the link token mailed to confirm an address.
+func GenerateEmailVerificationToken(email string) (string, error) {
+	claims := jwt.MapClaims{
+		"email":   email,
+		"purpose": "verify_email",
+		"exp":     time.Now().Add(EmailVerificationTTL).Unix(),
+	}
+	return signHMAC(claims, "JWT_VERIFY_SECRET")
+}
+
+// ParseEmailVerificationToken validates a verification token and returns the email it was issued for.
+func ParseEmailVerificationToken(tokenString string) (string, error) {
+	token, err := parseHMAC(tokenString, "JWT_VERIFY_SECRET")
+	if err != nil || !token.Valid {
+		return "", fmt.Errorf("invalid token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "verify_email" {
+		return "", fmt.Errorf("invalid token claims")
+	}
+	email, ok := claims["email"].(string)
+	if !ok || email == "" {
+		return "", fmt.Errorf("invalid token claims")
+	}
+	return email, nil
+}
+
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// GenerateTwoFactorChallenge issues the short-lived token returned by login when a second
+// factor is still required. It carries no email claim, so no JWT middleware accepts it.
+func GenerateTwoFactorChallenge(userID string) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":     userID,
+		"purpose": "2fa_challenge",
+		"exp":     time.Now().Add(TwoFactorChallengeTTL).Unix(),
+	}
+	return signHMAC(claims, "JWT_CHALLENGE_SECRET")
+}
+
+// ParseTwoFactorChallenge validates a challenge token and returns the user ID it was issued for.
+func ParseTwoFactorChallenge(tokenString string) (string, error) {
+	token, err := parseHMAC(tokenString, "JWT_CHALLENGE_SECRET")
+	if err != nil || !token.Valid {
+		return "", fmt.Errorf("invalid token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "2fa_challenge" {
+		return "", fmt.Errorf("invalid token claims")
+	}
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return "", fmt.Errorf("invalid token claims")
+	}
+	return sub, nil
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is one private key of the keyring, identified by its kid.
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	signer crypto.Signer
+}
+
+var (
+	keysMu     sync.RWMutex
+	activeKey  *signingKey
+	signingSet = map[string]*signingKey{}
+)
+
+// LoadSigningKeys loads every PEM private key (Ed25519 or RSA) in JWT_KEYS_DIR. The file
+// name without extension is the kid. New tokens are signed with JWT_ACTIVE_KID, or the
+// lexically last kid if unset, so date-named keys rotate naturally. Older keys stay
+// published in the JWKS until their file is removed, giving tokens signed with them
+// time to expire.
+func LoadSigningKeys() error {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		return useEphemeralKey()
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no signing keys found in %s", dir)
+	}
+
+	set := map[string]*signingKey{}
+	var kids []string
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := readSigningKey(kid, path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		set[kid] = key
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	activeKid := os.Getenv("JWT_ACTIVE_KID")
+	if activeKid == "" {
+		activeKid = kids[len(kids)-1]
+	}
+	active, ok := set[activeKid]
+	if !ok {
+		return fmt.Errorf("active key %q not found in %s", activeKid, dir)
+	}
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	signingSet = set
+	activeKey = active
+	log.Printf("Loaded %d signing keys, active kid: %s", len(set), activeKid)
+	return nil
+}
+
+// useEphemeralKey generates an in-memory Ed25519 key for local development.
+// Tokens do not survive restarts and cannot be shared between auth replicas.
+func useEphemeralKey() error {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	suffix, err := GenerateRandomToken(6)
+	if err != nil {
+		return err
+	}
+
+	key := &signingKey{kid: "dev-" + suffix, method: jwt.SigningMethodEdDSA, signer: priv}
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	signingSet = map[string]*signingKey{key.kid: key}
+	activeKey = key
+	log.Println("⚠️ JWT_KEYS_DIR not set, signing tokens with an ephemeral key")
+	return nil
+}
+
+func readSigningKey(kid, path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, signer: k}, nil
+	case *rsa.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, signer: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// signClaims signs claims with the active key and sets its kid in the header.
+func signClaims(claims jwt.Claims) (string, error) {
+	keysMu.RLock()
+	key := activeKey
+	keysMu.RUnlock()
+	if key == nil {
+		return "", fmt.Errorf("signing keys not loaded")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.signer)
+}
+
+// AccessTokenKey resolves the public key an access token was signed with from the
+// keyring, by its kid. The token's algorithm must match the key's.
+func AccessTokenKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	keysMu.RLock()
+	key, ok := signingSet[kid]
+	keysMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.signer.Public(), nil
+}
+
+// JWKS returns the public half of every loaded key as a JSON Web Key Set.
+func JWKS() map[string]interface{} {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	keys := []map[string]string{}
+	for kid, key := range signingSet {
+		jwk := map[string]string{"kid": kid, "alg": key.method.Alg(), "use": "sig"}
+		switch pub := key.signer.Public().(type) {
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+		keys = append(keys, jwk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["kid"] < keys[j]["kid"] })
+	return map[string]interface{}{"keys": keys}
+}
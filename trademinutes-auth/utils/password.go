@@ -1,6 +1,12 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
@@ -11,3 +17,46 @@ func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// Limits for ValidatePassword. bcrypt ignores everything past 72 bytes.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// commonPasswords is a short deny-list of passwords that satisfy the character rules
+// but appear at the top of every breach corpus.
+var commonPasswords = map[string]bool{
+	"password1": true, "password123": true, "passw0rd": true, "qwerty123": true,
+	"abc12345": true, "abcd1234": true, "12345678a": true, "iloveyou1": true,
+	"welcome1": true, "letmein1": true, "trademinutes1": true,
+}
+
+// ValidatePassword enforces the password policy: MinPasswordLength to MaxPasswordLength
+// bytes, at least one letter and one digit, and not a well-known password.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("password must be at most %d bytes", MaxPasswordLength)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLetter(c):
+			hasLetter = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("password must contain at least one letter and one digit")
+	}
+
+	if commonPasswords[strings.ToLower(password)] {
+		return fmt.Errorf("password is too common")
+	}
+	return nil
+}
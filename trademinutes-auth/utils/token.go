@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+)
+
+// GenerateRandomToken returns a URL-safe random string with n bytes of entropy.
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 of an opaque token, which is what gets persisted.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientIP returns the caller's address. X-Forwarded-For is only believed as far as it
+// was written by the proxies in TRUSTED_PROXIES, so clients cannot choose the address
+// that lockouts and audit records see.
+func ClientIP(r *http.Request) string {
+	return httpx.ClientIP(r)
+}
+
+// inviteAlphabet leaves out characters that are easily confused when read aloud or typed.
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateInviteCode returns a short, human-friendly random referral code.
+func GenerateInviteCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = inviteAlphabet[int(b[i])%len(inviteAlphabet)]
+	}
+	return string(b), nil
+}
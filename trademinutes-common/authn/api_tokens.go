@@ -0,0 +1,53 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// apiTokenPrefix marks personal access tokens issued by the auth service.
+const apiTokenPrefix = "tm_pat_"
+
+// apiTokenTouchInterval limits how often lastUsedAt is written for a busy token.
+const apiTokenTouchInterval = time.Minute
+
+type apiToken struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Email      string             `bson:"email"`
+	Scopes     []string           `bson:"scopes"`
+	LastUsedAt int64              `bson:"lastUsedAt"`
+}
+
+// lookupAPIToken resolves a personal access token from the shared api_tokens collection
+// and records its use. Only the SHA-256 hash of a token is stored.
+func (a *Authenticator) lookupAPIToken(plaintext string, r *http.Request) (apiToken, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sum := sha256.Sum256([]byte(plaintext))
+	now := time.Now().Unix()
+	tokens := a.DB().Collection("api_tokens")
+
+	var token apiToken
+	err := tokens.FindOne(ctx, bson.M{
+		"tokenHash": hex.EncodeToString(sum[:]),
+		"revoked":   false,
+		"expiresAt": bson.M{"$gt": now},
+	}).Decode(&token)
+	if err != nil {
+		return token, false
+	}
+
+	if token.LastUsedAt < now-int64(apiTokenTouchInterval.Seconds()) {
+		tokens.UpdateByID(ctx, token.ID, bson.M{"$set": bson.M{"lastUsedAt": now, "lastUsedIp": httpx.ClientIP(r)}})
+	}
+	return token, true
+}
@@ -0,0 +1,95 @@
+package authn
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+)
+
+// Headers the API gateway uses to pass on the principal it authenticated, so the
+// services behind it don't validate the same token again. They are only trusted on
+// requests that also carry the shared INTERNAL_API_TOKEN.
+const (
+	HeaderEmail   = "X-Authenticated-Email"
+	HeaderRole    = "X-Authenticated-Role"
+	HeaderSession = "X-Authenticated-Session"
+	HeaderActor   = "X-Authenticated-Actor"
+	// HeaderScopes is only set for personal access tokens, as a comma-separated list.
+	HeaderScopes = "X-Authenticated-Scopes"
+)
+
+const internalTokenHeader = "X-Internal-Token"
+
+var identityHeaders = []string{HeaderEmail, HeaderRole, HeaderSession, HeaderActor, HeaderScopes, internalTokenHeader}
+
+// StripIdentity removes any forwarded identity from h, e.g. headers a client sent to
+// the gateway itself.
+func StripIdentity(h http.Header) {
+	for _, name := range identityHeaders {
+		h.Del(name)
+	}
+}
+
+// ForwardIdentity replaces the forwarded identity in h with p. Nothing is forwarded
+// when INTERNAL_API_TOKEN is unset; the service then validates the bearer token itself.
+func ForwardIdentity(h http.Header, p Principal) {
+	StripIdentity(h)
+	token := os.Getenv("INTERNAL_API_TOKEN")
+	if token == "" {
+		return
+	}
+	h.Set(internalTokenHeader, token)
+	h.Set(HeaderEmail, p.Email)
+	h.Set(HeaderRole, p.Role)
+	h.Set(HeaderSession, p.SessionID)
+	if p.Actor != "" {
+		h.Set(HeaderActor, p.Actor)
+	}
+	if p.APIToken {
+		h.Set(HeaderScopes, strings.Join(p.Scopes, ","))
+	}
+}
+
+// forwardedPrincipal returns the principal forwarded by the gateway, if the request
+// carries one from a trusted sender.
+func forwardedPrincipal(r *http.Request) (Principal, bool) {
+	email := r.Header.Get(HeaderEmail)
+	expected := os.Getenv("INTERNAL_API_TOKEN")
+	got := r.Header.Get(internalTokenHeader)
+	if email == "" || expected == "" || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+		return Principal{}, false
+	}
+
+	p := Principal{
+		Email:     email,
+		Role:      r.Header.Get(HeaderRole),
+		SessionID: r.Header.Get(HeaderSession),
+		Actor:     r.Header.Get(HeaderActor),
+	}
+	if scopes, ok := r.Header[HeaderScopes]; ok {
+		p.APIToken = true
+		p.Role = RoleMember
+		if len(scopes) > 0 && scopes[0] != "" {
+			p.Scopes = strings.Split(scopes[0], ",")
+		}
+	}
+	return p, true
+}
+
+// checkForwarded applies this service's own limits to a forwarded principal. The
+// gateway has already validated the token and the impersonation behind it. It returns
+// false after writing an error.
+func (a *Authenticator) checkForwarded(w http.ResponseWriter, r *http.Request, p Principal) bool {
+	if p.APIToken && !a.APITokens {
+		httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if p.Impersonated() && a.BlockImpersonatedWrites && !safeMethod(r.Method) {
+		httpx.Error(w, "Not available while impersonating", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package authn
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	jwksTTL             = 10 * time.Minute
+	jwksMinRefreshDelay = 30 * time.Second // throttles refetches, e.g. for unknown kids or while auth is down
+)
+
+// jwksCache holds the auth service's public signing keys, keyed by kid.
+type jwksCache struct {
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+var jwks = &jwksCache{}
+
+// jwksKeyFunc resolves the verification key for a token from the cached JWKS. An unknown kid
+// triggers a refetch so keys rotated in by the auth service are picked up promptly.
+func jwksKeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid")
+	}
+
+	jwks.mu.RLock()
+	key, ok := jwks.keys[kid]
+	stale := time.Since(jwks.fetchedAt) >= jwksTTL
+	canRetry := time.Since(jwks.attemptedAt) >= jwksMinRefreshDelay
+	jwks.mu.RUnlock()
+
+	if (!ok || stale) && canRetry {
+		if err := jwks.refresh(); err != nil {
+			log.Printf("JWKS refresh failed: %v", err)
+		}
+		jwks.mu.RLock()
+		key, ok = jwks.keys[kid]
+		jwks.mu.RUnlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func (c *jwksCache) refresh() error {
+	c.mu.Lock()
+	c.attemptedAt = time.Now()
+	c.mu.Unlock()
+
+	url := os.Getenv("AUTH_JWKS_URL")
+	if url == "" {
+		url = "http://localhost:8080/.well-known/jwks.json"
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS fetch returned %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		switch {
+		case k.Kty == "OKP" && k.Crv == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+			keys[k.Kid] = ed25519.PublicKey(x)
+		case k.Kty == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		}
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,145 @@
+package authn
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Authenticator validates the bearer token of a request, or accepts the principal
+// forwarded by the API gateway, and stores the caller as a Principal in its context.
+type Authenticator struct {
+	// Service names the service in the impersonation audit trail.
+	Service string
+	// DB returns the shared database holding api_tokens, impersonations and
+	// impersonation_actions.
+	DB func() *mongo.Database
+	// KeyFunc resolves the key an access token is verified with. Nil uses the auth
+	// service's public keys, fetched from AUTH_JWKS_URL.
+	KeyFunc jwt.Keyfunc
+	// APITokens accepts personal access tokens as well as access tokens.
+	APITokens bool
+	// SessionActive, if set, is checked against the sid of ordinary access tokens so
+	// that revoked sessions are refused before their tokens expire.
+	SessionActive func(sid string) bool
+	// BlockImpersonatedWrites refuses writes through impersonation tokens even when the
+	// token allows them.
+	BlockImpersonatedWrites bool
+}
+
+// Middleware rejects requests without a valid bearer token.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := forwardedPrincipal(r); ok {
+			if a.checkForwarded(w, r, p) {
+				next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+			}
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		p, ok := a.authenticate(w, r, strings.TrimPrefix(authHeader, "Bearer "))
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// Optional authenticates requests that carry a bearer token and lets anonymous ones
+// through without a Principal. An invalid token is still rejected.
+func (a *Authenticator) Optional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := forwardedPrincipal(r); ok {
+			if a.checkForwarded(w, r, p) {
+				next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+			}
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, ok := a.authenticate(w, r, strings.TrimPrefix(authHeader, "Bearer "))
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// authenticate resolves tokenString to a Principal. It returns false after writing an error.
+func (a *Authenticator) authenticate(w http.ResponseWriter, r *http.Request, tokenString string) (Principal, bool) {
+	if strings.HasPrefix(tokenString, apiTokenPrefix) {
+		if !a.APITokens {
+			httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return Principal{}, false
+		}
+		token, ok := a.lookupAPIToken(tokenString, r)
+		if !ok {
+			log.Println("API token invalid, expired or revoked")
+			httpx.Error(w, "Invalid token", http.StatusUnauthorized)
+			return Principal{}, false
+		}
+		// API tokens never carry elevated roles; RequireScope limits what they can reach
+		return Principal{Email: token.Email, Role: RoleMember, APIToken: true, Scopes: token.Scopes}, true
+	}
+
+	keyFunc := a.KeyFunc
+	if keyFunc == nil {
+		keyFunc = jwksKeyFunc
+	}
+	// Only asymmetric algorithms are accepted, so HMAC-forged tokens are rejected
+	token, err := jwt.Parse(tokenString, keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}))
+	if err != nil || !token.Valid {
+		log.Printf("JWT validation error: %v", err)
+		httpx.Error(w, "Invalid token", http.StatusUnauthorized)
+		return Principal{}, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		httpx.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return Principal{}, false
+	}
+	email, _ := claims["email"].(string)
+	if email == "" {
+		log.Println("JWT claims missing 'email' or it is empty")
+		httpx.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return Principal{}, false
+	}
+
+	p := Principal{Email: email}
+	p.Role, _ = claims["role"].(string)
+	p.SessionID, _ = claims["sid"].(string)
+
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		p.Actor, _ = act["email"].(string)
+		if p.Actor == "" {
+			p.Actor = "unknown"
+		}
+		// Only an explicit readonly=false allows writes
+		readOnly := true
+		if ro, ok := claims["readonly"].(bool); ok {
+			readOnly = ro
+		}
+		if !a.checkImpersonation(w, r, p, readOnly) {
+			return Principal{}, false
+		}
+	} else if a.SessionActive != nil && !a.SessionActive(p.SessionID) {
+		httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return Principal{}, false
+	}
+	return p, true
+}
@@ -0,0 +1,140 @@
+// Package authn authenticates requests to the TradeMinutes services. Callers present
+// either an access token signed by the auth service or a personal access token, and
+// handlers read the resulting Principal from the request context.
+package authn
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+)
+
+// Roles issued by the auth service; each role includes the permissions of those below it.
+const (
+	RoleMember    = "member"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleMember:    1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Email string
+	Role  string
+	// SessionID is the sid claim: the auth session, or the impersonation for
+	// impersonation tokens.
+	SessionID string
+	// APIToken is set for personal access tokens, which are limited to Scopes.
+	APIToken bool
+	Scopes   []string
+	// Actor is the email of the admin behind an impersonation token.
+	Actor string
+}
+
+// HasScope reports whether a personal access token was granted scope. Session tokens
+// carry no scopes and are not limited by them.
+func (p Principal) HasScope(scope string) bool {
+	if !p.APIToken {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Impersonated reports whether an admin is acting as the user.
+func (p Principal) Impersonated() bool {
+	return p.Actor != ""
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// PrincipalFrom returns the caller authenticated by the middleware, if any.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// Email returns the authenticated caller's email, or "" for anonymous requests.
+func Email(r *http.Request) string {
+	p, _ := PrincipalFrom(r.Context())
+	return p.Email
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants at least the permissions of required.
+// Tokens issued before roles existed carry none and count as members.
+func RoleAtLeast(role, required string) bool {
+	if role == "" {
+		role = RoleMember
+	}
+	return roleRank[role] >= roleRank[required]
+}
+
+// HasRole reports whether the authenticated caller holds at least the given role.
+func HasRole(r *http.Request, role string) bool {
+	p, ok := PrincipalFrom(r.Context())
+	return ok && RoleAtLeast(p.Role, role)
+}
+
+// RequireRole only lets requests through whose caller holds at least the given role.
+// It must run after the authentication middleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasRole(r, role) {
+				httpx.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope limits personal access tokens to the read or write scope of resource,
+// e.g. "tasks:read" for GET and "tasks:write" for anything else. Session tokens carry
+// no scopes and pass through. It must run after the authentication middleware.
+func RequireScope(resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, _ := PrincipalFrom(r.Context())
+			read := r.Method == http.MethodGet || r.Method == http.MethodHead
+			if p.HasScope(resource+":write") || (read && p.HasScope(resource+":read")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			httpx.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
+
+// RejectImpersonation blocks impersonation tokens from a route, e.g. data export.
+// It must run after the authentication middleware.
+func RejectImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := PrincipalFrom(r.Context()); p.Impersonated() {
+			httpx.Error(w, "Not available while impersonating", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,49 @@
+package authn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireScope(t *testing.T) {
+	session := Principal{Email: "a@example.com"}
+	reader := Principal{Email: "a@example.com", APIToken: true, Scopes: []string{"messages:read"}}
+	writer := Principal{Email: "a@example.com", APIToken: true, Scopes: []string{"messages:write"}}
+	other := Principal{Email: "a@example.com", APIToken: true, Scopes: []string{"tasks:write"}}
+
+	tests := []struct {
+		name   string
+		p      Principal
+		method string
+		want   int
+	}{
+		{"session token reads", session, http.MethodGet, http.StatusOK},
+		{"session token writes", session, http.MethodPost, http.StatusOK},
+		{"read scope reads", reader, http.MethodGet, http.StatusOK},
+		{"read scope writes", reader, http.MethodPost, http.StatusForbidden},
+		{"write scope reads", writer, http.MethodGet, http.StatusOK},
+		{"write scope writes", writer, http.MethodDelete, http.StatusOK},
+		{"other resource", other, http.MethodGet, http.StatusForbidden},
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/conversations", nil)
+		r = r.WithContext(WithPrincipal(r.Context(), tt.p))
+		w := httptest.NewRecorder()
+		RequireScope("messages")(ok).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	if !(Principal{}).HasScope("messages:write") {
+		t.Error("session token limited by scopes")
+	}
+	token := Principal{APIToken: true, Scopes: []string{"messages:read"}}
+	if !token.HasScope("messages:read") || token.HasScope("messages:write") {
+		t.Errorf("token scopes %v misread", token.Scopes)
+	}
+}
@@ -0,0 +1,32 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SessionActive returns a check for Authenticator.SessionActive that looks the session
+// up in the sessions collection the auth service keeps in db, so logout and password
+// resets take effect at every service before the access token expires.
+func SessionActive(db func() *mongo.Database) func(sid string) bool {
+	return func(sid string) bool {
+		id, err := primitive.ObjectIDFromHex(sid)
+		if err != nil {
+			return false
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		count, err := db().Collection("sessions").CountDocuments(ctx, bson.M{
+			"_id":       id,
+			"revoked":   false,
+			"expiresAt": bson.M{"$gt": time.Now().Unix()},
+		})
+		return err == nil && count > 0
+	}
+}
@@ -0,0 +1,61 @@
+// Package env loads and validates the environment variables the services are configured with.
+package env
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Load reads a .env file into the environment, except when ENV=production, where the
+// variables are expected to be set by the deployment.
+func Load() {
+	if os.Getenv("ENV") == "production" {
+		return
+	}
+	if err := godotenv.Load(); err != nil {
+		log.Println(".env file not found, assuming production environment variables")
+	}
+}
+
+// Require returns an error naming every one of the variables that is unset or empty.
+func Require(names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// MustRequire is Require for use at startup; it exits if any variable is missing.
+func MustRequire(names ...string) {
+	if err := Require(names...); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Get returns the variable's value, or fallback when it is unset or empty.
+func Get(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Int returns the variable parsed as an integer, or fallback when it is unset or invalid.
+func Int(name string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
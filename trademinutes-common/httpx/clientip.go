@@ -0,0 +1,95 @@
+package httpx
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultTrustedProxies are the loopback and private networks the gateway and load
+// balancers run on.
+const defaultTrustedProxies = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+
+// Proxies is the set of networks whose X-Forwarded-For entries are believed.
+type Proxies []*net.IPNet
+
+// ParseProxies reads a comma-separated list of networks in CIDR notation or single
+// addresses. Malformed entries are ignored.
+func ParseProxies(list string) Proxies {
+	var p Proxies
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			p = append(p, network)
+		}
+	}
+	return p
+}
+
+// TrustedProxies returns the networks listed in TRUSTED_PROXIES. When it is unset, the
+// loopback and private networks are trusted; set it empty to trust no proxy.
+func TrustedProxies() Proxies {
+	list, ok := os.LookupEnv("TRUSTED_PROXIES")
+	if !ok {
+		list = defaultTrustedProxies
+	}
+	return ParseProxies(list)
+}
+
+// Trusts reports whether addr belongs to a trusted proxy.
+func (p Proxies) Trusts(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client behind any trusted proxies. A client can
+// put anything in X-Forwarded-For, but each proxy appends the address it was called
+// from, so the hops are read from the right and the first one that is not a trusted
+// proxy is the client. Requests that do not come from a trusted proxy are answered
+// with their own address.
+func (p Proxies) ClientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !p.Trusts(peer) {
+		return peer
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !p.Trusts(hop) {
+			return hop
+		}
+		peer = hop
+	}
+	// Every hop is a trusted proxy, so the request started inside the network
+	return peer
+}
+
+// ClientIP returns the caller's address, read through the proxies in TRUSTED_PROXIES.
+func ClientIP(r *http.Request) string {
+	return TrustedProxies().ClientIP(r)
+}
@@ -0,0 +1,50 @@
+package httpx
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := ParseProxies("10.0.0.0/8, 192.0.2.1")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"direct client", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"direct client spoofing", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"behind a proxy", "10.0.0.2:4000", []string{"203.0.113.5"}, "203.0.113.5"},
+		{"spoofed first hop", "10.0.0.2:4000", []string{"198.51.100.1, 203.0.113.5"}, "203.0.113.5"},
+		{"chained proxies", "10.0.0.2:4000", []string{"198.51.100.1, 203.0.113.5, 192.0.2.1"}, "203.0.113.5"},
+		{"repeated headers", "10.0.0.2:4000", []string{"198.51.100.1", "203.0.113.5"}, "203.0.113.5"},
+		{"only proxies", "10.0.0.2:4000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"proxy without header", "10.0.0.2:4000", nil, "10.0.0.2"},
+		{"ipv6 client", "[2001:db8::1]:4000", []string{"198.51.100.1"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	if p := TrustedProxies(); len(p) != 0 || p.Trusts("127.0.0.1") {
+		t.Errorf("an empty TRUSTED_PROXIES trusts %v", p)
+	}
+	t.Setenv("TRUSTED_PROXIES", "198.51.100.0/24, not-an-ip, 2001:db8::1")
+	p := TrustedProxies()
+	if !p.Trusts("198.51.100.7") || !p.Trusts("2001:db8::1") || p.Trusts("10.0.0.1") {
+		t.Errorf("TrustedProxies() = %v", p)
+	}
+}
@@ -0,0 +1,128 @@
+package httpx
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	corsAllowHeaders  = "Content-Type, Authorization, X-Request-ID, Idempotency-Key"
+	corsAllowMethods  = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsExposeHeaders = "X-Request-ID, Retry-After, Idempotent-Replayed"
+	corsMaxAge        = "600"
+)
+
+// Origins is an allowlist of browser origins. Entries are exact origins such as
+// https://trademinutes.com, or a wildcard for one level of subdomains such as
+// https://*.vercel.app.
+type Origins struct {
+	exact     map[string]bool
+	wildcards []originWildcard
+}
+
+type originWildcard struct {
+	scheme string
+	suffix string // ".vercel.app", including any port
+}
+
+// ParseOrigins reads a comma-separated list of origins. Malformed entries are ignored.
+func ParseOrigins(list string) Origins {
+	o := Origins{exact: map[string]bool{}}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimRight(strings.TrimSpace(entry), "/")
+		u, err := url.Parse(entry)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			continue
+		}
+		scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+		if strings.HasPrefix(host, "*.") {
+			o.wildcards = append(o.wildcards, originWildcard{scheme: scheme, suffix: host[1:]})
+			continue
+		}
+		o.exact[scheme+"://"+host] = true
+	}
+	return o
+}
+
+// AllowedOrigins returns the origins listed in CORS_ALLOWED_ORIGINS. When it is unset,
+// only FRONTEND_URL is allowed, or http://localhost:3000 for local development.
+func AllowedOrigins() Origins {
+	list := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if list == "" {
+		list = os.Getenv("FRONTEND_URL")
+	}
+	if list == "" {
+		list = "http://localhost:3000"
+	}
+	return ParseOrigins(list)
+}
+
+// Allows reports whether a request with this Origin header may be served.
+func (o Origins) Allows(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	if o.exact[scheme+"://"+host] {
+		return true
+	}
+	for _, w := range o.wildcards {
+		if scheme != w.scheme || !strings.HasSuffix(host, w.suffix) {
+			continue
+		}
+		if label := strings.TrimSuffix(host, w.suffix); label != "" && !strings.Contains(label, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin is for websocket.Upgrader. Clients that send no Origin are not browsers
+// and are let through, as gorilla/websocket does by default.
+func (o Origins) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || o.Allows(origin)
+}
+
+// CORS lets the frontend call the service from the browser, with credentials, and
+// answers preflight requests. Only origins from AllowedOrigins get the CORS headers;
+// a preflight from any other origin is refused.
+func CORS(next http.Handler) http.Handler {
+	return AllowedOrigins().CORS(next)
+}
+
+// CORS is the CORS middleware for this allowlist.
+func (o Origins) CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the Origin, so caches must not share it across origins
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && o.Allows(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+
+		if r.Method == http.MethodOptions {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if origin != "" && !allowed {
+				Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
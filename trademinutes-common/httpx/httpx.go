@@ -0,0 +1,41 @@
+// Package httpx holds the HTTP helpers shared by the TradeMinutes services.
+package httpx
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+)
+
+// Error replies with the JSON error envelope used by every service, {"error": message}.
+// It takes the same arguments as http.Error.
+func Error(w http.ResponseWriter, message string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// JSON replies with v encoded as JSON.
+func JSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// InternalOnly guards service-to-service endpoints with the shared INTERNAL_API_TOKEN,
+// sent in the X-Internal-Token header. With no token configured every request is rejected.
+func InternalOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := os.Getenv("INTERNAL_API_TOKEN")
+		got := r.Header.Get("X-Internal-Token")
+		if expected == "" || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+			log.Printf("Rejected internal request: %s %s", r.Method, r.URL.Path)
+			Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
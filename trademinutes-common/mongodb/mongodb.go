@@ -0,0 +1,40 @@
+// Package mongodb connects the services to their shared MongoDB database.
+package mongodb
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// connectTimeout bounds both connecting and the initial ping.
+const connectTimeout = 10 * time.Second
+
+// Connect opens a client for uri, checks the server is reachable and returns database name.
+func Connect(uri, name string) (*mongo.Database, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	return client.Database(name), nil
+}
+
+// MustConnectFromEnv connects using MONGO_URI and DB_NAME and exits if that fails.
+func MustConnectFromEnv() *mongo.Database {
+	db, err := Connect(os.Getenv("MONGO_URI"), os.Getenv("DB_NAME"))
+	if err != nil {
+		log.Fatal("MongoDB connection error: ", err)
+	}
+	return db
+}
@@ -0,0 +1,53 @@
+// Package outbox queues email in the collection shared by the TradeMinutes services.
+// Only the auth service runs the delivery worker: it renders the template and sends the
+// email, retrying on failure, so the other services never send mail themselves.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection is the name of the shared outbox collection.
+const Collection = "email_outbox"
+
+// Statuses of a queued email.
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+)
+
+// Email is a queued email. The template is rendered at delivery time, so senders only
+// need to know the template name and its data.
+type Email struct {
+	ID            primitive.ObjectID     `bson:"_id,omitempty"`
+	To            string                 `bson:"to"`
+	Template      string                 `bson:"template"`
+	Data          map[string]interface{} `bson:"data"`
+	Status        string                 `bson:"status"`
+	Attempts      int                    `bson:"attempts"`
+	NextAttemptAt int64                  `bson:"nextAttemptAt"`
+	LockedUntil   int64                  `bson:"lockedUntil,omitempty"`
+	LastError     string                 `bson:"lastError,omitempty"`
+	CreatedAt     int64                  `bson:"createdAt"`
+	SentAt        int64                  `bson:"sentAt,omitempty"`
+}
+
+// Enqueue stores an email in collection for immediate delivery.
+func Enqueue(ctx context.Context, collection *mongo.Collection, to, template string, data map[string]interface{}) error {
+	now := time.Now().Unix()
+	_, err := collection.InsertOne(ctx, Email{
+		To:            to,
+		Template:      template,
+		Data:          data,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	return err
+}
@@ -5,6 +5,7 @@ import { useRouter } from "next/navigation";
 import { FiMail, FiArrowRight } from 'react-icons/fi';
 import { FaCheckCircle, FaGithub } from 'react-icons/fa';
 import { ImSpinner2 } from 'react-icons/im';
+import { errorMessage } from '@/lib/errors';
 
 export default function ForgotPasswordPage() {
   const router = useRouter();
@@ -28,9 +29,8 @@ export default function ForgotPasswordPage() {
           body: JSON.stringify({ email }),
         }
       );
-      const text = await res.text();
       if (!res.ok) {
-        throw new Error(text || "Failed to send reset link");
+        throw new Error(await errorMessage(res, "Failed to send reset link"));
       }
       setSuccess(true);
       setTimeout(() => router.push("/login"), 1800);
@@ -2,37 +2,34 @@
 
 import { useEffect } from 'react';
 import { useRouter } from 'next/navigation';
-import { useSession } from 'next-auth/react';
 
+// The auth service redirects here after the OAuth callback with the
+// session tokens in the URL fragment.
 export default function GitHubAuthPage() {
-  const { data: session, status } = useSession();
   const router = useRouter();
 
   useEffect(() => {
-    const exchangeToken = async () => {
-      if (status !== 'authenticated') return;
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    const token = params.get('token');
+    const refreshToken = params.get('refreshToken');
 
-      const res = await fetch(`${process.env.NEXT_PUBLIC_API_BASE_URL}/api/auth/github`, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({
-          email: session.user?.email,
-          name: session.user?.name,
-        }),
-      });
+    const challengeToken = params.get('challengeToken');
 
-      const data = await res.json();
-      if (data.token) {
-        localStorage.setItem('token', data.token);
-        router.push('/profile');
-      } else {
-        console.error('❌ Failed to get token from backend:', data);
-        router.push('/login');
-      }
-    };
-
-    exchangeToken();
-  }, [session, status, router]);
+    if (challengeToken) {
+      // The login page asks for the second factor
+      sessionStorage.setItem('twoFactorChallenge', challengeToken);
+      window.history.replaceState(null, '', window.location.pathname);
+      router.push('/login');
+    } else if (token) {
+      localStorage.setItem('token', token);
+      if (refreshToken) localStorage.setItem('refreshToken', refreshToken);
+      window.history.replaceState(null, '', window.location.pathname);
+      router.push('/profile');
+    } else {
+      console.error('❌ Token missing in GitHub callback');
+      router.push('/login');
+    }
+  }, [router]);
 
   return <p className="text-center mt-20 text-gray-500">⏳ Logging in with GitHub...</p>;
 }
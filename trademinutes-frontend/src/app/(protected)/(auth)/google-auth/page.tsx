@@ -2,52 +2,38 @@
 
 import { useEffect } from 'react';
 import { useRouter } from 'next/navigation';
-import { useSession } from 'next-auth/react';
 
+// The auth service redirects here after the OAuth callback with the
+// session tokens in the URL fragment.
 export default function GoogleAuthPage() {
   const router = useRouter();
-  const { data: session, status } = useSession();
 
   useEffect(() => {
-    const syncWithBackend = async () => {
-      if (status !== 'authenticated' || !session?.user?.email) return;
-
-      try {
-        const res = await fetch(`${process.env.NEXT_PUBLIC_API_BASE_URL}/api/auth/google`, {
-          method: 'POST',
-          headers: { 'Content-Type': 'application/json' },
-          body: JSON.stringify({
-            email: session.user.email,
-            name: session.user.name,
-          }),
-        });
-
-        const contentType = res.headers.get('content-type') || '';
-        const rawText = await res.text();
-
-        if (!contentType.includes('application/json')) {
-          console.error('❌ Invalid response:', rawText);
-          return;
-        }
-
-        const data = JSON.parse(rawText);
-        if (data.token) {
-          localStorage.setItem('token', data.token);
-          router.push('/profile');
-        } else {
-          console.error('❌ Token missing in response:', data);
-        }
-      } catch (error) {
-        console.error('❌ Google sync failed:', error);
-      }
-    };
-
-    syncWithBackend();
-  }, [session, status, router]);
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    const token = params.get('token');
+    const refreshToken = params.get('refreshToken');
+
+    const challengeToken = params.get('challengeToken');
+
+    if (challengeToken) {
+      // The login page asks for the second factor
+      sessionStorage.setItem('twoFactorChallenge', challengeToken);
+      window.history.replaceState(null, '', window.location.pathname);
+      router.push('/login');
+    } else if (token) {
+      localStorage.setItem('token', token);
+      if (refreshToken) localStorage.setItem('refreshToken', refreshToken);
+      window.history.replaceState(null, '', window.location.pathname);
+      router.push('/profile');
+    } else {
+      console.error('❌ Token missing in Google callback');
+      router.push('/login');
+    }
+  }, [router]);
 
   return (
     <div className="flex justify-center items-center min-h-screen">
-      <p className="text-gray-500 text-sm">⏳ Syncing with backend, please wait...</p>
+      <p className="text-gray-500 text-sm">⏳ Logging in with Google...</p>
     </div>
   );
 }
@@ -2,7 +2,6 @@
 
 import { useState, useEffect } from "react";
 import { useRouter } from "next/navigation";
-import { signIn } from "next-auth/react";
 import Navbar from "@/components/Navbar";
 import Footer from "@/components/Footer";
 import Testimonials from '@/components/Testimonials';
@@ -10,22 +9,33 @@ import { FiMail, FiLock, FiArrowRight, FiEye, FiEyeOff } from 'react-icons/fi';
 import { FcGoogle } from 'react-icons/fc';
 import { FaFacebookF, FaApple, FaGithub, FaCheckCircle } from 'react-icons/fa';
 import { ImSpinner2 } from 'react-icons/im';
+import { loginWithPasskey, passkeysSupported } from '@/lib/passkeys';
 
 export default function LoginPage() {
   const router = useRouter();
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
   const [error, setError] = useState("");
+  const [info, setInfo] = useState("");
   const [loginSuccess, setLoginSuccess] = useState(false);
   const [loading, setLoading] = useState(false);
   const [showPassword, setShowPassword] = useState(false);
   const [checkingAuth, setCheckingAuth] = useState(true);
+  // Set when the account has 2FA on and the first factor was accepted
+  const [challengeToken, setChallengeToken] = useState("");
+  const [twoFactorCode, setTwoFactorCode] = useState("");
 
   useEffect(() => {
     const token = localStorage.getItem("token");
     if (token) {
       router.replace("/dashboard");
     } else {
+      // OAuth and magic-link logins hand their 2FA challenge over to this page
+      const pending = sessionStorage.getItem("twoFactorChallenge");
+      if (pending) {
+        sessionStorage.removeItem("twoFactorChallenge");
+        setChallengeToken(pending);
+      }
       setCheckingAuth(false);
     }
   }, [router]);
@@ -80,8 +90,14 @@ export default function LoginPage() {
       const data = await res.json();
       console.log('✅ Login successful, token received:', !!data.token);
       
+      if (data.twoFactorRequired) {
+        setChallengeToken(data.challengeToken);
+        setLoading(false);
+        return;
+      }
       if (data.token) {
         localStorage.setItem("token", data.token);
+        if (data.refreshToken) localStorage.setItem("refreshToken", data.refreshToken);
         setLoginSuccess(true);
         setTimeout(() => router.push("/dashboard"), 1500);
       } else {
@@ -96,6 +112,79 @@ export default function LoginPage() {
     }
   };
 
+  const handleTwoFactor = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+    setLoading(true);
+    try {
+      const authUrl = process.env.NEXT_PUBLIC_AUTH_API_URL || 'http://localhost:8080';
+      const code = twoFactorCode.trim();
+      // Six digits come from the authenticator app; anything else is a recovery code
+      const body = /^\d{6}$/.test(code)
+        ? { challengeToken, code }
+        : { challengeToken, recoveryCode: code };
+      const res = await fetch(`${authUrl}/api/auth/login/2fa`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body),
+      });
+      const data = await res.json().catch(() => ({}));
+      if (!res.ok) {
+        if (res.status === 401 && data.error !== "Invalid code") {
+          // The challenge expired, so the first factor has to be given again
+          setChallengeToken("");
+          setTwoFactorCode("");
+        }
+        throw new Error(data.error || "Verification failed");
+      }
+      localStorage.setItem("token", data.token);
+      if (data.refreshToken) localStorage.setItem("refreshToken", data.refreshToken);
+      setLoginSuccess(true);
+      setTimeout(() => router.push("/dashboard"), 1500);
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Something went wrong");
+      setLoading(false);
+    }
+  };
+
+  const handleMagicLink = async () => {
+    setError("");
+    setInfo("");
+    if (!email) {
+      setError("Enter your email address to receive a login link.");
+      return;
+    }
+    try {
+      const authUrl = process.env.NEXT_PUBLIC_AUTH_API_URL || 'http://localhost:8080';
+      const res = await fetch(`${authUrl}/api/auth/magic-link`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ email }),
+      });
+      const data = await res.json().catch(() => ({}));
+      if (!res.ok) {
+        throw new Error(data.error || "Failed to send login link");
+      }
+      setInfo("Check your inbox for a login link.");
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Something went wrong");
+    }
+  };
+
+  const handlePasskeyLogin = async () => {
+    setError("");
+    setInfo("");
+    try {
+      const data = await loginWithPasskey();
+      localStorage.setItem("token", data.token);
+      if (data.refreshToken) localStorage.setItem("refreshToken", data.refreshToken);
+      setLoginSuccess(true);
+      setTimeout(() => router.push("/dashboard"), 1500);
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Passkey login failed");
+    }
+  };
+
   return (
     <main className="min-h-screen flex flex-col md:flex-row relative">
       {/* Loading Overlay */}
@@ -132,18 +221,73 @@ export default function LoginPage() {
               {error}
             </div>
           )}
+          {info && (
+            <div className="w-full mb-4 p-3 bg-green-50 border border-green-200 rounded-lg text-green-700 text-sm">
+              {info}
+            </div>
+          )}
           
           <button
-            onClick={() => signIn('github', { callbackUrl: '/dashboard' })}
+            onClick={() => {
+              const authUrl = process.env.NEXT_PUBLIC_AUTH_API_URL || 'http://localhost:8080';
+              window.location.href = `${authUrl}/api/auth/oauth/github/start`;
+            }}
             className="w-full flex items-center justify-center gap-2 border border-gray-200 rounded-full py-3 bg-white hover:bg-gray-50 transition-colors text-[#1a1446] font-medium text-lg mb-4"
           >
             <FaGithub className="text-2xl" /> Sign in with GitHub
           </button>
+          {passkeysSupported() && (
+            <button
+              type="button"
+              onClick={handlePasskeyLogin}
+              className="w-full flex items-center justify-center gap-2 border border-gray-200 rounded-full py-3 bg-white hover:bg-gray-50 transition-colors text-[#1a1446] font-medium text-lg mb-4"
+            >
+              <FiLock className="text-2xl text-[#22c55e]" /> Sign in with a passkey
+            </button>
+          )}
           <div className="flex items-center w-full my-2">
             <div className="flex-grow h-px bg-gray-200" />
             <span className="px-3 text-gray-400 text-sm">or Sign in with Email</span>
             <div className="flex-grow h-px bg-gray-200" />
           </div>
+          {challengeToken ? (
+          <form onSubmit={handleTwoFactor} className="space-y-5 w-full">
+            <div>
+              <label htmlFor="twoFactorCode" className="block text-sm font-medium mb-1 text-[#1a1446]">Authentication code<span className="text-[#22c55e]">*</span></label>
+              <p className="text-sm text-gray-500 mb-2">Enter the code from your authenticator app, or one of your recovery codes.</p>
+              <div className="flex items-center bg-white rounded-full border border-gray-200 px-5 py-3 focus-within:border-[#22c55e]">
+                <FiLock className="text-xl text-[#22c55e] mr-3" />
+                <input
+                  id="twoFactorCode"
+                  type="text"
+                  inputMode="numeric"
+                  autoComplete="one-time-code"
+                  placeholder="123456"
+                  value={twoFactorCode}
+                  onChange={(e) => setTwoFactorCode(e.target.value)}
+                  className="flex-1 bg-transparent outline-none text-[#1a1446] placeholder-gray-400 text-base"
+                  required
+                  disabled={loading}
+                />
+              </div>
+            </div>
+            <button
+              type="submit"
+              disabled={loading}
+              className="w-full bg-[#22c55e] hover:bg-[#16a34a] text-white font-semibold rounded-full py-3 mt-2 transition-colors duration-150 text-lg disabled:opacity-50 disabled:cursor-not-allowed"
+            >
+              {loading ? "Verifying..." : "Verify and log in"}
+            </button>
+            <button
+              type="button"
+              onClick={() => { setChallengeToken(""); setTwoFactorCode(""); setError(""); }}
+              disabled={loading}
+              className="w-full text-sm text-[#22c55e] hover:underline font-medium"
+            >
+              Back to login
+            </button>
+          </form>
+          ) : (
           <form onSubmit={handleLogin} className="space-y-5 w-full">
             <div>
               <label htmlFor="email" className="block text-sm font-medium mb-1 text-[#1a1446]">Email Address<span className="text-[#22c55e]">*</span></label>
@@ -200,7 +344,16 @@ export default function LoginPage() {
             >
               {loading ? "Logging in..." : "Login to TradeMinutes"}
             </button>
+            <button
+              type="button"
+              onClick={handleMagicLink}
+              disabled={loading}
+              className="w-full border border-[#22c55e] text-[#22c55e] hover:bg-[#f0fdf4] font-semibold rounded-full py-3 transition-colors duration-150 text-base disabled:opacity-50 disabled:cursor-not-allowed"
+            >
+              Email me a login link instead
+            </button>
           </form>
+          )}
           <p className="text-center text-sm mt-8 text-[#1a1446]">
             Don't have an account?{' '}
             <button
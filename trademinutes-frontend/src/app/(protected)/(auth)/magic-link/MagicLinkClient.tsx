@@ -0,0 +1,65 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { useRouter, useSearchParams } from "next/navigation";
+
+export default function MagicLinkClient() {
+  const router = useRouter();
+  const searchParams = useSearchParams();
+  const token = searchParams.get("token");
+
+  const [status, setStatus] = useState<"verifying" | "success" | "error">("verifying");
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    const exchange = async () => {
+      if (!token) {
+        setError("Login link is missing its token.");
+        setStatus("error");
+        return;
+      }
+
+      try {
+        const authUrl = process.env.NEXT_PUBLIC_AUTH_API_URL || 'http://localhost:8080';
+        const res = await fetch(`${authUrl}/api/auth/magic-link/verify`, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ token }),
+        });
+        const data = await res.json().catch(() => ({}));
+        if (!res.ok) {
+          throw new Error(data.error || "Failed to log in");
+        }
+        if (data.twoFactorRequired) {
+          // The login page asks for the second factor
+          sessionStorage.setItem("twoFactorChallenge", data.challengeToken);
+          router.push("/login");
+          return;
+        }
+        if (!data.token) {
+          throw new Error("No token received from server");
+        }
+
+        localStorage.setItem("token", data.token);
+        if (data.refreshToken) localStorage.setItem("refreshToken", data.refreshToken);
+        setStatus("success");
+        setTimeout(() => router.push("/dashboard"), 1200);
+      } catch (err: unknown) {
+        setError(err instanceof Error ? err.message : "Something went wrong.");
+        setStatus("error");
+      }
+    };
+
+    exchange();
+  }, [token, router]);
+
+  return (
+    <main className="min-h-screen flex items-center justify-center bg-white px-6">
+      {status === "verifying" && <p className="text-gray-500">⏳ Logging you in...</p>}
+      {status === "success" && <p className="text-lg font-semibold text-[#22c55e]">Logged in! Redirecting...</p>}
+      {status === "error" && (
+        <div className="p-3 bg-red-50 border border-red-200 rounded-lg text-red-600 text-sm">{error}</div>
+      )}
+    </main>
+  );
+}
@@ -0,0 +1,10 @@
+import { Suspense } from 'react';
+import MagicLinkClient from './MagicLinkClient';
+
+export default function MagicLinkPage() {
+  return (
+    <Suspense fallback={<div className="text-center p-8">Loading...</div>}>
+      <MagicLinkClient />
+    </Suspense>
+  );
+}
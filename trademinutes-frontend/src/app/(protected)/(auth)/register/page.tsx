@@ -1,11 +1,13 @@
 "use client";
 
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { useRouter } from "next/navigation";
 import Navbar from "@/components/Navbar";
 import Footer from "@/components/Footer";
-import { FiMail, FiLock, FiUser } from 'react-icons/fi';
+import { FiMail, FiLock, FiUser, FiGift } from 'react-icons/fi';
 import { FaCheckCircle } from 'react-icons/fa';
+import { passkeysSupported, signUpWithPasskey } from '@/lib/passkeys';
+import { errorMessage } from '@/lib/errors';
 
 function isValidEmail(email: string): boolean {
   return /^[^\s@]+@[^\s@]+\.[^\s@]+$/.test(email);
@@ -19,6 +21,13 @@ export default function RegisterPage() {
   const [error, setError] = useState("");
   const [success, setSuccess] = useState(false);
   const [loading, setLoading] = useState(false);
+  const [inviteCode, setInviteCode] = useState("");
+
+  // Invite links look like /register?invite=CODE
+  useEffect(() => {
+    const invite = new URLSearchParams(window.location.search).get("invite");
+    if (invite) setInviteCode(invite);
+  }, []);
 
   const handleRegister = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -36,12 +45,11 @@ export default function RegisterPage() {
         {
           method: "POST",
           headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({ name, email, password }),
+          body: JSON.stringify({ name, email, password, ...(inviteCode && { inviteCode }) }),
         }
       );
-      const data = await res.text();
       if (!res.ok) {
-        throw new Error(data || "Registration failed");
+        throw new Error(await errorMessage(res, "Registration failed"));
       }
       setSuccess(true);
       setTimeout(() => router.push("/login"), 1800);
@@ -54,6 +62,24 @@ export default function RegisterPage() {
     }
   };
 
+  const handlePasskeyRegister = async () => {
+    setError("");
+    if (!isValidEmail(email)) {
+      setError("Please enter a valid email address.");
+      return;
+    }
+    setLoading(true);
+    try {
+      await signUpWithPasskey(email, name, inviteCode);
+      setSuccess(true);
+      setTimeout(() => router.push("/login"), 1800);
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Passkey registration failed");
+    } finally {
+      setLoading(false);
+    }
+  };
+
   return (
     <>
       <main className="min-h-screen flex flex-col md:flex-row relative">
@@ -120,12 +146,28 @@ export default function RegisterPage() {
                     placeholder="Create a password"
                     value={password}
                     onChange={(e) => setPassword(e.target.value)}
+                    minLength={8}
                     className="flex-1 bg-transparent outline-none text-[#1a1446] placeholder-gray-400 text-base"
                     required
                     disabled={loading || success}
                   />
                 </div>
               </div>
+              <div>
+                <label htmlFor="inviteCode" className="block text-sm font-medium mb-1 text-[#1a1446]">Invite Code</label>
+                <div className="flex items-center bg-white rounded-full border border-gray-200 px-5 py-3 focus-within:border-[#22c55e]">
+                  <FiGift className="text-xl text-[#22c55e] mr-3" />
+                  <input
+                    id="inviteCode"
+                    type="text"
+                    placeholder="Optional"
+                    value={inviteCode}
+                    onChange={(e) => setInviteCode(e.target.value.toUpperCase())}
+                    className="flex-1 bg-transparent outline-none text-[#1a1446] placeholder-gray-400 text-base"
+                    disabled={loading || success}
+                  />
+                </div>
+              </div>
               <button
                 type="submit"
                 disabled={loading || success}
@@ -133,6 +175,16 @@ export default function RegisterPage() {
               >
                 {loading ? "Registering..." : "Register"}
               </button>
+              {passkeysSupported() && (
+                <button
+                  type="button"
+                  onClick={handlePasskeyRegister}
+                  disabled={loading || success}
+                  className="w-full border border-[#22c55e] text-[#22c55e] hover:bg-[#f0fdf4] font-semibold rounded-full py-3 transition-colors duration-150 text-base disabled:opacity-50 disabled:cursor-not-allowed"
+                >
+                  Use a passkey instead of a password
+                </button>
+              )}
             </form>
             <p className="text-center text-sm mt-8 text-[#1a1446]">
               Already have an account?{' '}
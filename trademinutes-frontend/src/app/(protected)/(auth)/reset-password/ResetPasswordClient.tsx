@@ -3,6 +3,7 @@
 import { useState } from "react";
 import { useRouter, useSearchParams } from "next/navigation";
 import { FiArrowRight } from 'react-icons/fi';
+import { errorMessage } from '@/lib/errors';
 
 export default function ResetPasswordClient() {
   const router = useRouter();
@@ -43,9 +44,8 @@ export default function ResetPasswordClient() {
           body: JSON.stringify({ token, newPassword: password }),
         }
       );
-      const text = await res.text();
       if (!res.ok) {
-        throw new Error(text || "Failed to reset password");
+        throw new Error(await errorMessage(res, "Failed to reset password"));
       }
       setSuccess(true);
       setTimeout(() => router.push("/login"), 1800);
@@ -96,6 +96,7 @@ export default function ResetPasswordClient() {
                 placeholder="Enter new password"
                 value={password}
                 onChange={(e) => setPassword(e.target.value)}
+                minLength={8}
                 className="w-full bg-white rounded-full border border-gray-200 px-5 py-3 outline-none text-[#1a1446] placeholder-gray-400 text-base focus:border-[#22c55e]"
                 required
                 disabled={loading || success}
@@ -0,0 +1,53 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { useRouter, useSearchParams } from "next/navigation";
+
+export default function VerifyEmailClient() {
+  const router = useRouter();
+  const searchParams = useSearchParams();
+  const token = searchParams.get("token");
+
+  const [status, setStatus] = useState<"verifying" | "success" | "error">("verifying");
+  const [error, setError] = useState("");
+
+  useEffect(() => {
+    const verify = async () => {
+      if (!token) {
+        setError("Verification token missing.");
+        setStatus("error");
+        return;
+      }
+
+      try {
+        const authUrl = process.env.NEXT_PUBLIC_AUTH_API_URL || 'http://localhost:8080';
+        const res = await fetch(`${authUrl}/api/auth/verify-email`, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ token }),
+        });
+        if (!res.ok) {
+          const data = await res.json().catch(() => ({}));
+          throw new Error(data.error || "Failed to verify email");
+        }
+        setStatus("success");
+        setTimeout(() => router.push("/login"), 1800);
+      } catch (err: unknown) {
+        setError(err instanceof Error ? err.message : "Something went wrong.");
+        setStatus("error");
+      }
+    };
+
+    verify();
+  }, [token, router]);
+
+  return (
+    <main className="min-h-screen flex items-center justify-center bg-white px-6">
+      {status === "verifying" && <p className="text-gray-500">⏳ Verifying your email...</p>}
+      {status === "success" && <p className="text-lg font-semibold text-[#22c55e]">Email verified! Redirecting to login...</p>}
+      {status === "error" && (
+        <div className="p-3 bg-red-50 border border-red-200 rounded-lg text-red-600 text-sm">{error}</div>
+      )}
+    </main>
+  );
+}
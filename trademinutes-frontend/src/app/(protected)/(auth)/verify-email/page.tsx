@@ -0,0 +1,10 @@
+import { Suspense } from 'react';
+import VerifyEmailClient from './VerifyEmailClient';
+
+export default function VerifyEmailPage() {
+  return (
+    <Suspense fallback={<div className="text-center p-8">Loading...</div>}>
+      <VerifyEmailClient />
+    </Suspense>
+  );
+}
@@ -2,6 +2,7 @@
 
 import { useEffect, useState } from "react";
 import ProtectedLayout from "@/components/Layout/ProtectedLayout";
+import { errorMessage } from "@/lib/errors";
 import { useRouter } from "next/navigation";
 import { toast, ToastContainer } from "react-toastify";
 import "react-toastify/dist/ReactToastify.css";
@@ -192,7 +193,7 @@ export default function AppointmentsPage() {
         })
       });
       if (!res.ok) {
-        const errorText = await res.text();
+        const errorText = await errorMessage(res, "Unknown error");
         setDialog({ open: true, message: `Failed to start conversation: ${errorText}`, isError: true });
         setSendingFirstMessage(false);
         return;
@@ -218,7 +219,7 @@ export default function AppointmentsPage() {
         })
       });
       if (!messageRes.ok) {
-        const errorText = await messageRes.text();
+        const errorText = await errorMessage(messageRes, "Unknown error");
         setDialog({ open: true, message: `Failed to send message: ${errorText}`, isError: true });
         setSendingFirstMessage(false);
         return;
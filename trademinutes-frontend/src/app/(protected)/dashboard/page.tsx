@@ -5,6 +5,7 @@ import { useRouter } from "next/navigation";
 import Image from "next/image";
 import dynamic from "next/dynamic";
 import ProtectedLayout from "@/components/Layout/ProtectedLayout";
+import { errorMessage } from "@/lib/errors";
 import { FaTasks, FaListAlt, FaBook, FaHashtag } from "react-icons/fa";
 
 const Map = dynamic(() => import("@/components/OpenStreetMap"), { ssr: false });
@@ -135,8 +136,7 @@ export default function ProfileDashboardPage() {
     });
 
     if (!res.ok) {
-      const msg = await res.text();
-      throw new Error(msg || "Update failed");
+      throw new Error(await errorMessage(res, "Update failed"));
     }
   };
 
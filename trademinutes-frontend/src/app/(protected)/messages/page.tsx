@@ -65,7 +65,9 @@ export default function MessagesPage() {
   useEffect(() => {
     if (!currentUser?.email) return;
 
-    const wsUrl = `${process.env.NEXT_PUBLIC_MESSAGING_WS_URL || 'ws://localhost:8085'}/ws?userId=${currentUser.email}`;
+    // Browsers cannot set headers on a WebSocket, so the token goes in the URL
+    const token = localStorage.getItem("token") || "";
+    const wsUrl = `${process.env.NEXT_PUBLIC_MESSAGING_WS_URL || 'ws://localhost:8085'}/ws?token=${encodeURIComponent(token)}`;
     const websocket = new WebSocket(wsUrl);
 
     websocket.onopen = () => {
@@ -103,7 +105,8 @@ export default function MessagesPage() {
       console.log("Fetching conversations for:", currentUser.email);
       try {
         const response = await fetch(
-          `${process.env.NEXT_PUBLIC_MESSAGING_API_URL || 'http://localhost:8085'}/api/conversations?userId=${currentUser.email}`
+          `${process.env.NEXT_PUBLIC_MESSAGING_API_URL || 'http://localhost:8085'}/api/conversations`,
+          { headers: { Authorization: `Bearer ${localStorage.getItem("token")}` } }
         );
         if (response.ok) {
           const data = await response.json();
@@ -127,7 +130,8 @@ export default function MessagesPage() {
       try {
         console.log("Fetching messages for conversation:", selectedConv);
         const response = await fetch(
-          `${process.env.NEXT_PUBLIC_MESSAGING_API_URL || 'http://localhost:8085'}/api/conversations/${selectedConv}/messages`
+          `${process.env.NEXT_PUBLIC_MESSAGING_API_URL || 'http://localhost:8085'}/api/conversations/${selectedConv}/messages`,
+          { headers: { Authorization: `Bearer ${localStorage.getItem("token")}` } }
         );
         if (response.ok) {
           const data = await response.json();
@@ -283,7 +287,8 @@ export default function MessagesPage() {
         {
           method: "POST",
           headers: {
-            "Content-Type": "application/json"
+            "Content-Type": "application/json",
+            Authorization: `Bearer ${localStorage.getItem("token")}`
           },
           body: JSON.stringify(newConversation)
         }
@@ -293,7 +298,8 @@ export default function MessagesPage() {
         const conversationId = await response.text();
         // Refresh conversations
         const convResponse = await fetch(
-          `${process.env.NEXT_PUBLIC_MESSAGING_API_URL || 'http://localhost:8085'}/api/conversations?userId=${currentUser.id}`
+          `${process.env.NEXT_PUBLIC_MESSAGING_API_URL || 'http://localhost:8085'}/api/conversations`,
+          { headers: { Authorization: `Bearer ${localStorage.getItem("token")}` } }
         );
         if (convResponse.ok) {
           const data = await convResponse.json();
@@ -64,6 +64,7 @@ export default function UserProfileSummaryPage() {
     Phone?: string;
     Address?: string;
     ID?: string;
+    studentVerification?: { institution: string };
   } | null>(null);
   const [loading, setLoading] = useState(true);
   const [reviews, setReviews] = useState<any[]>([]);
@@ -169,6 +170,9 @@ export default function UserProfileSummaryPage() {
               <Image src="/categories-banner.png" alt="User" width={96} height={96} className="rounded-full border-4 border-white object-cover w-24 h-24" />
               <h2 className="text-xl font-bold mt-2 text-center">{profile.Name || 'TradeMinutes User'}</h2>
               <div className="text-xs text-gray-500 text-center">Marketplace Member</div>
+              {profile.studentVerification && (
+                <div className="text-xs font-semibold text-emerald-600 text-center">✓ Verified student · {profile.studentVerification.institution}</div>
+              )}
               <div className="text-xs text-gray-500 text-center">User ID: TM-{profile.Email?.split('@')[0]}</div>
               <button className="mt-2 px-4 py-1 rounded-full bg-[#6c63ff] text-white font-semibold text-sm hover:bg-[#554ee1] transition">Edit</button>
             </div>
@@ -1,5 +1,8 @@
 import React from "react";
 import ProtectedLayout from "@/components/Layout/ProtectedLayout";
+import PasskeySettings from "@/components/PasskeySettings";
+import InviteFriends from "@/components/InviteFriends";
+import StudentVerification from "@/components/StudentVerification";
 
 export default function SettingsPage() {
   return (
@@ -21,12 +24,24 @@ export default function SettingsPage() {
               </div>
             </div>
           </section>
+          {/* Student Status Section */}
+          <section className="bg-white/80 rounded-xl shadow p-6 border border-gray-200">
+            <h2 className="text-xl font-semibold mb-2">Student Status</h2>
+            <p className="text-gray-600 mb-4">Verify your college email to get a verified-student badge on your profile and tasks.</p>
+            <StudentVerification />
+          </section>
           {/* Account Section */}
           <section className="bg-white/80 rounded-xl shadow p-6 border border-gray-200">
             <h2 className="text-xl font-semibold mb-2">Account</h2>
             <p className="text-gray-600 mb-4">Manage your account settings.</p>
             <button className="bg-red-500 text-white px-4 py-2 rounded hover:bg-red-600">Delete Account</button>
           </section>
+          {/* Invite Section */}
+          <section className="bg-white/80 rounded-xl shadow p-6 border border-gray-200">
+            <h2 className="text-xl font-semibold mb-2">Invite Friends</h2>
+            <p className="text-gray-600 mb-4">You and your friend both earn bonus credits when they complete their first booking.</p>
+            <InviteFriends />
+          </section>
           {/* Notifications Section */}
           <section className="bg-white/80 rounded-xl shadow p-6 border border-gray-200">
             <h2 className="text-xl font-semibold mb-2">Notifications</h2>
@@ -47,6 +62,7 @@ export default function SettingsPage() {
             <h2 className="text-xl font-semibold mb-2">Security</h2>
             <p className="text-gray-600 mb-4">Change your password or enable 2FA.</p>
             <button className="bg-emerald-500 text-white px-4 py-2 rounded hover:bg-emerald-600" disabled>Change Password</button>
+            <PasskeySettings />
           </section>
         </div>
       </div>
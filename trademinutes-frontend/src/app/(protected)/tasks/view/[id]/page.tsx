@@ -5,6 +5,7 @@ import { useParams, useRouter } from "next/navigation";
 import Link from "next/link";
 import Image from "next/image";
 import ProtectedLayout from "@/components/Layout/ProtectedLayout";
+import { errorMessage } from "@/lib/errors";
 import { toast, ToastContainer } from "react-toastify";
 import "react-toastify/dist/ReactToastify.css";
 
@@ -19,6 +20,8 @@ interface Author {
   name: string;
   email: string;
   avatar: string;
+  verifiedStudent?: boolean;
+  institution?: string;
 }
 
 interface Task {
@@ -57,6 +60,8 @@ function normalizeTask(raw: any): Task {
           name: raw.Author.Name,
           email: raw.Author.Email,
           avatar: raw.Author.Avatar,
+          verifiedStudent: raw.Author.verifiedStudent,
+          institution: raw.Author.institution,
         }
       : undefined,
     createdAt: raw.CreatedAt,
@@ -336,6 +341,8 @@ export default function ViewTaskPage() {
       },
       status: "pending",
     };
+    // Lets the server recognise a retried request instead of booking twice
+    const idempotencyKey = crypto.randomUUID();
 
     try {
       const res = await fetch(`${API_BASE_URL}/api/bookings/book`, {
@@ -343,6 +350,7 @@ export default function ViewTaskPage() {
         headers: {
           "Content-Type": "application/json",
           Authorization: `Bearer ${token}`,
+          "Idempotency-Key": idempotencyKey,
         },
         body: JSON.stringify(requestBody),
       });
@@ -407,7 +415,7 @@ export default function ViewTaskPage() {
         })
       });
       if (!res.ok) {
-        const errorText = await res.text();
+        const errorText = await errorMessage(res, "Unknown error");
         setDialog({ open: true, message: `Failed to start conversation: ${errorText}`, isError: true });
         setSendingFirstMessage(false);
         return;
@@ -433,7 +441,7 @@ export default function ViewTaskPage() {
         })
       });
       if (!messageRes.ok) {
-        const errorText = await messageRes.text();
+        const errorText = await errorMessage(messageRes, "Unknown error");
         setDialog({ open: true, message: `Failed to send message: ${errorText}`, isError: true });
         setSendingFirstMessage(false);
         return;
@@ -483,12 +491,10 @@ export default function ViewTaskPage() {
       const cancelRes = await fetch(`${API_BASE_URL}/api/bookings/cancel`, {
         method: "POST",
         headers: { "Content-Type": "application/json", Authorization: `Bearer ${token}` },
-        body: JSON.stringify({ bookingId, cancelledBy: "booker" }),
+        body: JSON.stringify({ bookingId }),
       });
       if (!cancelRes.ok) {
-        let err;
-        try { err = JSON.parse(await cancelRes.clone().text()); } catch { err = { message: await cancelRes.clone().text() }; }
-        throw new Error(err.message || "Failed to cancel booking");
+        throw new Error(await errorMessage(cancelRes, "Failed to cancel booking"));
       }
       toast.success("Booking cancelled successfully!");
       setAlreadyBooked(false);
@@ -547,6 +553,9 @@ export default function ViewTaskPage() {
               />
               <div>
                 <div className="font-semibold text-lg text-gray-800">{task.author.name}</div>
+                {task.author.verifiedStudent && (
+                  <div className="text-xs font-semibold text-emerald-600">✓ Verified student · {task.author.institution}</div>
+                )}
                 <div className="text-gray-500 text-sm">{task.author.email}</div>
               </div>
             </div>
@@ -0,0 +1,47 @@
+"use client";
+
+import { useEffect, useState } from "react";
+
+type Impersonation = {
+  email: string;
+  actor: string;
+  readOnly: boolean;
+};
+
+// ImpersonationBanner makes it obvious when the stored token is an admin impersonation
+// token, which carries an "act" claim naming the admin.
+export default function ImpersonationBanner() {
+  const [impersonation, setImpersonation] = useState<Impersonation | null>(null);
+
+  useEffect(() => {
+    const token = localStorage.getItem("token");
+    if (!token) return;
+    try {
+      const payload = JSON.parse(atob(token.split(".")[1].replace(/-/g, "+").replace(/_/g, "/")));
+      if (payload.act) {
+        setImpersonation({ email: payload.email, actor: payload.act.email, readOnly: payload.readonly !== false });
+      }
+    } catch {
+      setImpersonation(null);
+    }
+  }, []);
+
+  const handleExit = () => {
+    localStorage.removeItem("token");
+    window.location.href = "/login";
+  };
+
+  if (!impersonation) return null;
+
+  return (
+    <div className="mb-4 flex items-center justify-between rounded-lg bg-amber-100 border border-amber-300 px-4 py-2 text-sm text-amber-900">
+      <span>
+        You are viewing TradeMinutes as <strong>{impersonation.email}</strong> (impersonated by {impersonation.actor}
+        {impersonation.readOnly ? ", read-only" : ""}).
+      </span>
+      <button onClick={handleExit} className="font-semibold hover:underline">
+        Exit
+      </button>
+    </div>
+  );
+}
@@ -0,0 +1,73 @@
+"use client";
+
+import { useEffect, useState } from "react";
+
+type Referral = {
+  name: string;
+  status: "pending" | "rewarded";
+  bonus: number;
+  createdAt: number;
+};
+
+type Referrals = {
+  inviteCode: string;
+  inviteLink: string;
+  referrals: Referral[];
+  creditsEarned: number;
+};
+
+export default function InviteFriends() {
+  const [data, setData] = useState<Referrals | null>(null);
+  const [copied, setCopied] = useState(false);
+  const authUrl = process.env.NEXT_PUBLIC_AUTH_API_URL || "http://localhost:8080";
+
+  useEffect(() => {
+    const token = localStorage.getItem("token");
+    if (!token) return;
+    fetch(`${authUrl}/api/auth/referrals`, {
+      headers: { Authorization: `Bearer ${token}` },
+    })
+      .then((res) => (res.ok ? res.json() : null))
+      .then(setData)
+      .catch(() => setData(null));
+  }, [authUrl]);
+
+  const handleCopy = async () => {
+    if (!data) return;
+    await navigator.clipboard.writeText(data.inviteLink);
+    setCopied(true);
+    setTimeout(() => setCopied(false), 1500);
+  };
+
+  if (!data) return null;
+
+  return (
+    <div className="flex flex-col gap-3">
+      <div className="flex gap-2">
+        <input
+          type="text"
+          value={data.inviteLink}
+          readOnly
+          className="flex-1 rounded-md border-gray-300 shadow-sm focus:ring-emerald-400 focus:border-emerald-400"
+        />
+        <button onClick={handleCopy} className="bg-emerald-500 text-white px-4 py-2 rounded hover:bg-emerald-600">
+          {copied ? "Copied" : "Copy link"}
+        </button>
+      </div>
+      <p className="text-sm text-gray-600">
+        Your invite code is <span className="font-mono font-semibold">{data.inviteCode}</span>. You have earned{" "}
+        {data.creditsEarned} credits from referrals.
+      </p>
+      {data.referrals.map((r, i) => (
+        <div key={i} className="flex items-center justify-between text-sm">
+          <span>
+            {r.name || "A new member"} · joined {new Date(r.createdAt * 1000).toLocaleDateString()}
+          </span>
+          <span className={r.status === "rewarded" ? "text-emerald-600" : "text-gray-400"}>
+            {r.status === "rewarded" ? `+${r.bonus} credits` : "Waiting for first booking"}
+          </span>
+        </div>
+      ))}
+    </div>
+  );
+}
@@ -6,6 +6,8 @@ import Sidebar from "../common/Sidebar";
 import { NotificationBell } from "../common/Sidebar";
 import { useSession } from "next-auth/react";
 import { FiPlusCircle } from "react-icons/fi";
+import ImpersonationBanner from "../ImpersonationBanner";
+import { clearSession } from "@/lib/session";
 
 interface LayoutProps {
   children: ReactNode;
@@ -102,6 +104,7 @@ export default function ProtectedLayout({ children, headerName }: LayoutProps) {
 
       {/* Main content */}
       <main className="flex-1 p-6 ">
+        <ImpersonationBanner />
         <TopBar realTimeActivities={realTimeActivities} loadingActivities={loadingActivities} />
         {children}
       </main>
@@ -118,7 +121,7 @@ function TopBar({ realTimeActivities, loadingActivities }: { realTimeActivities:
   const dropdownRef = useRef<HTMLDivElement>(null);
   const router = useRouter();
   const handleLogout = () => {
-    localStorage.removeItem("token");
+    clearSession();
     router.push("/login");
   };
 
@@ -0,0 +1,88 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { passkeysSupported, registerPasskey } from "@/lib/passkeys";
+
+type Passkey = {
+  id: string;
+  name: string;
+  createdAt: number;
+  lastUsedAt?: number;
+};
+
+export default function PasskeySettings() {
+  const [passkeys, setPasskeys] = useState<Passkey[]>([]);
+  const [name, setName] = useState("");
+  const [error, setError] = useState("");
+  const authUrl = process.env.NEXT_PUBLIC_AUTH_API_URL || "http://localhost:8080";
+
+  const load = async () => {
+    const token = localStorage.getItem("token");
+    if (!token) return;
+    const res = await fetch(`${authUrl}/api/auth/passkeys`, {
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (res.ok) setPasskeys(await res.json());
+  };
+
+  useEffect(() => {
+    load();
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
+
+  const handleAdd = async () => {
+    setError("");
+    try {
+      await registerPasskey(localStorage.getItem("token") || "", name);
+      setName("");
+      load();
+    } catch (err: unknown) {
+      setError(err instanceof Error ? err.message : "Failed to add passkey");
+    }
+  };
+
+  const handleRemove = async (id: string) => {
+    setError("");
+    const res = await fetch(`${authUrl}/api/auth/passkeys/${id}`, {
+      method: "DELETE",
+      headers: { Authorization: `Bearer ${localStorage.getItem("token")}` },
+    });
+    if (!res.ok) {
+      const data = await res.json().catch(() => ({}));
+      setError(data.error || "Failed to remove passkey");
+      return;
+    }
+    load();
+  };
+
+  if (!passkeysSupported()) return null;
+
+  return (
+    <div className="mt-4 flex flex-col gap-3">
+      <h3 className="font-medium">Passkeys</h3>
+      {error && <p className="text-sm text-red-600">{error}</p>}
+      {passkeys.map((p) => (
+        <div key={p.id} className="flex items-center justify-between text-sm">
+          <span>
+            {p.name} · added {new Date(p.createdAt * 1000).toLocaleDateString()}
+          </span>
+          <button onClick={() => handleRemove(p.id)} className="text-red-500 hover:underline">
+            Remove
+          </button>
+        </div>
+      ))}
+      <div className="flex gap-2">
+        <input
+          type="text"
+          value={name}
+          onChange={(e) => setName(e.target.value)}
+          placeholder="Passkey name, e.g. My laptop"
+          className="flex-1 rounded-md border-gray-300 shadow-sm focus:ring-emerald-400 focus:border-emerald-400"
+        />
+        <button onClick={handleAdd} className="bg-emerald-500 text-white px-4 py-2 rounded hover:bg-emerald-600">
+          Add a passkey
+        </button>
+      </div>
+    </div>
+  );
+}
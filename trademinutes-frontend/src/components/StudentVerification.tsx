@@ -0,0 +1,118 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { errorMessage } from "@/lib/errors";
+
+type Verification = {
+  institution: string;
+  email: string;
+  verifiedAt: number;
+};
+
+export default function StudentVerification() {
+  const [verification, setVerification] = useState<Verification | null>(null);
+  const [email, setEmail] = useState("");
+  const [code, setCode] = useState("");
+  const [codeSent, setCodeSent] = useState(false);
+  const [message, setMessage] = useState("");
+  const [error, setError] = useState("");
+  const profileUrl = process.env.NEXT_PUBLIC_PROFILE_API_URL || "http://localhost:8081";
+
+  const request = (path: string, method: string, body?: unknown) =>
+    fetch(`${profileUrl}/api/profile${path}`, {
+      method,
+      headers: {
+        "Content-Type": "application/json",
+        Authorization: `Bearer ${localStorage.getItem("token")}`,
+      },
+      body: body ? JSON.stringify(body) : undefined,
+    });
+
+  useEffect(() => {
+    if (!localStorage.getItem("token")) return;
+    request("/get", "GET")
+      .then((res) => (res.ok ? res.json() : null))
+      .then((data) => setVerification(data?.studentVerification || null))
+      .catch(() => setVerification(null));
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
+
+  const handleSendCode = async () => {
+    setError("");
+    setMessage("");
+    const res = await request("/institution/verify", "POST", { email });
+    if (!res.ok) {
+      setError(await errorMessage(res, "Failed to send code"));
+      return;
+    }
+    const data = await res.json();
+    setCodeSent(true);
+    setMessage(`We sent a code to ${email} to confirm you study at ${data.institution}.`);
+  };
+
+  const handleConfirm = async () => {
+    setError("");
+    const res = await request("/institution/confirm", "POST", { code });
+    if (!res.ok) {
+      setError(await errorMessage(res, "Verification failed"));
+      return;
+    }
+    setVerification(await res.json());
+    setCodeSent(false);
+    setCode("");
+    setMessage("");
+  };
+
+  const handleRemove = async () => {
+    setError("");
+    const res = await request("/institution", "DELETE");
+    if (res.ok) setVerification(null);
+  };
+
+  if (verification) {
+    return (
+      <div className="flex items-center justify-between text-sm">
+        <span>
+          <span className="text-emerald-600 font-semibold">✓ Verified student</span> at {verification.institution} ({verification.email})
+        </span>
+        <button onClick={handleRemove} className="text-red-500 hover:underline">
+          Remove
+        </button>
+      </div>
+    );
+  }
+
+  return (
+    <div className="flex flex-col gap-3">
+      {error && <p className="text-sm text-red-600">{error}</p>}
+      {message && <p className="text-sm text-gray-600">{message}</p>}
+      <div className="flex gap-2">
+        <input
+          type="email"
+          value={email}
+          onChange={(e) => setEmail(e.target.value)}
+          placeholder="Your college email, e.g. name@ucl.ac.uk"
+          className="flex-1 rounded-md border-gray-300 shadow-sm focus:ring-emerald-400 focus:border-emerald-400"
+        />
+        <button onClick={handleSendCode} className="bg-emerald-500 text-white px-4 py-2 rounded hover:bg-emerald-600">
+          {codeSent ? "Resend code" : "Send code"}
+        </button>
+      </div>
+      {codeSent && (
+        <div className="flex gap-2">
+          <input
+            type="text"
+            inputMode="numeric"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+            placeholder="6-digit code"
+            className="flex-1 rounded-md border-gray-300 shadow-sm focus:ring-emerald-400 focus:border-emerald-400"
+          />
+          <button onClick={handleConfirm} className="bg-emerald-500 text-white px-4 py-2 rounded hover:bg-emerald-600">
+            Verify
+          </button>
+        </div>
+      )}
+    </div>
+  );
+}
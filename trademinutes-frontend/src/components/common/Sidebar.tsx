@@ -7,6 +7,7 @@ import { FiLogOut, FiSettings } from "react-icons/fi";
 import { FaRegCalendarAlt, FaUserAlt } from "react-icons/fa";
 import Link from "next/link";
 import { BellIcon } from "@heroicons/react/24/outline";
+import { clearSession } from "@/lib/session";
 import { ChevronDownIcon, ChevronUpIcon } from "@heroicons/react/24/outline";
 
 interface Notification {
@@ -160,7 +161,7 @@ export default function Sidebar() {
   const pathname = usePathname();
 
   const handleLogout = () => {
-    localStorage.removeItem("token");
+    clearSession();
     router.push("/login");
   };
 
@@ -1,7 +1,10 @@
 'use client';
 
 import { SessionProvider } from "next-auth/react";
+import { installTokenRefresh } from "@/lib/session";
 
 export default function SessionWrapper({ children }: { children: React.ReactNode }) {
+  // Installed while rendering, before any child effect fetches with the access token
+  installTokenRefresh();
   return <SessionProvider>{children}</SessionProvider>;
 }
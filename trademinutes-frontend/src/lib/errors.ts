@@ -0,0 +1,9 @@
+// The backend services answer failed requests with a JSON body of the form { "error": "..." }.
+export async function errorMessage(res: Response, fallback: string): Promise<string> {
+  const text = await res.text().catch(() => '');
+  try {
+    const data = JSON.parse(text);
+    if (data && typeof data.error === 'string') return data.error;
+  } catch {}
+  return text || fallback;
+}
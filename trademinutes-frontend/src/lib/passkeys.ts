@@ -0,0 +1,97 @@
+// Helpers for the WebAuthn ceremonies exposed by the auth service under /api/auth/passkeys.
+// The server sends binary fields as base64url strings, which the browser API needs as ArrayBuffers.
+
+const authUrl = () => process.env.NEXT_PUBLIC_AUTH_API_URL || 'http://localhost:8080';
+
+function fromBase64url(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/').padEnd(Math.ceil(value.length / 4) * 4, '=');
+  const bytes = Uint8Array.from(atob(base64), (c) => c.charCodeAt(0));
+  return bytes.buffer;
+}
+
+function toBase64url(buffer: ArrayBuffer | null): string | undefined {
+  if (!buffer) return undefined;
+  const bytes = new Uint8Array(buffer);
+  let binary = '';
+  bytes.forEach((b) => (binary += String.fromCharCode(b)));
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+async function post(path: string, body: unknown, token?: string) {
+  const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+  if (token) headers.Authorization = `Bearer ${token}`;
+  const res = await fetch(`${authUrl()}/api/auth/passkeys${path}`, {
+    method: 'POST',
+    headers,
+    body: JSON.stringify(body ?? {}),
+  });
+  const data = await res.json().catch(() => ({}));
+  if (!res.ok) throw new Error(data.error || 'Passkey request failed');
+  return data;
+}
+
+export function passkeysSupported(): boolean {
+  return typeof window !== 'undefined' && !!window.PublicKeyCredential;
+}
+
+// eslint-disable-next-line @typescript-eslint/no-explicit-any
+async function create(options: any) {
+  const publicKey = options.publicKey;
+  publicKey.challenge = fromBase64url(publicKey.challenge);
+  publicKey.user.id = fromBase64url(publicKey.user.id);
+  publicKey.excludeCredentials = (publicKey.excludeCredentials || []).map(
+    (c: { id: string; type: string }) => ({ ...c, id: fromBase64url(c.id) })
+  );
+  const credential = (await navigator.credentials.create({ publicKey })) as PublicKeyCredential;
+  const response = credential.response as AuthenticatorAttestationResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64url(response.clientDataJSON),
+      attestationObject: toBase64url(response.attestationObject),
+      transports: response.getTransports ? response.getTransports() : [],
+    },
+  };
+}
+
+// eslint-disable-next-line @typescript-eslint/no-explicit-any
+async function get(options: any) {
+  const publicKey = options.publicKey;
+  publicKey.challenge = fromBase64url(publicKey.challenge);
+  const credential = (await navigator.credentials.get({ publicKey })) as PublicKeyCredential;
+  const response = credential.response as AuthenticatorAssertionResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64url(response.clientDataJSON),
+      authenticatorData: toBase64url(response.authenticatorData),
+      signature: toBase64url(response.signature),
+      userHandle: toBase64url(response.userHandle),
+    },
+  };
+}
+
+// loginWithPasskey runs a discoverable login and returns the issued token pair.
+export async function loginWithPasskey(): Promise<{ token: string; refreshToken: string }> {
+  const { ceremonyId, options } = await post('/login/begin', {});
+  const credential = await get(options);
+  return post('/login/finish', { ceremonyId, credential });
+}
+
+// registerPasskey adds a passkey to the account of the logged-in user.
+export async function registerPasskey(token: string, name: string) {
+  const { ceremonyId, options } = await post('/register/begin', {}, token);
+  const credential = await create(options);
+  return post('/register/finish', { ceremonyId, name, credential }, token);
+}
+
+// signUpWithPasskey creates an account that logs in with a passkey instead of a password.
+export async function signUpWithPasskey(email: string, name: string, inviteCode?: string) {
+  const { ceremonyId, options } = await post('/signup/begin', { email, name, inviteCode });
+  const credential = await create(options);
+  return post('/signup/finish', { ceremonyId, credential });
+}
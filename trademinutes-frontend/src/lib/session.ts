@@ -0,0 +1,79 @@
+// Access tokens expire after 15 minutes. Requests sent with the stored access token that
+// come back 401 exchange the refresh token for a new pair once and are retried with it.
+
+const authUrl = process.env.NEXT_PUBLIC_AUTH_API_URL || "http://localhost:8080";
+
+let refreshing: Promise<string | null> | null = null;
+
+// isImpersonation reports whether a token was issued to an admin acting as a user. The
+// stored refresh token belongs to the admin, so such tokens are never renewed with it.
+function isImpersonation(token: string): boolean {
+  try {
+    const payload = JSON.parse(atob(token.split(".")[1].replace(/-/g, "+").replace(/_/g, "/")));
+    return !!payload.act;
+  } catch {
+    return false;
+  }
+}
+
+// refreshAccessToken renews the stored token pair, sharing one request between callers.
+// It resolves to the new access token, or null once the session can no longer be renewed.
+export function refreshAccessToken(): Promise<string | null> {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const refreshToken = localStorage.getItem("refreshToken");
+      if (!refreshToken) return null;
+      try {
+        const res = await originalFetch(`${authUrl}/api/auth/refresh`, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({ refreshToken }),
+        });
+        if (!res.ok) {
+          if (res.status === 401) localStorage.removeItem("refreshToken");
+          return null;
+        }
+        const data = await res.json();
+        localStorage.setItem("token", data.token);
+        localStorage.setItem("refreshToken", data.refreshToken);
+        return data.token as string;
+      } catch {
+        return null;
+      }
+    })().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
+// clearSession forgets the stored token pair, e.g. on logout.
+export function clearSession() {
+  localStorage.removeItem("token");
+  localStorage.removeItem("refreshToken");
+}
+
+let originalFetch: typeof fetch;
+
+// installTokenRefresh wraps window.fetch so that every request made with the stored
+// access token is renewed transparently. It is safe to call more than once.
+export function installTokenRefresh() {
+  if (typeof window === "undefined" || originalFetch) return;
+  originalFetch = window.fetch.bind(window);
+
+  window.fetch = async (input: RequestInfo | URL, init?: RequestInit) => {
+    const res = await originalFetch(input, init);
+    if (res.status !== 401 || input instanceof Request) return res;
+
+    const headers = new Headers(init?.headers);
+    const token = localStorage.getItem("token");
+    if (!token || headers.get("Authorization") !== `Bearer ${token}` || isImpersonation(token)) {
+      return res;
+    }
+
+    const renewed = await refreshAccessToken();
+    if (!renewed) return res;
+    headers.set("Authorization", `Bearer ${renewed}`);
+    return originalFetch(input, { ...init, headers });
+  };
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/ElioCloud/trademinutes-common/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var DB *mongo.Database
+
+func ConnectDB() {
+	DB = mongodb.MustConnectFromEnv()
+	fmt.Println("Connected to MongoDB")
+}
+
+func GetDB() *mongo.Database {
+	return DB
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"trademinutes-gateway/config"
+	"trademinutes-gateway/middleware"
+	"trademinutes-gateway/proxy"
+
+	"github.com/ElioCloud/trademinutes-common/env"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+)
+
+func main() {
+	// Load .env
+	env.Load()
+	env.MustRequire("MONGO_URI", "DB_NAME", "INTERNAL_API_TOKEN")
+
+	// API tokens, sessions and impersonations are looked up in the shared database
+	config.ConnectDB()
+	fmt.Println("✅ Connected to MongoDB:", config.GetDB().Name())
+
+	proxies := httpx.TrustedProxies()
+	limiter := middleware.NewRateLimiter(env.Int("RATE_LIMIT_PER_MINUTE", 300), env.Int("RATE_LIMIT_BURST", 60), proxies)
+	gateway, err := proxy.New(limiter.Middleware, proxies)
+	if err != nil {
+		log.Fatal("Gateway configuration error: ", err)
+	}
+
+	router := http.NewServeMux()
+
+	// Health check
+	router.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("pong"))
+	})
+	router.Handle("/", gateway)
+
+	port := env.Get("PORT", "8000")
+	log.Println("API gateway running on :", port)
+	log.Fatal(http.ListenAndServe(":"+port, middleware.RequestID(httpx.CORS(router))))
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+)
+
+// idleBucketTTL is how long an unused bucket is kept before it is swept.
+const idleBucketTTL = 10 * time.Minute
+
+// RateLimiter is a token bucket per client: each client may make bursts of up to burst
+// requests, refilled at perMinute requests a minute. Authenticated callers are limited
+// per user and anonymous ones per IP address, read through the trusted proxies. Buckets
+// are kept in memory, so each gateway instance limits independently.
+type RateLimiter struct {
+	rate    float64 // tokens per second
+	burst   float64
+	proxies httpx.Proxies
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(perMinute, burst int, proxies httpx.Proxies) *RateLimiter {
+	return &RateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		proxies: proxies,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from key's bucket. When none is left it returns false and how
+// long until the next one is available.
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > idleBucketTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests. It must run
+// after authentication so that users are limited by account rather than by address.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The client's own X-Forwarded-For entries are ignored, so it cannot pick a fresh bucket
+		key := "ip:" + l.proxies.ClientIP(r)
+		if email := authn.Email(r); email != "" {
+			key = "user:" + email
+		}
+		if ok, retryAfter := l.Allow(key, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			httpx.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+// Package proxy routes public API requests to the backend services. Each request is
+// authenticated once here and the caller is forwarded to the backend in identity headers.
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+
+	"trademinutes-gateway/config"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+)
+
+// Gateway is the public entry point for all backend services.
+type Gateway struct {
+	handlers map[string]http.Handler // by route prefix
+}
+
+// New builds a reverse proxy for every backend. limit wraps each proxy after the caller
+// has been authenticated. trusted are the load balancers in front of the gateway, whose
+// X-Forwarded-For entries are believed.
+func New(limit func(http.Handler) http.Handler, trusted httpx.Proxies) (*Gateway, error) {
+	g := &Gateway{handlers: map[string]http.Handler{}}
+	proxies := map[string]http.Handler{}
+	for _, route := range routes {
+		b := route.backend
+		if _, ok := proxies[b.name]; !ok {
+			target, err := url.Parse(b.url())
+			if err != nil || target.Host == "" {
+				return nil, fmt.Errorf("invalid %s %q", b.urlEnv, b.url())
+			}
+			auth := &authn.Authenticator{
+				Service:       b.name,
+				DB:            config.GetDB,
+				APITokens:     true,
+				SessionActive: authn.SessionActive(config.GetDB),
+				// The auth service never lets an impersonating admin change the account
+				BlockImpersonatedWrites: b == authBackend,
+			}
+			proxies[b.name] = auth.Optional(limit(newReverseProxy(b.name, target, trusted)))
+		}
+		g.handlers[route.prefix] = proxies[b.name]
+	}
+	return g, nil
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Route on the cleaned path so that "/api/tasks/../../internal" can't reach a backend
+	cleaned := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if cleaned != r.URL.Path {
+		httpx.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	// Identity headers are only ever set by the gateway itself
+	authn.StripIdentity(r.Header)
+
+	for prefix, handler := range g.handlers {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	httpx.Error(w, "Not found", http.StatusNotFound)
+}
+
+func newReverseProxy(name string, target *url.URL, trusted httpx.Proxies) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			// Backends see only the client address the gateway resolved, never hops
+			// the client wrote itself
+			pr.Out.Header.Set("X-Forwarded-For", trusted.ClientIP(pr.In))
+			if p, ok := authn.PrincipalFrom(pr.In.Context()); ok {
+				authn.ForwardIdentity(pr.Out.Header, p)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// CORS is answered by the gateway; duplicate headers from a backend would
+			// make browsers reject the response
+			for name := range resp.Header {
+				if strings.HasPrefix(name, "Access-Control-") {
+					resp.Header.Del(name)
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Proxy error for %s %s to %s: %v", r.Method, r.URL.Path, name, err)
+			httpx.Error(w, "Service unavailable", http.StatusBadGateway)
+		},
+	}
+}
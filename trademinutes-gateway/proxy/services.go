@@ -0,0 +1,39 @@
+package proxy
+
+import "github.com/ElioCloud/trademinutes-common/env"
+
+// backend is a service behind the gateway, located by an environment variable.
+type backend struct {
+	name     string
+	urlEnv   string
+	fallback string
+}
+
+var (
+	authBackend      = backend{"auth", "AUTH_SERVICE_URL", "http://localhost:8080"}
+	profileBackend   = backend{"profile", "PROFILE_SERVICE_URL", "http://localhost:8081"}
+	taskBackend      = backend{"task-core", "TASK_SERVICE_URL", "http://localhost:8084"}
+	messagingBackend = backend{"messaging", "MESSAGING_SERVICE_URL", "http://localhost:8085"}
+	reviewBackend    = backend{"review", "REVIEW_SERVICE_URL", "http://localhost:8086"}
+)
+
+// routes maps public path prefixes to the backend serving them. A prefix matches the
+// path itself and anything below it. Service-to-service /internal routes are never exposed.
+var routes = []struct {
+	prefix  string
+	backend backend
+}{
+	{"/api/auth", authBackend},
+	{"/api/profile", profileBackend},
+	{"/api/tasks", taskBackend},
+	{"/api/bookings", taskBackend},
+	{"/api/notifications", taskBackend},
+	{"/api/credits", taskBackend},
+	{"/api/conversations", messagingBackend},
+	{"/ws", messagingBackend},
+	{"/api/reviews", reviewBackend},
+}
+
+func (b backend) url() string {
+	return env.Get(b.urlEnv, b.fallback)
+}
@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/env"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/ElioCloud/trademinutes-common/mongodb"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
-	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -48,35 +50,45 @@ type Conversation struct {
 type Client struct {
 	ID     string
 	UserID string
-	Conn   *websocket.Conn
-	Send   chan []byte
-	Hub    *Hub
+	// Aliases are the identifiers the user may appear under as a participant
+	Aliases []string
+	// ReadOnly clients only receive: admins impersonating the user, and personal
+	// access tokens without the messages:write scope, may watch a conversation but
+	// not write to it over the socket
+	ReadOnly bool
+	Conn     *websocket.Conn
+	Send     chan []byte
+	Hub      *Hub
 }
 
 // Hub manages all connected clients
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
 	mutex      sync.RWMutex
 }
 
 var (
-	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins for development
-		},
-	}
-	hub = &Hub{
+	// CheckOrigin is set from the CORS allowlist once the environment is loaded
+	upgrader = websocket.Upgrader{}
+	hub      = &Hub{
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 	}
 	db *mongo.Database
+	// auth identifies callers by the bearer token issued by the auth service
+	auth = &authn.Authenticator{
+		Service:       "messaging",
+		DB:            getDB,
+		APITokens:     true,
+		SessionActive: authn.SessionActive(getDB),
+	}
 )
 
+func getDB() *mongo.Database { return db }
+
 func (h *Hub) run() {
 	for {
 		select {
@@ -91,17 +103,24 @@ func (h *Hub) run() {
 				close(client.Send)
 			}
 			h.mutex.Unlock()
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for client := range h.clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.clients, client)
-				}
-			}
-			h.mutex.RUnlock()
+		}
+	}
+}
+
+// deliver sends frame to the connected clients of a conversation's participants, other
+// than the sender's own. Clients that cannot keep up are disconnected.
+func (h *Hub) deliver(frame []byte, participants []string, senderID string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for c := range h.clients {
+		if c.UserID == senderID || !takesPart(participants, c.Aliases) {
+			continue
+		}
+		select {
+		case c.Send <- frame:
+		default:
+			close(c.Send)
+			delete(h.clients, c)
 		}
 	}
 }
@@ -135,15 +154,26 @@ func (c *Client) readPump() {
 			continue
 		}
 
-		// Handle different message types
-		switch msgData["type"] {
-		case "message":
-			handleNewMessage(c, msgData)
-		case "typing":
-			handleTyping(c, msgData)
-		case "read":
-			handleReadReceipt(c, msgData)
-		}
+		c.handle(msgData)
+	}
+}
+
+// handle dispatches a frame sent by the client. Every frame type is a write on the
+// user's behalf, so read-only clients are refused.
+func (c *Client) handle(msgData map[string]interface{}) {
+	if c.ReadOnly {
+		log.Printf("%v frame from read-only client %s refused", msgData["type"], c.UserID)
+		return
+	}
+
+	// Handle different message types
+	switch msgData["type"] {
+	case "message":
+		handleNewMessage(c, msgData)
+	case "typing":
+		handleTyping(c, msgData)
+	case "read":
+		handleReadReceipt(c, msgData)
 	}
 }
 
@@ -182,10 +212,15 @@ func (c *Client) writePump() {
 }
 
 func handleNewMessage(client *Client, msgData map[string]interface{}) {
+	conversation, ok := clientConversation(client, msgData, "message")
+	if !ok {
+		return
+	}
+
 	// Create new message
 	message := Message{
 		ID:           primitive.NewObjectID(),
-		RoomID:       msgData["roomId"].(string),
+		RoomID:       conversation.ID.Hex(),
 		SenderID:     client.UserID,
 		SenderName:   msgData["senderName"].(string),
 		SenderAvatar: msgData["senderAvatar"].(string),
@@ -208,86 +243,76 @@ func handleNewMessage(client *Client, msgData map[string]interface{}) {
 			"updatedAt":   time.Now().Unix(),
 		},
 	}
-	db.Collection("conversations").UpdateOne(
-		context.Background(),
-		bson.M{"_id": msgData["roomId"]},
-		update,
-	)
+	db.Collection("conversations").UpdateByID(context.Background(), conversation.ID, update)
 
-	// Broadcast to all clients in the room
+	// Send to the other participants of the conversation
 	messageBytes, _ := json.Marshal(map[string]interface{}{
 		"type":    "message",
 		"message": message,
 	})
-
-	hub.mutex.RLock()
-	for c := range hub.clients {
-		// Only send to clients in the same room
-		if c.UserID != client.UserID { // Don't send back to sender
-			select {
-			case c.Send <- messageBytes:
-			default:
-				close(c.Send)
-				delete(hub.clients, c)
-			}
-		}
-	}
-	hub.mutex.RUnlock()
+	client.Hub.deliver(messageBytes, conversation.Participants, client.UserID)
 }
 
 func handleTyping(client *Client, msgData map[string]interface{}) {
+	conversation, ok := clientConversation(client, msgData, "typing")
+	if !ok {
+		return
+	}
 	typingData := map[string]interface{}{
 		"type":     "typing",
-		"roomId":   msgData["roomId"],
+		"roomId":   conversation.ID.Hex(),
 		"userId":   client.UserID,
 		"userName": msgData["userName"],
 		"isTyping": msgData["isTyping"],
 	}
 
 	typingBytes, _ := json.Marshal(typingData)
-
-	hub.mutex.RLock()
-	for c := range hub.clients {
-		if c.UserID != client.UserID {
-			select {
-			case c.Send <- typingBytes:
-			default:
-				close(c.Send)
-				delete(hub.clients, c)
-			}
-		}
-	}
-	hub.mutex.RUnlock()
+	client.Hub.deliver(typingBytes, conversation.Participants, client.UserID)
 }
 
 func handleReadReceipt(client *Client, msgData map[string]interface{}) {
+	conversation, ok := clientConversation(client, msgData, "read")
+	if !ok {
+		return
+	}
 	readData := map[string]interface{}{
 		"type":      "read",
-		"roomId":    msgData["roomId"],
+		"roomId":    conversation.ID.Hex(),
 		"userId":    client.UserID,
 		"messageId": msgData["messageId"],
 	}
 
 	readBytes, _ := json.Marshal(readData)
+	client.Hub.deliver(readBytes, conversation.Participants, client.UserID)
+}
 
-	hub.mutex.RLock()
-	for c := range hub.clients {
-		if c.UserID != client.UserID {
-			select {
-			case c.Send <- readBytes:
-			default:
-				close(c.Send)
-				delete(hub.clients, c)
-			}
-		}
+// clientConversation returns the conversation a frame's roomId names if the client takes
+// part in it. Frames for other conversations are dropped.
+func clientConversation(client *Client, msgData map[string]interface{}, frame string) (Conversation, bool) {
+	roomID, _ := msgData["roomId"].(string)
+	conversation, err := findConversation(context.Background(), roomID, client.Aliases)
+	if err != nil {
+		log.Printf("%s frame for conversation %q refused for %s: %v", frame, roomID, client.UserID, err)
+		return conversation, false
 	}
-	hub.mutex.RUnlock()
+	return conversation, true
+}
+
+// wsToken lets WebSocket clients, which cannot set headers in browsers, pass their
+// bearer token in the token query parameter.
+func wsToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func serveWs(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("userId")
-	if userID == "" {
-		http.Error(w, "User ID required", http.StatusBadRequest)
+	aliases, err := callerAliases(r)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
@@ -297,12 +322,15 @@ func serveWs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	p, _ := authn.PrincipalFrom(r.Context())
 	client := &Client{
-		ID:     primitive.NewObjectID().Hex(),
-		UserID: userID,
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
-		Hub:    hub,
+		ID:       primitive.NewObjectID().Hex(),
+		UserID:   p.Email,
+		Aliases:  aliases,
+		ReadOnly: p.Impersonated() || !p.HasScope("messages:write"),
+		Conn:     conn,
+		Send:     make(chan []byte, 256),
+		Hub:      hub,
 	}
 	client.Hub.register <- client
 
@@ -310,46 +338,19 @@ func serveWs(w http.ResponseWriter, r *http.Request) {
 	go client.readPump()
 }
 
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func main() {
 	// Load .env
-	if os.Getenv("ENV") != "production" {
-		if err := godotenv.Load(); err != nil {
-			log.Println(".env file not found, assuming production environment variables")
-		}
-	}
+	env.Load()
+	env.MustRequire("MONGO_URI", "DB_NAME")
 
 	// Connect to MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(os.Getenv("MONGO_URI")))
-	if err != nil {
-		log.Fatal("MongoDB Connect Error:", err)
-	}
-
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		log.Fatal("MongoDB Ping Error:", err)
-	}
-
-	db = client.Database(os.Getenv("DB_NAME"))
+	db = mongodb.MustConnectFromEnv()
 	fmt.Println("✅ Connected to MongoDB:", db.Name())
 
+	// Browsers may only call the API and open the WebSocket from allowed origins
+	origins := httpx.AllowedOrigins()
+	upgrader.CheckOrigin = origins.CheckOrigin
+
 	// Start the hub
 	go hub.run()
 
@@ -363,45 +364,101 @@ func main() {
 	})
 
 	// WebSocket endpoint
-	router.HandleFunc("/ws", serveWs)
-
-	// API endpoints
-	router.HandleFunc("/api/conversations", getConversations).Methods("GET")
-	router.HandleFunc("/api/conversations", createConversation).Methods("POST")
-	router.HandleFunc("/api/conversations/{id}/messages", getMessages).Methods("GET")
-	router.HandleFunc("/api/conversations/{id}/messages", postMessage).Methods("POST")
+	router.Handle("/ws", wsToken(auth.Middleware(authn.RequireScope("messages")(http.HandlerFunc(serveWs)))))
+
+	// API endpoints; callers are identified by their bearer token
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(auth.Middleware, authn.RequireScope("messages"))
+	api.HandleFunc("/conversations", getConversations).Methods("GET")
+	api.HandleFunc("/conversations", createConversation).Methods("POST")
+	api.HandleFunc("/conversations/{id}/messages", getMessages).Methods("GET")
+	api.HandleFunc("/conversations/{id}/messages", postMessage).Methods("POST")
+
+	// Service-to-service endpoints used by auth for account export and deletion
+	internal := router.PathPrefix("/internal").Subrouter()
+	internal.Use(httpx.InternalOnly)
+	internal.HandleFunc("/users/{id}/export", exportUserData).Methods("GET")
+	internal.HandleFunc("/users/{id}", deleteUserData).Methods("DELETE")
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8085"
-	}
+	port := env.Get("PORT", "8085")
 
 	log.Println("Messaging service running on :", port)
-	log.Fatal(http.ListenAndServe(":"+port, CORSMiddleware(router)))
+	log.Fatal(http.ListenAndServe(":"+port, origins.CORS(router)))
+}
+
+// callerAliases returns the identifiers the authenticated caller may appear under as a
+// participant: their email and, once they have an account, their user ID.
+func callerAliases(r *http.Request) ([]string, error) {
+	email := authn.Email(r)
+	var user struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := db.Collection("MyClusterCol").FindOne(r.Context(), bson.M{"email": email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return []string{email}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{email, user.ID.Hex()}, nil
+}
+
+// findConversation returns a conversation the caller, known by aliases, takes part in.
+func findConversation(ctx context.Context, roomID string, aliases []string) (Conversation, error) {
+	var conversation Conversation
+	id, err := primitive.ObjectIDFromHex(roomID)
+	if err != nil {
+		return conversation, mongo.ErrNoDocuments
+	}
+	err = db.Collection("conversations").FindOne(ctx, bson.M{
+		"_id":          id,
+		"participants": bson.M{"$in": aliases},
+	}).Decode(&conversation)
+	return conversation, err
+}
+
+// conversationFor returns the conversation of the request's {id} if the caller takes
+// part in it. It returns false after writing an error.
+func conversationFor(w http.ResponseWriter, r *http.Request) (Conversation, bool) {
+	aliases, err := callerAliases(r)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return Conversation{}, false
+	}
+	conversation, err := findConversation(r.Context(), mux.Vars(r)["id"], aliases)
+	if err == mongo.ErrNoDocuments {
+		httpx.Error(w, "Conversation not found", http.StatusNotFound)
+		return conversation, false
+	}
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return conversation, false
+	}
+	return conversation, true
 }
 
 func getConversations(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("userId")
-	if userID == "" {
-		http.Error(w, "User ID required", http.StatusBadRequest)
+	aliases, err := callerAliases(r)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("[getConversations] userID: %s", userID)
+	log.Printf("[getConversations] user: %v", aliases)
 
 	cursor, err := db.Collection("conversations").Find(context.Background(), bson.M{
-		"participants": userID,
+		"participants": bson.M{"$in": aliases},
 	})
 	if err != nil {
-		http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
 		return
 	}
 	defer cursor.Close(context.Background())
 
 	var conversations []Conversation
 	if err = cursor.All(context.Background(), &conversations); err != nil {
-		http.Error(w, "Failed to decode conversations", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to decode conversations", http.StatusInternalServerError)
 		return
 	}
 
@@ -417,12 +474,23 @@ func getConversations(w http.ResponseWriter, r *http.Request) {
 func createConversation(w http.ResponseWriter, r *http.Request) {
 	var conversation Conversation
 	if err := json.NewDecoder(r.Body).Decode(&conversation); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		httpx.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	log.Printf("[createConversation] participants: %+v, taskId: %s", conversation.Participants, conversation.TaskID)
 
+	// Callers may only start conversations they take part in
+	aliases, err := callerAliases(r)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !takesPart(conversation.Participants, aliases) {
+		httpx.Error(w, "You must be a participant of the conversation", http.StatusForbidden)
+		return
+	}
+
 	// Check if a conversation already exists for these participants and taskId (if provided)
 	filter := bson.M{
 		"participants": bson.M{"$all": conversation.Participants, "$size": len(conversation.Participants)},
@@ -431,7 +499,7 @@ func createConversation(w http.ResponseWriter, r *http.Request) {
 		filter["taskId"] = conversation.TaskID
 	}
 	var existing Conversation
-	err := db.Collection("conversations").FindOne(context.Background(), filter).Decode(&existing)
+	err = db.Collection("conversations").FindOne(context.Background(), filter).Decode(&existing)
 	if err == nil {
 		// Conversation already exists, return its ID
 		w.Header().Set("Content-Type", "application/json")
@@ -446,7 +514,7 @@ func createConversation(w http.ResponseWriter, r *http.Request) {
 
 	result, err := db.Collection("conversations").InsertOne(context.Background(), conversation)
 	if err != nil {
-		http.Error(w, "Failed to create conversation", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to create conversation", http.StatusInternalServerError)
 		return
 	}
 
@@ -457,7 +525,22 @@ func createConversation(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result.InsertedID)
 }
 
+// takesPart reports whether any of aliases is among participants.
+func takesPart(participants, aliases []string) bool {
+	for _, p := range participants {
+		for _, alias := range aliases {
+			if p == alias {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func getMessages(w http.ResponseWriter, r *http.Request) {
+	if _, ok := conversationFor(w, r); !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	roomID := vars["id"]
 
@@ -465,14 +548,14 @@ func getMessages(w http.ResponseWriter, r *http.Request) {
 		"roomId": roomID,
 	}, options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(50))
 	if err != nil {
-		http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
 		return
 	}
 	defer cursor.Close(context.Background())
 
 	var messages []Message
 	if err = cursor.All(context.Background(), &messages); err != nil {
-		http.Error(w, "Failed to decode messages", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to decode messages", http.StatusInternalServerError)
 		return
 	}
 
@@ -486,29 +569,26 @@ func getMessages(w http.ResponseWriter, r *http.Request) {
 }
 
 func postMessage(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	roomID := vars["id"]
+	conversation, ok := conversationFor(w, r)
+	if !ok {
+		return
+	}
+	roomID := mux.Vars(r)["id"]
 
 	var msg Message
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		httpx.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
 	msg.ID = primitive.NewObjectID()
 	msg.RoomID = roomID
+	msg.SenderID = authn.Email(r)
 	msg.Timestamp = time.Now().Unix()
 
 	_, err := db.Collection("messages").InsertOne(context.Background(), msg)
 	if err != nil {
-		http.Error(w, "Failed to save message", http.StatusInternalServerError)
-		return
-	}
-
-	// Convert roomID string to ObjectID for the update
-	objectID, err := primitive.ObjectIDFromHex(roomID)
-	if err != nil {
-		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		httpx.Error(w, "Failed to save message", http.StatusInternalServerError)
 		return
 	}
 
@@ -519,8 +599,105 @@ func postMessage(w http.ResponseWriter, r *http.Request) {
 			"updatedAt":   msg.Timestamp,
 		},
 	}
-	_, _ = db.Collection("conversations").UpdateByID(context.Background(), objectID, update)
+	_, _ = db.Collection("conversations").UpdateByID(context.Background(), conversation.ID, update)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(msg)
 }
+
+// userAliases returns the identifiers a user may appear under in this service.
+// Participants and senders are stored by email or by user ID depending on the client.
+func userAliases(r *http.Request) []string {
+	aliases := []string{mux.Vars(r)["id"]}
+	if email := r.URL.Query().Get("email"); email != "" {
+		aliases = append(aliases, email)
+	}
+	return aliases
+}
+
+// exportUserData returns the conversations a user takes part in and the messages they sent.
+func exportUserData(w http.ResponseWriter, r *http.Request) {
+	aliases := userAliases(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conversations := []Conversation{}
+	cursor, err := db.Collection("conversations").Find(ctx, bson.M{"participants": bson.M{"$in": aliases}})
+	if err == nil {
+		err = cursor.All(ctx, &conversations)
+	}
+	if err != nil {
+		httpx.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+		return
+	}
+
+	messages := []Message{}
+	cursor, err = db.Collection("messages").Find(ctx, bson.M{"senderId": bson.M{"$in": aliases}},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+	if err == nil {
+		err = cursor.All(ctx, &messages)
+	}
+	if err != nil {
+		httpx.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"conversations": conversations,
+		"messages":      messages,
+	})
+}
+
+// deleteUserData removes a user from messaging. Their messages stay in the conversation
+// so the other side keeps its history, but lose any link to the author. Conversations
+// with nobody left in them are deleted along with their messages.
+func deleteUserData(w http.ResponseWriter, r *http.Request) {
+	aliases := userAliases(r)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conversations := db.Collection("conversations")
+	messages := db.Collection("messages")
+
+	_, err := messages.UpdateMany(ctx, bson.M{"senderId": bson.M{"$in": aliases}}, bson.M{
+		"$set": bson.M{"senderId": "", "senderName": "Deleted user", "senderAvatar": ""},
+	})
+	if err == nil {
+		_, err = conversations.UpdateMany(ctx, bson.M{"lastMessage.senderId": bson.M{"$in": aliases}}, bson.M{
+			"$set": bson.M{"lastMessage.senderId": "", "lastMessage.senderName": "Deleted user", "lastMessage.senderAvatar": ""},
+		})
+	}
+	if err == nil {
+		_, err = conversations.UpdateMany(ctx, bson.M{"participants": bson.M{"$in": aliases}},
+			bson.M{"$pull": bson.M{"participants": bson.M{"$in": aliases}}})
+	}
+	if err != nil {
+		log.Printf("Failed to anonymise messaging data: %v", err)
+		httpx.Error(w, "Failed to delete user data", http.StatusInternalServerError)
+		return
+	}
+
+	empty := bson.M{"participants": bson.M{"$size": 0}}
+	cursor, err := conversations.Find(ctx, empty, options.Find().SetProjection(bson.M{"_id": 1}))
+	var orphaned []Conversation
+	if err == nil {
+		err = cursor.All(ctx, &orphaned)
+	}
+	if err == nil && len(orphaned) > 0 {
+		roomIDs := make([]string, len(orphaned))
+		for i, conv := range orphaned {
+			roomIDs[i] = conv.ID.Hex()
+		}
+		if _, err = messages.DeleteMany(ctx, bson.M{"roomId": bson.M{"$in": roomIDs}}); err == nil {
+			_, err = conversations.DeleteMany(ctx, empty)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to remove empty conversations: %v", err)
+		httpx.Error(w, "Failed to delete user data", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
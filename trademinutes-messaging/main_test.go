@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// listen registers a client on the hub that only collects what it is sent.
+func listen(t *testing.T, userID string) *Client {
+	t.Helper()
+	c := &Client{UserID: userID, Aliases: []string{userID}, Send: make(chan []byte, 8), Hub: hub}
+	hub.mutex.Lock()
+	hub.clients[c] = true
+	hub.mutex.Unlock()
+	t.Cleanup(func() {
+		hub.mutex.Lock()
+		delete(hub.clients, c)
+		hub.mutex.Unlock()
+	})
+	return c
+}
+
+func TestReadOnlyClientCannotWrite(t *testing.T) {
+	listener := listen(t, "b@example.com")
+	impersonated := &Client{UserID: "a@example.com", Aliases: []string{"a@example.com"}, ReadOnly: true, Hub: hub}
+
+	// Refused before the conversation is looked up, so no database is needed
+	for _, frame := range []string{"message", "typing", "read"} {
+		impersonated.handle(map[string]interface{}{"type": frame, "roomId": "r", "content": "hi"})
+	}
+	if len(listener.Send) != 0 {
+		t.Fatalf("read-only client delivered %d frames", len(listener.Send))
+	}
+}
+
+func TestDeliverOnlyToParticipants(t *testing.T) {
+	sender := listen(t, "a@example.com")
+	otherDevice := listen(t, "a@example.com")
+	byID := listen(t, "b@example.com")
+	byID.Aliases = append(byID.Aliases, "b-user-id")
+	outsider := listen(t, "c@example.com")
+
+	// Participants may be stored by email or by user ID
+	hub.deliver([]byte(`{"type":"typing"}`), []string{"a@example.com", "b-user-id"}, sender.UserID)
+
+	for _, tt := range []struct {
+		name   string
+		client *Client
+		want   int
+	}{
+		{"sender", sender, 0},
+		{"sender's other connection", otherDevice, 0},
+		{"participant known by user ID", byID, 1},
+		{"outsider", outsider, 0},
+	} {
+		if got := len(tt.client.Send); got != tt.want {
+			t.Errorf("%s got %d frames, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Institution is a college or university whose students can verify their status by
+// proving they own an address on one of its email domains.
+type Institution struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Domains []string `json:"domains"`
+}
+
+//go:embed institutions.json
+var defaultInstitutions []byte
+
+var institutions []Institution
+
+// LoadInstitutions reads the institution list from the JSON file at INSTITUTIONS_FILE,
+// falling back to the built-in list.
+func LoadInstitutions() {
+	data := defaultInstitutions
+	if path := os.Getenv("INSTITUTIONS_FILE"); path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			log.Fatal("Institutions file error:", err)
+		}
+	}
+
+	var list []Institution
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Fatal("Institutions file error:", err)
+	}
+	for i, inst := range list {
+		if inst.ID == "" || inst.Name == "" || len(inst.Domains) == 0 {
+			log.Fatal("Institutions file error:", fmt.Errorf("entry %d needs an id, a name and at least one domain", i))
+		}
+		for j, d := range inst.Domains {
+			list[i].Domains[j] = strings.ToLower(strings.TrimPrefix(d, "@"))
+		}
+	}
+	institutions = list
+	fmt.Printf("Loaded %d institutions\n", len(institutions))
+}
+
+// GetInstitutions returns the configured institutions.
+func GetInstitutions() []Institution {
+	return institutions
+}
+
+// InstitutionForEmail returns the institution owning the domain of email. Subdomains
+// count, so student.example.ac.uk matches example.ac.uk.
+func InstitutionForEmail(email string) (Institution, bool) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return Institution{}, false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, inst := range institutions {
+		for _, d := range inst.Domains {
+			if domain == d || strings.HasSuffix(domain, "."+d) {
+				return inst, true
+			}
+		}
+	}
+	return Institution{}, false
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"trademinutes-profile/config"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// profileFields are the user document fields owned by this service.
+var profileFields = []string{
+	"program", "location", "college", "yearOfStudy", "bio", "skills",
+	"profilePictureURL", "stats", "achievements", "studentVerification",
+}
+
+// ExportUserDataHandler returns the profile fields of a user.
+// Internal: called by the auth service for data exports.
+func ExportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	projection := bson.M{"_id": 0}
+	for _, f := range profileFields {
+		projection[f] = 1
+	}
+	profile := bson.M{}
+	err = config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"_id": userID},
+		options.FindOne().SetProjection(projection)).Decode(&profile)
+	if err != nil && err != mongo.ErrNoDocuments {
+		httpx.Error(w, "Error exporting profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"profile": profile})
+}
+
+// DeleteUserDataHandler clears the profile fields of a user whose account is being deleted.
+// The auth service removes the user document itself afterwards.
+// Internal: called by the auth service.
+func DeleteUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	unset := bson.M{}
+	for _, f := range profileFields {
+		unset[f] = ""
+	}
+	if _, err := config.GetDB().Collection("MyClusterCol").UpdateByID(ctx, userID, bson.M{"$unset": unset}); err != nil {
+		httpx.Error(w, "Failed to delete profile", http.StatusInternalServerError)
+		return
+	}
+	if _, err := config.GetDB().Collection("institution_verifications").DeleteOne(ctx, bson.M{"_id": userID}); err != nil {
+		httpx.Error(w, "Failed to delete profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User data removed"})
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"trademinutes-profile/config"
+
+	"github.com/ElioCloud/shared-models/models"
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/ElioCloud/trademinutes-common/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	institutionCodeTTL         = 15 * time.Minute
+	institutionCodeResendDelay = time.Minute
+	institutionCodeMaxAttempts = 5
+)
+
+// StudentVerification is the institution email address a user has proven they own.
+// Its presence is what gives the user the verified-student badge.
+type StudentVerification struct {
+	InstitutionID string `json:"institutionId" bson:"institutionId"`
+	Institution   string `json:"institution" bson:"institution"`
+	Email         string `json:"email" bson:"email"`
+	VerifiedAt    int64  `json:"verifiedAt" bson:"verifiedAt"`
+}
+
+// profileUser is a user document together with the fields managed by this service
+// that are not part of the shared user model.
+type profileUser struct {
+	models.User         `bson:",inline"`
+	StudentVerification *StudentVerification `json:"studentVerification,omitempty" bson:"studentVerification,omitempty"`
+}
+
+// institutionVerification is a pending code sent to an institution address. There is
+// at most one per user, keyed by their ID.
+type institutionVerification struct {
+	UserID        primitive.ObjectID `bson:"_id"`
+	InstitutionID string             `bson:"institutionId"`
+	Email         string             `bson:"email"`
+	CodeHash      string             `bson:"codeHash"`
+	Attempts      int                `bson:"attempts"`
+	CreatedAt     int64              `bson:"createdAt"`
+	ExpiresAt     int64              `bson:"expiresAt"`
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// addressTaken reports whether another account has already verified the address.
+func addressTaken(ctx context.Context, address string, userID primitive.ObjectID) (bool, error) {
+	count, err := config.GetDB().Collection("MyClusterCol").CountDocuments(ctx, bson.M{
+		"studentVerification.email": address,
+		"_id":                       bson.M{"$ne": userID},
+	})
+	return count > 0, err
+}
+
+// ListInstitutionsHandler returns the institutions whose students can be verified.
+func ListInstitutionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.GetInstitutions())
+}
+
+// RequestInstitutionCodeHandler emails a one-time code to an institution address the
+// user wants to verify. The address must be on a configured institution's domain.
+func RequestInstitutionCodeHandler(w http.ResponseWriter, r *http.Request) {
+	email := authn.Email(r)
+	if email == "" {
+		httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	address := strings.ToLower(strings.TrimSpace(req.Email))
+	inst, ok := config.InstitutionForEmail(address)
+	if !ok {
+		httpx.Error(w, "This email address does not belong to a supported institution", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := config.GetDB().Collection("MyClusterCol").FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	taken, err := addressTaken(ctx, address, user.ID)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		httpx.Error(w, "This email address is already verified by another account", http.StatusConflict)
+		return
+	}
+
+	verifications := config.GetDB().Collection("institution_verifications")
+	now := time.Now()
+	var pending institutionVerification
+	err = verifications.FindOne(ctx, bson.M{"_id": user.ID}).Decode(&pending)
+	if err == nil && pending.CreatedAt > now.Add(-institutionCodeResendDelay).Unix() {
+		httpx.Error(w, "Please wait a minute before requesting another code", http.StatusTooManyRequests)
+		return
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		httpx.Error(w, "Failed to create code", http.StatusInternalServerError)
+		return
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	// A new request replaces any earlier code
+	_, err = verifications.ReplaceOne(ctx, bson.M{"_id": user.ID}, institutionVerification{
+		UserID:        user.ID,
+		InstitutionID: inst.ID,
+		Email:         address,
+		CodeHash:      hashCode(code),
+		CreatedAt:     now.Unix(),
+		ExpiresAt:     now.Add(institutionCodeTTL).Unix(),
+	}, options.Replace().SetUpsert(true))
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	err = outbox.Enqueue(ctx, config.GetDB().Collection(outbox.Collection), address, "institution_code", map[string]interface{}{
+		"Name":        user.Name,
+		"Institution": inst.Name,
+		"Code":        code,
+		"ExpiresIn":   "15 minutes",
+	})
+	if err != nil {
+		log.Printf("Failed to queue institution code email: %v", err)
+		httpx.Error(w, "Failed to send code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":     "Verification code sent",
+		"institution": inst.Name,
+	})
+}
+
+// ConfirmInstitutionCodeHandler checks the emailed code and, if it matches, marks the
+// user as a verified student of the institution and sets their college to it.
+func ConfirmInstitutionCodeHandler(w http.ResponseWriter, r *http.Request) {
+	email := authn.Email(r)
+	if email == "" {
+		httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		httpx.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	users := config.GetDB().Collection("MyClusterCol")
+	var user models.User
+	if err := users.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Counting the attempt before comparing stops guessing once the limit is reached
+	verifications := config.GetDB().Collection("institution_verifications")
+	var pending institutionVerification
+	err := verifications.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":       user.ID,
+			"expiresAt": bson.M{"$gt": time.Now().Unix()},
+			"attempts":  bson.M{"$lt": institutionCodeMaxAttempts},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+	).Decode(&pending)
+	if err == mongo.ErrNoDocuments {
+		httpx.Error(w, "No valid code; please request a new one", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(hashCode(strings.TrimSpace(req.Code))), []byte(pending.CodeHash)) != 1 {
+		httpx.Error(w, "Incorrect code", http.StatusBadRequest)
+		return
+	}
+
+	inst, ok := config.InstitutionForEmail(pending.Email)
+	if !ok || inst.ID != pending.InstitutionID {
+		httpx.Error(w, "This email address does not belong to a supported institution", http.StatusBadRequest)
+		return
+	}
+	taken, err := addressTaken(ctx, pending.Email, user.ID)
+	if err != nil {
+		httpx.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		httpx.Error(w, "This email address is already verified by another account", http.StatusConflict)
+		return
+	}
+
+	verification := StudentVerification{
+		InstitutionID: inst.ID,
+		Institution:   inst.Name,
+		Email:         pending.Email,
+		VerifiedAt:    time.Now().Unix(),
+	}
+	_, err = users.UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{
+		"studentVerification": verification,
+		"college":             inst.Name,
+	}})
+	if err != nil {
+		httpx.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+	if _, err := verifications.DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		log.Printf("Failed to delete institution code: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verification)
+}
+
+// RemoveInstitutionHandler removes the user's verified-student status.
+func RemoveInstitutionHandler(w http.ResponseWriter, r *http.Request) {
+	email := authn.Email(r)
+	if email == "" {
+		httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := config.GetDB().Collection("MyClusterCol").UpdateOne(ctx, bson.M{"email": email},
+		bson.M{"$unset": bson.M{"studentVerification": ""}})
+	if err != nil {
+		httpx.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("Institution verification removed"))
+}
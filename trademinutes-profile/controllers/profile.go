@@ -8,19 +8,21 @@ import (
 	"time"
 
 	"trademinutes-profile/config"
-	"trademinutes-profile/middleware"
+	"trademinutes-profile/services"
 
 	"github.com/ElioCloud/shared-models/models"
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 func UpdateProfileInfoHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Entered UpdateProfileInfoHandler")
 
-	email, ok := r.Context().Value(middleware.EmailKey).(string)
-	if !ok {
+	email := authn.Email(r)
+	if email == "" {
 		log.Println("Failed to get email from context")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 	log.Printf("Email from context: %s\n", email)
@@ -28,7 +30,7 @@ func UpdateProfileInfoHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.User
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Error decoding request body: %v\n", err)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		httpx.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 	log.Printf("Decoded request: %+v\n", req)
@@ -69,33 +71,45 @@ func UpdateProfileInfoHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if profile was previously incomplete
-	var existingUser models.User
+	var existingUser profileUser
 	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&existingUser)
 	if err != nil {
 		log.Printf("Failed to fetch existing user: %v\n", err)
-		http.Error(w, "User not found", http.StatusNotFound)
+		httpx.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
 	wasIncomplete := existingUser.College == "" || existingUser.Program == "" || existingUser.YearOfStudy == ""
 	isNowComplete := req.College != "" && req.Program != "" && req.YearOfStudy != ""
 
-	// If profile is being completed for the first time, set credits to 200 (not increment)
-	if wasIncomplete && isNowComplete {
-		update["credits"] = 200
-	}
-
 	if len(update) == 0 {
-		http.Error(w, "No valid fields to update", http.StatusBadRequest)
+		httpx.Error(w, "No valid fields to update", http.StatusBadRequest)
 		return
 	}
 
+	// Completing the profile for the first time earns the starting credits, which are
+	// recorded in task-core's credit ledger. The grant is idempotent, so it is made before
+	// saving and a failed update can simply be retried.
+	if wasIncomplete && isNowComplete {
+		if err := services.GrantStartingCredits(ctx, existingUser.ID.Hex()); err != nil {
+			log.Printf("Failed to grant starting credits: %v\n", err)
+			httpx.Error(w, "Failed to grant starting credits", http.StatusBadGateway)
+			return
+		}
+	}
+
 	log.Printf("Update document: %+v\n", update)
 
-	result, err := collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": update})
+	// A verified student who names a different college loses the badge
+	changes := bson.M{"$set": update}
+	if v := existingUser.StudentVerification; v != nil && req.College != "" && req.College != v.Institution {
+		changes["$unset"] = bson.M{"studentVerification": ""}
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"email": email}, changes)
 	if err != nil {
 		log.Printf("Failed to update profile: %v\n", err)
-		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to update profile", http.StatusInternalServerError)
 		return
 	}
 	log.Printf("Update result: %+v\n", result)
@@ -106,9 +120,9 @@ func UpdateProfileInfoHandler(w http.ResponseWriter, r *http.Request) {
 // GetProfileHandler returns the full user profile for the authenticated user
 func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// Get email from JWT context
-	email, ok := r.Context().Value(middleware.EmailKey).(string)
-	if !ok || email == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	email := authn.Email(r)
+	if email == "" {
+		httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -116,10 +130,10 @@ func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var user models.User
+	var user profileUser
 	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		httpx.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
@@ -4,16 +4,19 @@ go 1.21
 
 require (
 	github.com/ElioCloud/shared-models v0.1.6
-	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/ElioCloud/trademinutes-common v0.0.0
 	github.com/gorilla/mux v1.8.1
-	github.com/joho/godotenv v1.5.1
 	go.mongodb.org/mongo-driver v1.17.4
 )
 
 replace github.com/ElioCloud/shared-models => ../shared-models
 
+replace github.com/ElioCloud/trademinutes-common => ../trademinutes-common
+
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
 	github.com/golang/snappy v0.0.4 // indirect
+	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/klauspost/compress v1.16.7 // indirect
 	github.com/montanaflynn/stats v0.7.1 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
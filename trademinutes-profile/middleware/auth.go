@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"trademinutes-profile/config"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+)
+
+// Auth authenticates callers from their access or personal access token. The admin
+// behind an impersonation token is named as profile in the audit trail.
+var Auth = &authn.Authenticator{
+	Service:       "profile",
+	DB:            config.GetDB,
+	APITokens:     true,
+	SessionActive: authn.SessionActive(config.GetDB),
+}
@@ -4,12 +4,26 @@ import (
 	"trademinutes-profile/controllers"
 	"trademinutes-profile/middleware"
 
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
 	"github.com/gorilla/mux"
 )
 
 func ProfileRoutes(router *mux.Router) {
 	profileRouter := router.PathPrefix("/api/profile").Subrouter()
-	profileRouter.Use(middleware.JWTMiddleware)
+	profileRouter.Use(middleware.Auth.Middleware, authn.RequireScope("profile"))
 	profileRouter.HandleFunc("/get", controllers.GetProfileHandler).Methods("GET")
 	profileRouter.HandleFunc("/update-info", controllers.UpdateProfileInfoHandler).Methods("POST")
+	profileRouter.HandleFunc("/institutions", controllers.ListInstitutionsHandler).Methods("GET")
+	profileRouter.HandleFunc("/institution/verify", controllers.RequestInstitutionCodeHandler).Methods("POST")
+	profileRouter.HandleFunc("/institution/confirm", controllers.ConfirmInstitutionCodeHandler).Methods("POST")
+	profileRouter.HandleFunc("/institution", controllers.RemoveInstitutionHandler).Methods("DELETE")
+}
+
+// InternalRoutes registers service-to-service endpoints used by the auth service.
+func InternalRoutes(router *mux.Router) {
+	internalRouter := router.PathPrefix("/internal").Subrouter()
+	internalRouter.Use(httpx.InternalOnly)
+	internalRouter.HandleFunc("/users/{id}/export", controllers.ExportUserDataHandler).Methods("GET")
+	internalRouter.HandleFunc("/users/{id}", controllers.DeleteUserDataHandler).Methods("DELETE")
 }
@@ -0,0 +1,43 @@
+// Package services calls the internal endpoints of the other TradeMinutes services.
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// GrantStartingCredits asks task-core, which keeps the credit ledger, to give the user
+// their starting credits. Repeating the call does not grant them twice.
+func GrantStartingCredits(ctx context.Context, userID string) error {
+	token := os.Getenv("INTERNAL_API_TOKEN")
+	if token == "" {
+		return fmt.Errorf("INTERNAL_API_TOKEN not configured")
+	}
+	base := os.Getenv("TASK_SERVICE_URL")
+	if base == "" {
+		base = "http://localhost:8084"
+	}
+
+	endpoint := fmt.Sprintf("%s/internal/users/%s/credits/starting", base, url.PathEscape(userID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Internal-Token", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("task-core: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("task-core: status %d", resp.StatusCode)
+	}
+	return nil
+}
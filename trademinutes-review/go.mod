@@ -6,10 +6,12 @@ toolchain go1.24.3
 
 require (
 	github.com/ElioCloud/shared-models v0.0.0
+	github.com/ElioCloud/trademinutes-common v0.0.0
 	go.mongodb.org/mongo-driver v1.17.4
 )
 
 require (
+	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
 	github.com/golang/snappy v0.0.4 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/klauspost/compress v1.16.7 // indirect
@@ -24,3 +26,5 @@ require (
 )
 
 replace github.com/ElioCloud/shared-models => ../shared-models
+
+replace github.com/ElioCloud/trademinutes-common => ../trademinutes-common
@@ -8,47 +8,43 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ElioCloud/shared-models/models"
-	"github.com/joho/godotenv"
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/env"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/ElioCloud/trademinutes-common/mongodb"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var reviewCollection *mongo.Collection
 
+// auth identifies callers who send a bearer token issued by the auth service
+var auth = &authn.Authenticator{
+	Service:       "review",
+	DB:            reviewDB,
+	APITokens:     true,
+	SessionActive: authn.SessionActive(reviewDB),
+}
+
+func reviewDB() *mongo.Database { return reviewCollection.Database() }
+
 func connectDB() *mongo.Database {
-	uri := os.Getenv("MONGO_URI")
-	if uri == "" {
-		uri = "mongodb://localhost:27017"
-	}
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
+	db, err := mongodb.Connect(env.Get("MONGO_URI", "mongodb://localhost:27017"), os.Getenv("DB_NAME"))
 	if err != nil {
 		log.Fatal(err)
 	}
-	return client.Database(os.Getenv("DB_NAME"))
-}
-
-func withCORS(h http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		h(w, r)
-	}
+	return db
 }
 
 func addReviewHandler(w http.ResponseWriter, r *http.Request) {
 	var review models.Review
 	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		httpx.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	review.ID = primitive.NewObjectID()
@@ -64,7 +60,7 @@ func addReviewHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	_, err := reviewCollection.InsertOne(context.TODO(), review)
 	if err != nil {
-		http.Error(w, "Failed to save review", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to save review", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -72,6 +68,9 @@ func addReviewHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getReviewerNameFromAuth(reviewerId primitive.ObjectID) string {
+	if reviewerId.IsZero() {
+		return "Deleted user"
+	}
 	// Try to fetch from auth service
 	authApiUrl := os.Getenv("AUTH_API_URL")
 	if authApiUrl == "" {
@@ -119,7 +118,7 @@ func getReviewsHandler(w http.ResponseWriter, r *http.Request) {
 		reviewerId, err := primitive.ObjectIDFromHex(reviewerIdHex)
 		if err != nil {
 			log.Printf("[DEBUG] Invalid reviewerId: %v", err)
-			http.Error(w, "Invalid reviewerId", http.StatusBadRequest)
+			httpx.Error(w, "Invalid reviewerId", http.StatusBadRequest)
 			return
 		}
 		filter = bson.M{"reviewerId": reviewerId}
@@ -128,28 +127,28 @@ func getReviewsHandler(w http.ResponseWriter, r *http.Request) {
 		revieweeId, err := primitive.ObjectIDFromHex(revieweeIdHex)
 		if err != nil {
 			log.Printf("[DEBUG] Invalid userId: %v", err)
-			http.Error(w, "Invalid userId", http.StatusBadRequest)
+			httpx.Error(w, "Invalid userId", http.StatusBadRequest)
 			return
 		}
 		filter = bson.M{"revieweeId": revieweeId}
 		log.Printf("[DEBUG] GET /api/reviews?userId=%s, filter: %+v", revieweeIdHex, filter)
 	} else {
 		log.Printf("[DEBUG] Missing userId, reviewerId, or taskId parameter")
-		http.Error(w, "Missing userId, reviewerId, or taskId parameter", http.StatusBadRequest)
+		httpx.Error(w, "Missing userId, reviewerId, or taskId parameter", http.StatusBadRequest)
 		return
 	}
 
 	cursor, err := reviewCollection.Find(context.Background(), filter)
 	if err != nil {
 		log.Printf("[DEBUG] Error fetching reviews: %v", err)
-		http.Error(w, "Error fetching reviews", http.StatusInternalServerError)
+		httpx.Error(w, "Error fetching reviews", http.StatusInternalServerError)
 		return
 	}
 	defer cursor.Close(context.Background())
 	var reviews []models.Review
 	if err = cursor.All(context.Background(), &reviews); err != nil {
 		log.Printf("[DEBUG] Error decoding reviews: %v", err)
-		http.Error(w, "Error decoding reviews", http.StatusInternalServerError)
+		httpx.Error(w, "Error decoding reviews", http.StatusInternalServerError)
 		return
 	}
 	log.Printf("[DEBUG] Found %d reviews for filter: %+v", len(reviews), filter)
@@ -165,30 +164,92 @@ func getReviewsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(enriched)
 }
 
-func main() {
-	// Load .env file for environment variables
-	err := godotenv.Load()
+// internalUsersHandler routes GET /internal/users/{id}/export and DELETE /internal/users/{id}.
+func internalUsersHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/internal/users/"), "/")
+	userID, err := primitive.ObjectIDFromHex(parts[0])
 	if err != nil {
-		log.Println("No .env file found or error loading .env")
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "export" && r.Method == http.MethodGet:
+		exportUserReviews(w, userID)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		deleteUserReviews(w, userID)
+	default:
+		httpx.Error(w, "Not found", http.StatusNotFound)
 	}
+}
+
+// exportUserReviews returns the reviews a user wrote and the reviews they received.
+func exportUserReviews(w http.ResponseWriter, userID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	export := map[string][]bson.M{}
+	for key, field := range map[string]string{"written": "reviewerId", "received": "revieweeId"} {
+		reviews := []bson.M{}
+		cursor, err := reviewCollection.Find(ctx, bson.M{field: userID})
+		if err == nil {
+			err = cursor.All(ctx, &reviews)
+		}
+		if err != nil {
+			log.Printf("Error exporting reviews: %v", err)
+			httpx.Error(w, "Error fetching reviews", http.StatusInternalServerError)
+			return
+		}
+		export[key] = reviews
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(export)
+}
+
+// deleteUserReviews removes the reviews a user received. Reviews they wrote stay on the
+// other user's profile but are detached from the author.
+func deleteUserReviews(w http.ResponseWriter, userID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := reviewCollection.DeleteMany(ctx, bson.M{"revieweeId": userID})
+	if err == nil {
+		_, err = reviewCollection.UpdateMany(ctx, bson.M{"reviewerId": userID},
+			bson.M{"$set": bson.M{"reviewerId": primitive.NilObjectID}})
+	}
+	if err != nil {
+		log.Printf("Error deleting reviews: %v", err)
+		httpx.Error(w, "Error deleting reviews", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func main() {
+	// Load .env file for environment variables
+	env.Load()
+	env.MustRequire("DB_NAME")
 	db := connectDB()
 	reviewCollection = db.Collection("reviews")
 
-	http.HandleFunc("/api/reviews", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	// A bearer token is checked when the client sends one; personal access tokens need
+	// the reviews:read or reviews:write scope
+	http.Handle("/api/reviews", httpx.CORS(auth.Optional(authn.RequireScope("reviews")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
 			addReviewHandler(w, r)
 		case http.MethodGet:
 			getReviewsHandler(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			httpx.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	}))
+	})))))
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8086"
-	}
+	// Service-to-service endpoints used by auth for account export and deletion
+	http.Handle("/internal/users/", httpx.InternalOnly(http.HandlerFunc(internalUsersHandler)))
+
+	port := env.Get("PORT", "8086")
 	fmt.Println("Review service running on:", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"trademinutes-task-core/ledger"
+
+	"github.com/ElioCloud/shared-models/models"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// deletedAuthor replaces the author of tasks that are kept after their author deleted
+// their account, because other users' bookings still point at them.
+var deletedAuthor = bson.M{"id": "", "name": "Deleted user", "email": ""}
+
+// ExportUserDataHandler returns the tasks, bookings, notifications and credit history of a user.
+// Internal: called by the auth service for data exports.
+func ExportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	email := r.URL.Query().Get("email")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	export := map[string]interface{}{"tasks": []bson.M{}}
+	// Anonymised tasks have an empty author email, so never query tasks without one
+	if email != "" {
+		if export["tasks"], err = findDocs(ctx, taskCollection, bson.M{"author.email": email}); err != nil {
+			httpx.Error(w, "Error exporting tasks", http.StatusInternalServerError)
+			return
+		}
+	}
+	if export["bookings"], err = findDocs(ctx, bookingCollection, bson.M{"$or": []bson.M{{"bookerId": userID}, {"taskOwnerId": userID}}}); err != nil {
+		httpx.Error(w, "Error exporting bookings", http.StatusInternalServerError)
+		return
+	}
+	if export["notifications"], err = findDocs(ctx, notificationCollection, bson.M{"userId": userID}); err != nil {
+		httpx.Error(w, "Error exporting notifications", http.StatusInternalServerError)
+		return
+	}
+	if export["credits"], err = ledger.History(ctx, ledger.UserAccount(userID), primitive.NilObjectID, 0); err != nil {
+		httpx.Error(w, "Error exporting credit history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(export)
+}
+
+func findDocs(ctx context.Context, collection *mongo.Collection, filter bson.M) ([]bson.M, error) {
+	docs := []bson.M{}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return docs, err
+	}
+	err = cursor.All(ctx, &docs)
+	return docs, err
+}
+
+// DeleteUserDataHandler removes a deleted account's data. Notifications and tasks nobody
+// booked are deleted; active bookings are cancelled (refunding the booker when the
+// provider left) and booked tasks are kept with the author anonymised, so the other
+// party's history stays intact. Internal: called by the auth service.
+func DeleteUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	email := r.URL.Query().Get("email")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := notificationCollection.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+		httpx.Error(w, "Failed to delete notifications", http.StatusInternalServerError)
+		return
+	}
+
+	if err := cancelBookingsOf(ctx, userID); err != nil {
+		log.Printf("Failed to cancel bookings of %s: %v", userID.Hex(), err)
+		httpx.Error(w, "Failed to cancel bookings", http.StatusInternalServerError)
+		return
+	}
+
+	if email != "" {
+		if err := removeTasksOf(ctx, email); err != nil {
+			log.Printf("Failed to remove tasks of %s: %v", userID.Hex(), err)
+			httpx.Error(w, "Failed to remove tasks", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User data removed"})
+}
+
+// cancelBookingsOf cancels the user's active bookings on either side.
+func cancelBookingsOf(ctx context.Context, userID primitive.ObjectID) error {
+	cursor, err := bookingCollection.Find(ctx, bson.M{
+		"$or":    []bson.M{{"bookerId": userID}, {"taskOwnerId": userID}},
+		"status": bson.M{"$in": activeStatuses},
+	})
+	if err != nil {
+		return err
+	}
+	var bookings []models.Booking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		return err
+	}
+
+	for _, b := range bookings {
+		// The status condition makes a retried deletion skip bookings it already cancelled,
+		// and the refund is applied in the same transaction as the cancellation
+		err := ledger.Transact(ctx, func(ctx context.Context) error {
+			change := statusChange{From: b.Status, To: BookingCancelled, By: partySystem, UserID: userID, At: time.Now().Unix()}
+			if err := recordStatusChange(ctx, b.ID, change, bson.M{"cancelledAt": change.At, "cancelledBy": "account_deleted"}); err != nil {
+				return err
+			}
+			// A provider who left refunds the booker in full; a booker who left forfeits the
+			// credits to the provider
+			if b.TaskOwnerID == userID {
+				if err := settleCancellation(ctx, b, b.Credits); err != nil {
+					return err
+				}
+			} else if err := forfeitEscrow(ctx, b); err != nil {
+				return err
+			}
+			return markSlot(ctx, b)
+		})
+		if err != nil && !errors.Is(err, errBookingStatus) && !errors.Is(err, errBookingNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTasksOf deletes the user's unbooked tasks and anonymises the rest.
+func removeTasksOf(ctx context.Context, email string) error {
+	cursor, err := taskCollection.Find(ctx, bson.M{"author.email": email})
+	if err != nil {
+		return err
+	}
+	var tasks []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		booked, err := bookingCollection.CountDocuments(ctx, bson.M{"taskId": t.ID})
+		if err != nil {
+			return err
+		}
+		if booked == 0 {
+			_, err = taskCollection.DeleteOne(ctx, bson.M{"_id": t.ID})
+		} else {
+			_, err = taskCollection.UpdateByID(ctx, t.ID, bson.M{"$set": bson.M{"author": deletedAuthor, "isBookable": false}})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
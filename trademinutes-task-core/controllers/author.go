@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/ElioCloud/shared-models/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// authorInfo is a task author with their verified-student badge, which the profile
+// service stores on the user record.
+type authorInfo struct {
+	models.Author
+	VerifiedStudent bool   `json:"verifiedStudent"`
+	Institution     string `json:"institution,omitempty"`
+}
+
+// taskResponse is a task as returned to clients.
+type taskResponse struct {
+	storedTask
+	Author authorInfo `json:"author"`
+}
+
+// withAuthorBadges looks up the current verified-student status of each task's author.
+// The badge is read at request time so that a removed verification disappears at once.
+func withAuthorBadges(ctx context.Context, tasks []storedTask) []taskResponse {
+	if tasks == nil {
+		return nil
+	}
+	responses := make([]taskResponse, len(tasks))
+	var ids []primitive.ObjectID
+	for i, task := range tasks {
+		responses[i] = taskResponse{storedTask: task, Author: authorInfo{Author: task.Author}}
+		if id, err := primitive.ObjectIDFromHex(task.Author.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if userCollection == nil || len(ids) == 0 {
+		return responses
+	}
+
+	cursor, err := userCollection.Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "studentVerification": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"studentVerification.institution": 1}))
+	if err != nil {
+		return responses
+	}
+	var verified []struct {
+		ID                  primitive.ObjectID `bson:"_id"`
+		StudentVerification struct {
+			Institution string `bson:"institution"`
+		} `bson:"studentVerification"`
+	}
+	if err := cursor.All(ctx, &verified); err != nil {
+		return responses
+	}
+
+	institutions := make(map[string]string, len(verified))
+	for _, u := range verified {
+		institutions[u.ID.Hex()] = u.StudentVerification.Institution
+	}
+	for i := range responses {
+		if inst, ok := institutions[responses[i].Author.ID]; ok {
+			responses[i].Author.VerifiedStudent = true
+			responses[i].Author.Institution = inst
+		}
+	}
+	return responses
+}
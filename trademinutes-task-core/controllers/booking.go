@@ -3,18 +3,29 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"regexp"
 	"time"
 
 	"github.com/ElioCloud/shared-models/models"
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/ElioCloud/trademinutes-common/outbox"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"trademinutes-task-core/ledger"
+	"trademinutes-task-core/utils"
 )
 
 var bookingCollection *mongo.Collection
 var notificationCollection *mongo.Collection
 var userCollection *mongo.Collection
+var outboxCollection *mongo.Collection
 
 // SetBookingCollection injects the MongoDB collection
 func SetBookingCollection(c *mongo.Collection) {
@@ -31,86 +42,261 @@ func SetUserCollection(c *mongo.Collection) {
 	userCollection = c
 }
 
-// Create a booking
+// SetOutboxCollection injects the shared email outbox collection
+func SetOutboxCollection(c *mongo.Collection) {
+	outboxCollection = c
+}
+
+// emailUser queues a templated email to a user. TaskTitle, Name and Link are filled in
+// from the booking; failures are logged since the booking itself already succeeded.
+func emailUser(userID primitive.ObjectID, template string, booking models.Booking, path string, data map[string]interface{}) {
+	if outboxCollection == nil {
+		return
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user); err != nil || user.Email == "" {
+		log.Printf("Email %s skipped, user %s not found", template, userID.Hex())
+		return
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["Name"] = user.Name
+	data["Link"] = utils.FrontendURL(path)
+	var task models.Task
+	if err := taskCollection.FindOne(context.TODO(), bson.M{"_id": booking.TaskID}).Decode(&task); err == nil {
+		data["TaskTitle"] = task.Title
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := outbox.Enqueue(ctx, outboxCollection, user.Email, template, data); err != nil {
+		log.Printf("Failed to queue %s email: %v", template, err)
+	}
+}
+
+// idempotencyKeyPattern is what an Idempotency-Key header may contain.
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+var errActiveBooking = errors.New("active booking exists")
+
+// storedBooking is a booking document with the fields task-core keeps beyond the
+// shared model.
+type storedBooking struct {
+	models.Booking `bson:",inline"`
+	// IdempotencyKey is the Idempotency-Key header of the request that created the booking.
+	IdempotencyKey string `json:"-" bson:"idempotencyKey,omitempty"`
+	// StatusHistory lists every status the booking has had, oldest first. Bookings made
+	// before it was recorded start at their first later change.
+	StatusHistory []statusChange `json:"statusHistory" bson:"statusHistory,omitempty"`
+}
+
+// EnsureBookingIndexes creates the index that lets each booker use an idempotency key once.
+func EnsureBookingIndexes(ctx context.Context) error {
+	_, err := bookingCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "bookerId", Value: 1}, {Key: "idempotencyKey", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"idempotencyKey": bson.M{"$exists": true}}),
+	})
+	return err
+}
+
+// sameBooking reports whether a retried request asks for the booking made the first time.
+func sameBooking(a, b models.Booking) bool {
+	return a.TaskID == b.TaskID && a.TaskOwnerID == b.TaskOwnerID && a.Credits == b.Credits && a.Timeslot == b.Timeslot
+}
+
+// Create a booking. The booking, the escrow hold of the booker's credits and the task
+// owner's notification are written in one transaction. A client may send an
+// Idempotency-Key header; retrying with the same key returns the booking made the first
+// time instead of booking again.
 func CreateBookingHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key != "" && !idempotencyKeyPattern.MatchString(key) {
+			httpx.Error(w, "Invalid Idempotency-Key header", http.StatusBadRequest)
+			return
+		}
+
 		var booking models.Booking
 		if err := json.NewDecoder(r.Body).Decode(&booking); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			httpx.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
 		// Validate required fields
 		if booking.TaskID.IsZero() || booking.BookerID.IsZero() || booking.TaskOwnerID.IsZero() || booking.Credits <= 0 || booking.Timeslot.Date == "" || booking.Timeslot.TimeFrom == "" || booking.Timeslot.TimeTo == "" {
-			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			httpx.Error(w, "Missing required fields", http.StatusBadRequest)
 			return
 		}
 
-		// Check if booker has enough credits
-		var booker models.User
-		err := userCollection.FindOne(context.TODO(), bson.M{"_id": booking.BookerID}).Decode(&booker)
-		if err != nil {
-			http.Error(w, "Booker not found", http.StatusNotFound)
+		// Users book for themselves, and only tasks of someone else
+		userID, err := callerID(context.TODO(), r)
+		if err != nil || userID != booking.BookerID {
+			httpx.Error(w, "You can only make bookings for yourself", http.StatusForbidden)
 			return
 		}
-		if booker.Credits < booking.Credits {
-			http.Error(w, "Not enough credits to book this task", http.StatusPaymentRequired)
+		if booking.BookerID == booking.TaskOwnerID {
+			httpx.Error(w, "You cannot book your own task", http.StatusBadRequest)
 			return
 		}
-
-		// Deduct credits from booker
-		_, err = userCollection.UpdateOne(
-			context.TODO(),
-			bson.M{"_id": booking.BookerID},
-			bson.M{"$inc": bson.M{"credits": -booking.Credits}},
-		)
-		if err != nil {
-			http.Error(w, "Failed to deduct credits", http.StatusInternalServerError)
+		var task storedTask
+		if err := taskCollection.FindOne(context.TODO(), bson.M{"_id": booking.TaskID}).Decode(&task); err != nil {
+			httpx.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		// The task owner is the one who can accept and complete the booking and is paid for it
+		if task.Author.ID != booking.TaskOwnerID.Hex() {
+			httpx.Error(w, "taskOwnerId is not the author of the task", http.StatusBadRequest)
+			return
+		}
+		if task.Credits > 0 {
+			booking.Credits = task.Credits
+		}
+		slot, ok := findSlot(task, booking.Timeslot)
+		if !ok {
+			httpx.Error(w, "The timeslot is not one of the task's available times", http.StatusBadRequest)
+			return
+		}
+		if start, err := slotStart(booking); err != nil || !start.After(time.Now()) {
+			httpx.Error(w, "The timeslot has already started", http.StatusBadRequest)
 			return
 		}
 
-		// Prevent multiple active bookings for the same task and user
-		activeFilter := bson.M{
-			"taskId": booking.TaskID,
-			"bookerId": booking.BookerID,
-			"status": bson.M{"$in": []string{"pending", "confirmed"}},
+		var booker models.User
+		err = userCollection.FindOne(context.TODO(), bson.M{"_id": booking.BookerID}).Decode(&booker)
+		if err != nil {
+			httpx.Error(w, "Booker not found", http.StatusNotFound)
+			return
 		}
-		count, err := bookingCollection.CountDocuments(context.TODO(), activeFilter)
+		unverified, err := utils.IsEmailUnverified(userCollection, bson.M{"_id": booking.BookerID})
 		if err != nil {
-			http.Error(w, "Error checking existing bookings", http.StatusInternalServerError)
+			httpx.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
-		if count > 0 {
-			http.Error(w, "You already have an active booking for this task", http.StatusConflict)
+		if unverified {
+			httpx.Error(w, "Please verify your email address before booking", http.StatusForbidden)
 			return
 		}
 
 		// Set server-side fields
 		booking.ID = primitive.NewObjectID()
 		booking.BookedAt = time.Now().Unix()
-		if booking.Status == "" {
-			booking.Status = "pending"
-		}
+		booking.Status = BookingPending
+
+		var earlier *storedBooking
+		err = ledger.Transact(context.TODO(), func(ctx context.Context) error {
+			earlier = nil
+			if key != "" {
+				var found storedBooking
+				err := bookingCollection.FindOne(ctx, bson.M{"bookerId": booking.BookerID, "idempotencyKey": key}).Decode(&found)
+				if err == nil {
+					earlier = &found
+					return nil
+				}
+				if err != mongo.ErrNoDocuments {
+					return err
+				}
+			}
 
-		_, err = bookingCollection.InsertOne(context.TODO(), booking)
-		if err != nil {
-			http.Error(w, "Failed to save booking", http.StatusInternalServerError)
+			// Prevent multiple active bookings for the same task and user. Holding the
+			// credits below writes to the booker, so a concurrent booking by the same
+			// booker conflicts with this transaction and is retried after it, when it
+			// sees this booking.
+			count, err := bookingCollection.CountDocuments(ctx, bson.M{
+				"taskId":   booking.TaskID,
+				"bookerId": booking.BookerID,
+				"status":   bson.M{"$in": activeStatuses},
+			})
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return errActiveBooking
+			}
+			// Check for a free seat and for bookings at the same time
+			if err := reserveSlot(ctx, booking, slot); err != nil {
+				return err
+			}
+
+			record := storedBooking{
+				Booking:        booking,
+				IdempotencyKey: key,
+				StatusHistory:  []statusChange{{To: BookingPending, By: partyBooker, UserID: userID, At: booking.BookedAt}},
+			}
+			if _, err := bookingCollection.InsertOne(ctx, record); err != nil {
+				return err
+			}
+			// Hold the booker's credits in escrow until the booking is settled
+			if err := holdEscrow(ctx, booking); err != nil {
+				return err
+			}
+			if err := markSlot(ctx, booking); err != nil {
+				return err
+			}
+
+			// Insert notification for task owner
+			if notificationCollection != nil {
+				notification := models.Notification{
+					ID:        primitive.NewObjectID(),
+					UserID:    booking.TaskOwnerID,
+					Type:      "booking",
+					Title:     "New Booking Request",
+					Message:   "You have a new booking request for your task.",
+					Timestamp: time.Now().Unix(),
+					Read:      false,
+					TaskID:    booking.TaskID,
+				}
+				if _, err := notificationCollection.InsertOne(ctx, notification); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		// A concurrent request with the same key got there first
+		if key != "" && mongo.IsDuplicateKeyError(err) {
+			var found storedBooking
+			if ferr := bookingCollection.FindOne(context.TODO(), bson.M{"bookerId": booking.BookerID, "idempotencyKey": key}).Decode(&found); ferr == nil {
+				earlier, err = &found, nil
+			}
+		}
+		switch {
+		case errors.Is(err, errActiveBooking):
+			httpx.Error(w, "You already have an active booking for this task", http.StatusConflict)
+			return
+		case errors.Is(err, errSlotFull):
+			httpx.Error(w, "This timeslot is fully booked", http.StatusConflict)
+			return
+		case errors.Is(err, errBookerBusy):
+			httpx.Error(w, "You already have a booking at this time", http.StatusConflict)
+			return
+		case errors.Is(err, errProviderBusy):
+			httpx.Error(w, "The provider is already booked at this time", http.StatusConflict)
+			return
+		case errors.Is(err, ledger.ErrInsufficientCredits):
+			httpx.Error(w, "Not enough credits to book this task", http.StatusPaymentRequired)
+			return
+		case err != nil:
+			log.Printf("Failed to create booking: %v", err)
+			httpx.Error(w, "Failed to save booking", http.StatusInternalServerError)
 			return
 		}
 
-		// Insert notification for task owner
-		if notificationCollection != nil {
-			notification := models.Notification{
-				ID:        primitive.NewObjectID(),
-				UserID:    booking.TaskOwnerID,
-				Type:      "booking",
-				Title:     "New Booking Request",
-				Message:   "You have a new booking request for your task.",
-				Timestamp: time.Now().Unix(),
-				Read:      false,
-				TaskID:    booking.TaskID,
+		if earlier != nil {
+			if !sameBooking(earlier.Booking, booking) {
+				httpx.Error(w, "Idempotency-Key was already used for a different booking", http.StatusUnprocessableEntity)
+				return
 			}
-			_, _ = notificationCollection.InsertOne(context.TODO(), notification)
+			w.Header().Set("Idempotent-Replayed", "true")
+			booking = earlier.Booking
+		} else {
+			emailUser(booking.TaskOwnerID, utils.EmailBookingRequested, booking, "/appointments/booked-from-me", map[string]interface{}{
+				"BookerName": booker.Name,
+				"Date":       booking.Timeslot.Date,
+				"TimeFrom":   booking.Timeslot.TimeFrom,
+				"TimeTo":     booking.Timeslot.TimeTo,
+			})
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -122,27 +308,11 @@ func CreateBookingHandler() http.HandlerFunc {
 	}
 }
 
-// AcceptBookingHandler sets booking status to confirmed and notifies the booker
+// AcceptBookingHandler lets the task owner confirm a pending booking and notifies the booker
 func AcceptBookingHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			BookingID string `json:"bookingId"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-		bookingID, err := primitive.ObjectIDFromHex(req.BookingID)
-		if err != nil {
-			http.Error(w, "Invalid booking ID", http.StatusBadRequest)
-			return
-		}
-		// Update booking status to confirmed
-		update := bson.M{"$set": bson.M{"status": "confirmed", "confirmedAt": time.Now().Unix()}}
-		res := bookingCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": bookingID}, update)
-		var booking models.Booking
-		if err := res.Decode(&booking); err != nil {
-			http.Error(w, "Booking not found", http.StatusNotFound)
+		booking, _, ok := changeBooking(w, r, "accept", "accepted")
+		if !ok {
 			return
 		}
 		// Insert notification for booker
@@ -159,6 +329,7 @@ func AcceptBookingHandler() http.HandlerFunc {
 			}
 			_, _ = notificationCollection.InsertOne(context.TODO(), notification)
 		}
+		emailUser(booking.BookerID, utils.EmailBookingAccepted, booking.Booking, "/appointments/booked-by-me", nil)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"message": "Booking accepted and user notified",
@@ -166,67 +337,115 @@ func AcceptBookingHandler() http.HandlerFunc {
 	}
 }
 
-// CancelBookingHandler cancels a booking
-func CancelBookingHandler() http.HandlerFunc {
+// RejectBookingHandler lets the task owner decline a pending booking. The booker's
+// credits are refunded in full.
+func RejectBookingHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			BookingID   string `json:"bookingId"`
-			CancelledBy string `json:"cancelledBy"` // "booker" or "owner"
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Invalid request body"})
+		booking, refund, ok := changeBooking(w, r, "reject", "rejected")
+		if !ok {
 			return
 		}
-		bookingID, err := primitive.ObjectIDFromHex(req.BookingID)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Invalid booking ID"})
-			return
+		if notificationCollection != nil {
+			notification := models.Notification{
+				ID:        primitive.NewObjectID(),
+				UserID:    booking.BookerID,
+				Type:      "booking_rejected",
+				Title:     "Booking Declined",
+				Message:   "Your booking request was declined and your credits have been refunded.",
+				Timestamp: time.Now().Unix(),
+				Read:      false,
+				TaskID:    booking.TaskID,
+			}
+			_, _ = notificationCollection.InsertOne(context.TODO(), notification)
 		}
-		update := bson.M{"$set": bson.M{
-			"status":      "cancelled",
-			"cancelledAt": time.Now().Unix(),
-			"cancelledBy": req.CancelledBy,
-		}}
-		res := bookingCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": bookingID}, update)
-		var booking models.Booking
-		if err := res.Decode(&booking); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Booking not found"})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":  "Booking rejected and credits refunded",
+			"refunded": refund,
+		})
+	}
+}
+
+// StartBookingHandler lets the task owner mark a confirmed booking as in progress
+func StartBookingHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := changeBooking(w, r, "start", "started"); !ok {
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "Booking cancelled successfully",
+			"message": "Booking marked as in progress",
 		})
 	}
 }
 
-// CompleteBookingHandler sets booking and task status to completed and notifies the booker
-func CompleteBookingHandler() http.HandlerFunc {
+// CancelBookingHandler lets either participant cancel a booking, refunding the booker
+// according to the cancellation policy, and notifies the other participant
+func CancelBookingHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			BookingID string `json:"bookingId"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		booking, refund, ok := changeBooking(w, r, "cancel", "cancelled")
+		if !ok {
 			return
 		}
-		bookingID, err := primitive.ObjectIDFromHex(req.BookingID)
-		if err != nil {
-			http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		if notificationCollection != nil {
+			other, by := booking.TaskOwnerID, "the booker"
+			if userID, err := callerID(context.TODO(), r); err == nil && userID == booking.TaskOwnerID {
+				other, by = booking.BookerID, "the task owner"
+			}
+			notification := models.Notification{
+				ID:        primitive.NewObjectID(),
+				UserID:    other,
+				Type:      "booking_cancelled",
+				Title:     "Booking Cancelled",
+				Message:   "A booking was cancelled by " + by + ".",
+				Timestamp: time.Now().Unix(),
+				Read:      false,
+				TaskID:    booking.TaskID,
+			}
+			_, _ = notificationCollection.InsertOne(context.TODO(), notification)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":  "Booking cancelled successfully",
+			"refunded": refund,
+		})
+	}
+}
+
+// NoShowBookingHandler lets the task owner record that the booker did not turn up to a
+// confirmed booking whose timeslot has started. The credits are released to the owner.
+func NoShowBookingHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		booking, _, ok := changeBooking(w, r, "no_show", "marked as a no-show")
+		if !ok {
 			return
 		}
-		// Update booking status to completed
-		update := bson.M{"$set": bson.M{"status": "completed", "completedAt": time.Now().Unix()}}
-		res := bookingCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": bookingID}, update)
-		var booking models.Booking
-		if err := res.Decode(&booking); err != nil {
-			http.Error(w, "Booking not found", http.StatusNotFound)
+		if notificationCollection != nil {
+			notification := models.Notification{
+				ID:        primitive.NewObjectID(),
+				UserID:    booking.BookerID,
+				Type:      "booking_no_show",
+				Title:     "Missed Booking",
+				Message:   "The provider reported that you did not attend your booking, so its credits were not refunded.",
+				Timestamp: time.Now().Unix(),
+				Read:      false,
+				TaskID:    booking.TaskID,
+			}
+			_, _ = notificationCollection.InsertOne(context.TODO(), notification)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Booking marked as a no-show",
+		})
+	}
+}
+
+// CompleteBookingHandler lets the task owner complete a booking, which sets the task
+// status to completed, pays the owner from escrow and notifies the booker
+func CompleteBookingHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		booking, _, ok := changeBooking(w, r, "complete", "completed")
+		if !ok {
 			return
 		}
 		// Update task status to completed
@@ -247,6 +466,7 @@ func CompleteBookingHandler() http.HandlerFunc {
 			}
 			_, _ = notificationCollection.InsertOne(context.TODO(), notification)
 		}
+		emailUser(booking.BookerID, utils.EmailBookingCompleted, booking.Booking, "/appointments/booked-by-me", nil)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"message": "Booking and task marked as completed, client notified",
@@ -254,21 +474,33 @@ func CompleteBookingHandler() http.HandlerFunc {
 	}
 }
 
-// GetBookingsHandler returns all bookings for a specific user (owner or booker)
+// GetBookingsHandler returns all bookings for a specific user (owner or booker). Users
+// may only list their own bookings; admins may list anyone's.
 func GetBookingsHandler(w http.ResponseWriter, r *http.Request) {
 	idHex := r.URL.Query().Get("id")
 	role := r.URL.Query().Get("role") // "owner" or "booker"
 
 	if idHex == "" || (role != "owner" && role != "booker") {
-		http.Error(w, "Missing or invalid parameters", http.StatusBadRequest)
+		httpx.Error(w, "Missing or invalid parameters", http.StatusBadRequest)
 		return
 	}
 
 	userID, err := primitive.ObjectIDFromHex(idHex)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
+	if !authn.HasRole(r, authn.RoleAdmin) {
+		caller, err := callerID(context.Background(), r)
+		if err != nil {
+			httpx.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+		if caller != userID {
+			httpx.Error(w, "You can only list your own bookings", http.StatusForbidden)
+			return
+		}
+	}
 
 	var filter bson.M
 	if role == "owner" {
@@ -279,14 +511,14 @@ func GetBookingsHandler(w http.ResponseWriter, r *http.Request) {
 
 	cursor, err := bookingCollection.Find(context.Background(), filter)
 	if err != nil {
-		http.Error(w, "Error fetching bookings", http.StatusInternalServerError)
+		httpx.Error(w, "Error fetching bookings", http.StatusInternalServerError)
 		return
 	}
 	defer cursor.Close(context.Background())
 
-	var bookings []models.Booking
+	var bookings []storedBooking
 	if err = cursor.All(context.Background(), &bookings); err != nil {
-		http.Error(w, "Error decoding bookings", http.StatusInternalServerError)
+		httpx.Error(w, "Error decoding bookings", http.StatusInternalServerError)
 		return
 	}
 
@@ -320,25 +552,25 @@ func GetBookingsHandler(w http.ResponseWriter, r *http.Request) {
 func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	userIdHex := r.URL.Query().Get("userId")
 	if userIdHex == "" {
-		http.Error(w, "Missing userId parameter", http.StatusBadRequest)
+		httpx.Error(w, "Missing userId parameter", http.StatusBadRequest)
 		return
 	}
 	userId, err := primitive.ObjectIDFromHex(userIdHex)
 	if err != nil {
-		http.Error(w, "Invalid userId", http.StatusBadRequest)
+		httpx.Error(w, "Invalid userId", http.StatusBadRequest)
 		return
 	}
 	filter := bson.M{"userId": userId}
 	cursor, err := notificationCollection.Find(context.Background(), filter)
 	if err != nil {
-		http.Error(w, "Error fetching notifications", http.StatusInternalServerError)
+		httpx.Error(w, "Error fetching notifications", http.StatusInternalServerError)
 		return
 	}
 	defer cursor.Close(context.Background())
 
 	var notifications []models.Notification
 	if err = cursor.All(context.Background(), &notifications); err != nil {
-		http.Error(w, "Error decoding notifications", http.StatusInternalServerError)
+		httpx.Error(w, "Error decoding notifications", http.StatusInternalServerError)
 		return
 	}
 
@@ -350,19 +582,19 @@ func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 func MarkAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
 	userIdHex := r.URL.Query().Get("userId")
 	if userIdHex == "" {
-		http.Error(w, "Missing userId parameter", http.StatusBadRequest)
+		httpx.Error(w, "Missing userId parameter", http.StatusBadRequest)
 		return
 	}
 	userId, err := primitive.ObjectIDFromHex(userIdHex)
 	if err != nil {
-		http.Error(w, "Invalid userId", http.StatusBadRequest)
+		httpx.Error(w, "Invalid userId", http.StatusBadRequest)
 		return
 	}
 	filter := bson.M{"userId": userId, "read": false}
 	update := bson.M{"$set": bson.M{"read": true}}
 	_, err = notificationCollection.UpdateMany(context.Background(), filter, update)
 	if err != nil {
-		http.Error(w, "Failed to mark notifications as read", http.StatusInternalServerError)
+		httpx.Error(w, "Failed to mark notifications as read", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
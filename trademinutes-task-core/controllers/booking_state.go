@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"trademinutes-task-core/ledger"
+
+	"github.com/ElioCloud/shared-models/models"
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Booking statuses. A booking starts pending and ends completed, rejected, cancelled,
+// expired or no_show.
+const (
+	BookingPending    = "pending"
+	BookingConfirmed  = "confirmed"
+	BookingInProgress = "in_progress"
+	BookingCompleted  = "completed"
+	BookingRejected   = "rejected"
+	BookingCancelled  = "cancelled"
+	BookingExpired    = "expired"
+	BookingNoShow     = "no_show"
+)
+
+// Parties to a booking, as recorded in its status history.
+const (
+	partyOwner  = "owner"
+	partyBooker = "booker"
+	partySystem = "system"
+)
+
+// bookingAction is a transition of the booking state machine: the statuses it may be
+// taken from, the status it leads to, and who may take it. An empty by means either
+// participant.
+type bookingAction struct {
+	from []string
+	to   string
+	by   string
+	// at is the timestamp field set on the booking, such as confirmedAt.
+	at string
+}
+
+var bookingActions = map[string]bookingAction{
+	"accept":   {from: []string{BookingPending}, to: BookingConfirmed, by: partyOwner, at: "confirmedAt"},
+	"reject":   {from: []string{BookingPending}, to: BookingRejected, by: partyOwner, at: "rejectedAt"},
+	"start":    {from: []string{BookingConfirmed}, to: BookingInProgress, by: partyOwner, at: "startedAt"},
+	"complete": {from: []string{BookingConfirmed, BookingInProgress}, to: BookingCompleted, by: partyOwner, at: "completedAt"},
+	"no_show":  {from: []string{BookingConfirmed}, to: BookingNoShow, by: partyOwner, at: "noShowAt"},
+	"cancel":   {from: []string{BookingPending, BookingConfirmed}, to: BookingCancelled, at: "cancelledAt"},
+	"expire":   {from: []string{BookingPending}, to: BookingExpired, by: partySystem, at: "expiredAt"},
+}
+
+// statusChange is an entry of a booking's status history.
+type statusChange struct {
+	From string `json:"from,omitempty" bson:"from,omitempty"`
+	To   string `json:"to" bson:"to"`
+	// By is the party that made the change: owner, booker or system.
+	By     string             `json:"by" bson:"by"`
+	UserID primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	At     int64              `json:"at" bson:"at"`
+}
+
+var (
+	errBookingNotFound  = errors.New("booking not found")
+	errBookingStatus    = errors.New("booking status does not allow this change")
+	errBookingForbidden = errors.New("caller may not change this booking")
+	errNotStarted       = errors.New("booking timeslot has not started")
+)
+
+// bookingParty returns the caller's part in a booking, or "" if they are not part of it.
+func bookingParty(booking models.Booking, userID primitive.ObjectID) string {
+	switch userID {
+	case booking.TaskOwnerID:
+		return partyOwner
+	case booking.BookerID:
+		return partyBooker
+	}
+	return ""
+}
+
+// callerID returns the ID of the authenticated user.
+func callerID(ctx context.Context, r *http.Request) (primitive.ObjectID, error) {
+	var user struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := userCollection.FindOne(ctx, bson.M{"email": authn.Email(r)}, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&user)
+	return user.ID, err
+}
+
+// slotStart returns when a booking's timeslot starts.
+func slotStart(booking models.Booking) (time.Time, error) {
+	start, _, err := slotTimes(booking.Timeslot)
+	return start, err
+}
+
+// transitionBooking takes an action on a booking for a party and settles the credits it
+// involves, all in one transaction; completing a booking also pays its referral bonuses.
+// It returns the booking as it was before and the
+// credits refunded to the booker. userID is the caller, or zero for the system.
+func transitionBooking(ctx context.Context, bookingID primitive.ObjectID, name string, userID primitive.ObjectID) (storedBooking, int, error) {
+	action := bookingActions[name]
+	var booking storedBooking
+	var refund int
+	now := time.Now()
+	err := ledger.Transact(ctx, func(ctx context.Context) error {
+		refund = 0
+		if err := bookingCollection.FindOne(ctx, bson.M{"_id": bookingID}).Decode(&booking); err == mongo.ErrNoDocuments {
+			return errBookingNotFound
+		} else if err != nil {
+			return err
+		}
+
+		party, err := allowTransition(name, booking.Booking, userID, now)
+		if err != nil {
+			return err
+		}
+
+		set := bson.M{action.at: now.Unix()}
+		if name == "cancel" {
+			set["cancelledBy"] = party
+		}
+		change := statusChange{From: booking.Status, To: action.to, By: party, UserID: userID, At: now.Unix()}
+		if err := recordStatusChange(ctx, booking.ID, change, set); err != nil {
+			return err
+		}
+
+		switch action.to {
+		case BookingCompleted:
+			if err := releaseEscrow(ctx, booking.Booking); err != nil {
+				return err
+			}
+			// A booking can only be completed once, so referrals are never rewarded twice
+			return rewardReferrals(ctx, booking.Booking)
+		case BookingNoShow:
+			return releaseEscrow(ctx, booking.Booking)
+		case BookingRejected, BookingExpired:
+			refund = booking.Credits
+		case BookingCancelled:
+			refund = cancellationRefund(booking.Booking, party, now)
+		default:
+			return nil
+		}
+		if err := settleCancellation(ctx, booking.Booking, refund); err != nil {
+			return err
+		}
+		// The booking's seat is free again
+		return markSlot(ctx, booking.Booking)
+	})
+	return booking, refund, err
+}
+
+// allowTransition checks that an action may be taken on a booking at now, and returns
+// the party taking it. userID is the caller, or zero for the system.
+func allowTransition(name string, booking models.Booking, userID primitive.ObjectID, now time.Time) (string, error) {
+	action := bookingActions[name]
+	party := partySystem
+	if !userID.IsZero() {
+		party = bookingParty(booking, userID)
+		if party == "" || (action.by != "" && action.by != party) {
+			return party, errBookingForbidden
+		}
+	} else if action.by != partySystem {
+		return party, errBookingForbidden
+	}
+	if !containsStatus(action.from, booking.Status) {
+		return party, errBookingStatus
+	}
+	if name == "no_show" {
+		if start, err := slotStart(booking); err == nil && now.Before(start) {
+			return party, errNotStarted
+		}
+	}
+	return party, nil
+}
+
+// recordStatusChange moves a booking from change.From to change.To, adding the change to
+// its status history and setting the other fields in set. It fails with errBookingStatus
+// if the booking's status is no longer change.From.
+func recordStatusChange(ctx context.Context, bookingID primitive.ObjectID, change statusChange, set bson.M) error {
+	fields := bson.M{"status": change.To}
+	for k, v := range set {
+		fields[k] = v
+	}
+	// The status condition makes a concurrent change of the same booking fail here
+	res, err := bookingCollection.UpdateOne(ctx,
+		bson.M{"_id": bookingID, "status": change.From},
+		bson.M{"$set": fields, "$push": bson.M{"statusHistory": change}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errBookingStatus
+	}
+	return nil
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// changeBooking reads the bookingId of a request and takes the action on it for the
+// caller. On failure it has already replied.
+func changeBooking(w http.ResponseWriter, r *http.Request, name, verb string) (storedBooking, int, bool) {
+	var req struct {
+		BookingID string `json:"bookingId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpx.Error(w, "Invalid request body", http.StatusBadRequest)
+		return storedBooking{}, 0, false
+	}
+	bookingID, err := primitive.ObjectIDFromHex(req.BookingID)
+	if err != nil {
+		httpx.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return storedBooking{}, 0, false
+	}
+	userID, err := callerID(context.TODO(), r)
+	if err != nil {
+		httpx.Error(w, "User not found", http.StatusUnauthorized)
+		return storedBooking{}, 0, false
+	}
+
+	booking, refund, err := transitionBooking(context.TODO(), bookingID, name, userID)
+	switch {
+	case err == nil:
+		return booking, refund, true
+	case errors.Is(err, errBookingNotFound):
+		httpx.Error(w, "Booking not found", http.StatusNotFound)
+	case errors.Is(err, errBookingForbidden):
+		httpx.Error(w, "You are not allowed to change this booking", http.StatusForbidden)
+	case errors.Is(err, errBookingStatus):
+		httpx.Error(w, "This booking is "+booking.Status+" and cannot be "+verb, http.StatusConflict)
+	case errors.Is(err, errNotStarted):
+		httpx.Error(w, "The booked timeslot has not started yet", http.StatusConflict)
+	default:
+		log.Printf("Failed to %s booking %s: %v", name, bookingID.Hex(), err)
+		httpx.Error(w, "Failed to update booking", http.StatusInternalServerError)
+	}
+	return booking, refund, false
+}
+
+// ExpirePendingBookings expires pending bookings whose timeslot has started without the
+// task owner accepting them, refunding the bookers.
+func ExpirePendingBookings(ctx context.Context) {
+	now := time.Now()
+	// Dates are YYYY-MM-DD, so comparing them as strings narrows the search to today and earlier
+	cursor, err := bookingCollection.Find(ctx, bson.M{
+		"status":        BookingPending,
+		"timeslot.date": bson.M{"$lte": now.Format("2006-01-02")},
+	})
+	if err != nil {
+		log.Printf("Failed to find pending bookings to expire: %v", err)
+		return
+	}
+	var bookings []models.Booking
+	if err := cursor.All(ctx, &bookings); err != nil {
+		log.Printf("Failed to find pending bookings to expire: %v", err)
+		return
+	}
+
+	for _, b := range bookings {
+		if start, err := slotStart(b); err != nil || now.Before(start) {
+			continue
+		}
+		booking, _, err := transitionBooking(ctx, b.ID, "expire", primitive.NilObjectID)
+		if err != nil {
+			if !errors.Is(err, errBookingStatus) {
+				log.Printf("Failed to expire booking %s: %v", b.ID.Hex(), err)
+			}
+			continue
+		}
+		if notificationCollection != nil {
+			_, _ = notificationCollection.InsertOne(ctx, models.Notification{
+				ID:        primitive.NewObjectID(),
+				UserID:    booking.BookerID,
+				Type:      "booking_expired",
+				Title:     "Booking Expired",
+				Message:   "Your booking request was not accepted before its timeslot, so your credits have been refunded.",
+				Timestamp: time.Now().Unix(),
+				Read:      false,
+				TaskID:    booking.TaskID,
+			})
+		}
+	}
+}
+
+// RunBookingExpiry expires stale pending bookings every interval.
+func RunBookingExpiry(interval time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		ExpirePendingBookings(ctx)
+		cancel()
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ElioCloud/shared-models/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	testOwner    = primitive.NewObjectID()
+	testBooker   = primitive.NewObjectID()
+	testStranger = primitive.NewObjectID()
+	testSystem   = primitive.NilObjectID
+)
+
+// testBooking is a booking whose timeslot starts at start, read in the server's time zone.
+func testBooking(status string, start time.Time) models.Booking {
+	return models.Booking{
+		ID:          primitive.NewObjectID(),
+		TaskOwnerID: testOwner,
+		BookerID:    testBooker,
+		Status:      status,
+		Credits:     10,
+		Timeslot: models.AvailabilitySlot{
+			Date:     start.Format("2006-01-02"),
+			TimeFrom: start.Format("15:04"),
+			TimeTo:   start.Add(time.Hour).Format("15:04"),
+		},
+	}
+}
+
+func TestAllowTransition(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	future := now.Add(48 * time.Hour)
+	past := now.Add(-2 * time.Hour)
+
+	tests := []struct {
+		action    string
+		status    string
+		start     time.Time
+		caller    primitive.ObjectID
+		wantParty string
+		wantErr   error
+	}{
+		{"accept", BookingPending, future, testOwner, partyOwner, nil},
+		{"accept", BookingPending, future, testBooker, partyBooker, errBookingForbidden},
+		{"accept", BookingConfirmed, future, testOwner, partyOwner, errBookingStatus},
+		{"reject", BookingPending, future, testOwner, partyOwner, nil},
+		{"reject", BookingCancelled, future, testOwner, partyOwner, errBookingStatus},
+		{"start", BookingConfirmed, future, testOwner, partyOwner, nil},
+		{"start", BookingPending, future, testOwner, partyOwner, errBookingStatus},
+		{"complete", BookingConfirmed, past, testOwner, partyOwner, nil},
+		{"complete", BookingInProgress, past, testOwner, partyOwner, nil},
+		{"complete", BookingInProgress, past, testBooker, partyBooker, errBookingForbidden},
+		{"complete", BookingCompleted, past, testOwner, partyOwner, errBookingStatus},
+		{"no_show", BookingConfirmed, past, testOwner, partyOwner, nil},
+		{"no_show", BookingConfirmed, future, testOwner, partyOwner, errNotStarted},
+		{"no_show", BookingInProgress, past, testOwner, partyOwner, errBookingStatus},
+		{"cancel", BookingPending, future, testBooker, partyBooker, nil},
+		{"cancel", BookingConfirmed, future, testOwner, partyOwner, nil},
+		{"cancel", BookingInProgress, past, testBooker, partyBooker, errBookingStatus},
+		{"cancel", BookingPending, future, testStranger, "", errBookingForbidden},
+		{"cancel", BookingPending, future, testSystem, partySystem, errBookingForbidden},
+		{"expire", BookingPending, past, testSystem, partySystem, nil},
+		{"expire", BookingConfirmed, past, testSystem, partySystem, errBookingStatus},
+		{"expire", BookingPending, past, testOwner, partyOwner, errBookingForbidden},
+		{"unknown", BookingPending, future, testSystem, partySystem, errBookingForbidden},
+	}
+	for _, tt := range tests {
+		party, err := allowTransition(tt.action, testBooking(tt.status, tt.start), tt.caller, now)
+		if err != tt.wantErr || (err == nil && party != tt.wantParty) {
+			t.Errorf("%s from %s by %s: got (%q, %v), want (%q, %v)",
+				tt.action, tt.status, bookingParty(testBooking(tt.status, tt.start), tt.caller), party, err, tt.wantParty, tt.wantErr)
+		}
+	}
+}
+
+// TestBookingActionsReachEveryStatus guards the table against a status that can be
+// entered but never left, or one no action leads to.
+func TestBookingActionsReachEveryStatus(t *testing.T) {
+	terminal := map[string]bool{BookingCompleted: true, BookingRejected: true, BookingCancelled: true, BookingExpired: true, BookingNoShow: true}
+	reached := map[string]bool{BookingPending: true}
+	leaves := map[string]bool{}
+	for name, action := range bookingActions {
+		if action.at == "" {
+			t.Errorf("%s sets no timestamp", name)
+		}
+		reached[action.to] = true
+		for _, from := range action.from {
+			if terminal[from] {
+				t.Errorf("%s leaves the final status %s", name, from)
+			}
+			leaves[from] = true
+		}
+	}
+	for _, status := range []string{BookingPending, BookingConfirmed, BookingInProgress, BookingCompleted, BookingRejected, BookingCancelled, BookingExpired, BookingNoShow} {
+		if !reached[status] {
+			t.Errorf("no action leads to %s", status)
+		}
+		if !terminal[status] && !leaves[status] {
+			t.Errorf("no action leaves %s", status)
+		}
+	}
+}
+
+func TestCancellationRefund(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		status string
+		by     string
+		start  time.Time
+		want   int
+	}{
+		{"owner cancels late", BookingConfirmed, partyOwner, now.Add(time.Hour), 10},
+		{"booker cancels pending", BookingPending, partyBooker, now.Add(time.Hour), 10},
+		{"booker cancels with notice", BookingConfirmed, partyBooker, now.Add(24 * time.Hour), 10},
+		{"booker cancels late", BookingConfirmed, partyBooker, now.Add(23 * time.Hour), 5},
+		{"booker cancels after start", BookingConfirmed, partyBooker, now.Add(-time.Hour), 5},
+	}
+	for _, tt := range tests {
+		if got := cancellationRefund(testBooking(tt.status, tt.start), tt.by, now); got != tt.want {
+			t.Errorf("%s: refund %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	t.Setenv("CANCELLATION_NOTICE_HOURS", "2")
+	t.Setenv("LATE_CANCELLATION_REFUND_PERCENT", "0")
+	if got := cancellationRefund(testBooking(BookingConfirmed, now.Add(3*time.Hour)), partyBooker, now); got != 10 {
+		t.Errorf("with 2 hours notice given: refund %d, want 10", got)
+	}
+	if got := cancellationRefund(testBooking(BookingConfirmed, now.Add(time.Hour)), partyBooker, now); got != 0 {
+		t.Errorf("late with no refund: refund %d, want 0", got)
+	}
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"trademinutes-task-core/ledger"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/env"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// startingCredits is the number of credits a user gets on completing their profile.
+func startingCredits() int {
+	if n := env.Int("STARTING_CREDITS", 200); n >= 0 {
+		return n
+	}
+	return 200
+}
+
+// creditHistoryEntry is a ledger entry as seen by one of its users. Change is positive
+// for credits received and negative for credits spent.
+type creditHistoryEntry struct {
+	ledger.Entry
+	Change int `json:"change"`
+}
+
+// CreditHistoryHandler returns the caller's credit balance and ledger entries, newest
+// first. ?limit= (at most 200) and ?before=<entry id> page through older entries.
+func CreditHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	email := authn.Email(r)
+	if email == "" {
+		httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := int64(50)
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 1 || n > 200 {
+			httpx.Error(w, "limit must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var before primitive.ObjectID
+	if s := r.URL.Query().Get("before"); s != "" {
+		id, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			httpx.Error(w, "Invalid before parameter", http.StatusBadRequest)
+			return
+		}
+		before = id
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := userCollection.FindOne(ctx, bson.M{"email": email}, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&user); err != nil {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Reconciling first brings a wallet from before the ledger in with its opening balance
+	rec, err := ledger.Reconcile(ctx, user.ID, false)
+	if err != nil {
+		httpx.Error(w, "Error loading credits", http.StatusInternalServerError)
+		return
+	}
+	if rec.Drift != 0 {
+		log.Printf("Wallet %s holds %d credits but its ledger balance is %d", user.ID.Hex(), rec.Stored, rec.Ledger)
+	}
+
+	account := ledger.UserAccount(user.ID)
+	entries, err := ledger.History(ctx, account, before, limit)
+	if err != nil {
+		httpx.Error(w, "Error loading credit history", http.StatusInternalServerError)
+		return
+	}
+	history := make([]creditHistoryEntry, len(entries))
+	for i, e := range entries {
+		history[i] = creditHistoryEntry{Entry: e, Change: e.Amount}
+		if e.Debit == account {
+			history[i].Change = -e.Amount
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"balance": rec.Ledger,
+		"entries": history,
+	})
+}
+
+// GrantStartingCreditsHandler gives a user their starting credits. It is idempotent, so
+// the caller can retry it. Internal: called by the profile service when a profile is
+// first completed.
+func GrantStartingCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	amount := startingCredits()
+	if amount == 0 {
+		httpx.JSON(w, http.StatusOK, map[string]interface{}{"granted": 0})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entry, err := ledger.Post(ctx, ledger.Entry{
+		Debit:  ledger.Issuance,
+		Credit: ledger.UserAccount(userID),
+		Amount: amount,
+		Reason: ledger.ReasonStartingCredits,
+		Key:    "starting:" + userID.Hex(),
+	})
+	if errors.Is(err, ledger.ErrNoAccount) {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil && !errors.Is(err, ledger.ErrAlreadyPosted) {
+		log.Printf("Failed to grant starting credits to %s: %v", userID.Hex(), err)
+		httpx.Error(w, "Failed to grant credits", http.StatusInternalServerError)
+		return
+	}
+	httpx.JSON(w, http.StatusOK, map[string]interface{}{"granted": entry.Amount, "entry": entry})
+}
+
+// ReconcileCreditsHandler compares a user's stored balance with their ledger balance.
+// POST also resets a drifted balance to the ledger's. Internal: for operators.
+func ReconcileCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		httpx.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rec, err := ledger.Reconcile(ctx, userID, r.Method == http.MethodPost)
+	if errors.Is(err, ledger.ErrNoAccount) {
+		httpx.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		httpx.Error(w, "Failed to reconcile credits", http.StatusInternalServerError)
+		return
+	}
+	httpx.JSON(w, http.StatusOK, rec)
+}
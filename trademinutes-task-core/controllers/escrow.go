@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"trademinutes-task-core/ledger"
+
+	"github.com/ElioCloud/shared-models/models"
+	"github.com/ElioCloud/trademinutes-common/env"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// bookingKey is the ledger key of one of a booking's postings, which makes each of them
+// happen at most once.
+func bookingKey(bookingID primitive.ObjectID, posting string) string {
+	return "booking:" + bookingID.Hex() + ":" + posting
+}
+
+// postOnce posts an entry, treating one already posted under the same key as done.
+func postOnce(ctx context.Context, e ledger.Entry) error {
+	_, err := ledger.Post(ctx, e)
+	if errors.Is(err, ledger.ErrAlreadyPosted) {
+		return nil
+	}
+	return err
+}
+
+// holdEscrow takes a booking's credits from the booker into the booking's escrow.
+func holdEscrow(ctx context.Context, booking models.Booking) error {
+	_, err := ledger.Post(ctx, ledger.Entry{
+		Debit:     ledger.UserAccount(booking.BookerID),
+		Credit:    ledger.Escrow(booking.ID),
+		Amount:    booking.Credits,
+		Reason:    ledger.ReasonBookingPayment,
+		Key:       bookingKey(booking.ID, "payment"),
+		BookingID: &booking.ID,
+		TaskID:    &booking.TaskID,
+	})
+	return err
+}
+
+// escrowAccount returns the account holding a booking's payment. That is the booking's
+// escrow, unless the booking was paid before escrow: bookings made before the ledger have
+// no payment entry, their credits having been deducted without a record, so they are
+// settled from issuance to keep the ledger balanced.
+func escrowAccount(ctx context.Context, booking models.Booking) (ledger.Account, error) {
+	payment, err := ledger.Lookup(ctx, bookingKey(booking.ID, "payment"))
+	if err == mongo.ErrNoDocuments {
+		return ledger.Issuance, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return payment.Credit, nil
+}
+
+// releaseEscrow pays a completed booking's credits to the task owner.
+func releaseEscrow(ctx context.Context, booking models.Booking) error {
+	from, err := escrowAccount(ctx, booking)
+	if err != nil {
+		return err
+	}
+	return postOnce(ctx, ledger.Entry{
+		Debit:     from,
+		Credit:    ledger.UserAccount(booking.TaskOwnerID),
+		Amount:    booking.Credits,
+		Reason:    ledger.ReasonBookingRelease,
+		Key:       bookingKey(booking.ID, "release"),
+		BookingID: &booking.ID,
+		TaskID:    &booking.TaskID,
+	})
+}
+
+// forfeitEscrow pays the credits of a booking whose booker deleted their account to the
+// task owner, as there is no wallet left to refund them to.
+func forfeitEscrow(ctx context.Context, booking models.Booking) error {
+	from, err := escrowAccount(ctx, booking)
+	if err != nil {
+		return err
+	}
+	return postOnce(ctx, ledger.Entry{
+		Debit:     from,
+		Credit:    ledger.UserAccount(booking.TaskOwnerID),
+		Amount:    booking.Credits,
+		Reason:    ledger.ReasonBookingForfeit,
+		Key:       bookingKey(booking.ID, "forfeit"),
+		BookingID: &booking.ID,
+		TaskID:    &booking.TaskID,
+	})
+}
+
+// settleCancellation refunds refund credits of a cancelled or rejected booking to the
+// booker and pays whatever is left to the task owner as a cancellation fee.
+func settleCancellation(ctx context.Context, booking models.Booking, refund int) error {
+	from, err := escrowAccount(ctx, booking)
+	if err != nil {
+		return err
+	}
+	for _, e := range cancellationEntries(booking, from, refund) {
+		if err := postOnce(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancellationEntries splits the escrow of a cancelled booking into the booker's refund
+// and the task owner's cancellation fee. Empty parts are left out.
+func cancellationEntries(booking models.Booking, from ledger.Account, refund int) []ledger.Entry {
+	var entries []ledger.Entry
+	if refund > 0 {
+		entries = append(entries, ledger.Entry{
+			Debit:     from,
+			Credit:    ledger.UserAccount(booking.BookerID),
+			Amount:    refund,
+			Reason:    ledger.ReasonBookingRefund,
+			Key:       bookingKey(booking.ID, "refund"),
+			BookingID: &booking.ID,
+			TaskID:    &booking.TaskID,
+		})
+	}
+	if fee := booking.Credits - refund; fee > 0 {
+		entries = append(entries, ledger.Entry{
+			Debit:     from,
+			Credit:    ledger.UserAccount(booking.TaskOwnerID),
+			Amount:    fee,
+			Reason:    ledger.ReasonCancellationFee,
+			Key:       bookingKey(booking.ID, "cancellation_fee"),
+			BookingID: &booking.ID,
+			TaskID:    &booking.TaskID,
+		})
+	}
+	return entries
+}
+
+// cancellationRefund is the cancellation policy: the credits given back to the booker
+// when a booking is cancelled. Bookings cancelled by the task owner, still pending, or
+// cancelled at least CANCELLATION_NOTICE_HOURS (default 24) before the timeslot starts
+// are refunded in full. A booker who cancels a confirmed booking later gets back
+// LATE_CANCELLATION_REFUND_PERCENT (default 50) percent, and the task owner keeps the
+// rest. booking is the booking as it was before the cancellation.
+func cancellationRefund(booking models.Booking, cancelledBy string, now time.Time) int {
+	if cancelledBy != partyBooker || booking.Status != BookingConfirmed {
+		return booking.Credits
+	}
+	start, err := slotStart(booking)
+	notice := time.Duration(env.Int("CANCELLATION_NOTICE_HOURS", 24)) * time.Hour
+	if err != nil || start.Sub(now) >= notice {
+		return booking.Credits
+	}
+	percent := env.Int("LATE_CANCELLATION_REFUND_PERCENT", 50)
+	if percent < 0 || percent > 100 {
+		percent = 50
+	}
+	return booking.Credits * percent / 100
+}
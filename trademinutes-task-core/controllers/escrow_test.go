@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"trademinutes-task-core/ledger"
+)
+
+func TestCancellationEntries(t *testing.T) {
+	booking := testBooking(BookingConfirmed, time.Now())
+	escrow := ledger.Escrow(booking.ID)
+	booker := ledger.UserAccount(testBooker)
+	owner := ledger.UserAccount(testOwner)
+
+	type posting struct {
+		credit ledger.Account
+		amount int
+		reason string
+	}
+	tests := []struct {
+		name   string
+		refund int
+		want   []posting
+	}{
+		{"full refund", 10, []posting{{booker, 10, ledger.ReasonBookingRefund}}},
+		{"late cancellation", 5, []posting{{booker, 5, ledger.ReasonBookingRefund}, {owner, 5, ledger.ReasonCancellationFee}}},
+		{"uneven split", 3, []posting{{booker, 3, ledger.ReasonBookingRefund}, {owner, 7, ledger.ReasonCancellationFee}}},
+		{"no refund", 0, []posting{{owner, 10, ledger.ReasonCancellationFee}}},
+	}
+	for _, tt := range tests {
+		entries := cancellationEntries(booking, escrow, tt.refund)
+		if len(entries) != len(tt.want) {
+			t.Errorf("%s: %d entries, want %d", tt.name, len(entries), len(tt.want))
+			continue
+		}
+		total := 0
+		for i, e := range entries {
+			got := posting{e.Credit, e.Amount, e.Reason}
+			if got != tt.want[i] || e.Debit != escrow {
+				t.Errorf("%s: entry %d moves %d from %s to %s for %s, want %+v from the escrow", tt.name, i, e.Amount, e.Debit, e.Credit, e.Reason, tt.want[i])
+			}
+			if *e.BookingID != booking.ID || *e.TaskID != booking.TaskID || e.Key == "" {
+				t.Errorf("%s: entry %d is not tied to the booking: %+v", tt.name, i, e)
+			}
+			total += e.Amount
+		}
+		// The escrow is emptied exactly
+		if total != booking.Credits {
+			t.Errorf("%s: %d of %d credits settled", tt.name, total, booking.Credits)
+		}
+	}
+}
+
+func TestCancellationEntriesFromIssuance(t *testing.T) {
+	// Bookings paid before the ledger are settled from issuance
+	booking := testBooking(BookingPending, time.Now())
+	for _, e := range cancellationEntries(booking, ledger.Issuance, 4) {
+		if e.Debit != ledger.Issuance {
+			t.Errorf("entry debits %s, want issuance", e.Debit)
+		}
+	}
+}
+
+func TestBookingKeys(t *testing.T) {
+	booking := testBooking(BookingPending, time.Now())
+	other := testBooking(BookingPending, time.Now())
+	seen := map[string]bool{}
+	for _, key := range []string{
+		bookingKey(booking.ID, "payment"),
+		bookingKey(booking.ID, "release"),
+		bookingKey(booking.ID, "refund"),
+		bookingKey(booking.ID, "cancellation_fee"),
+		bookingKey(booking.ID, "forfeit"),
+		bookingKey(other.ID, "payment"),
+	} {
+		if seen[key] {
+			t.Errorf("key %s is used by two postings", key)
+		}
+		seen[key] = true
+	}
+	refund := cancellationEntries(booking, ledger.Escrow(booking.ID), 5)
+	if refund[0].Key != bookingKey(booking.ID, "refund") || refund[1].Key != bookingKey(booking.ID, "cancellation_fee") {
+		t.Errorf("settlement keys %q and %q", refund[0].Key, refund[1].Key)
+	}
+}
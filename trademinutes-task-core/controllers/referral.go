@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"trademinutes-task-core/ledger"
+
+	"github.com/ElioCloud/shared-models/models"
+	"github.com/ElioCloud/trademinutes-common/env"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var referralCollection *mongo.Collection
+
+// SetReferralCollection injects the referrals collection written by the auth service
+func SetReferralCollection(c *mongo.Collection) {
+	referralCollection = c
+}
+
+// referralBonus is the number of credits given to each side of a referral.
+func referralBonus() int {
+	if n := env.Int("REFERRAL_BONUS_CREDITS", 1); n >= 0 {
+		return n
+	}
+	return 1
+}
+
+// rewardReferrals pays the referral bonus for either party of a completed booking who
+// was invited by someone else and has not been rewarded yet. A booking between the
+// referrer and the referee does not count, so the bonus cannot be farmed between them.
+// It runs in the completion's transaction, so a referral is only marked rewarded
+// together with both bonus postings and the notifications about them.
+func rewardReferrals(ctx context.Context, booking models.Booking) error {
+	if referralCollection == nil {
+		return nil
+	}
+	bonus := referralBonus()
+	if bonus == 0 {
+		return nil
+	}
+
+	for _, refereeID := range []primitive.ObjectID{booking.BookerID, booking.TaskOwnerID} {
+		var referral struct {
+			ID         primitive.ObjectID `bson:"_id"`
+			ReferrerID primitive.ObjectID `bson:"referrerId"`
+			RefereeID  primitive.ObjectID `bson:"refereeId"`
+		}
+		// Claiming the pending referral makes the reward happen at most once
+		err := referralCollection.FindOneAndUpdate(ctx,
+			bson.M{
+				"refereeId":  refereeID,
+				"status":     "pending",
+				"referrerId": bson.M{"$nin": []primitive.ObjectID{booking.BookerID, booking.TaskOwnerID}},
+			},
+			bson.M{"$set": bson.M{"status": "rewarded", "rewardedAt": time.Now().Unix(), "bookingId": booking.ID, "bonus": bonus}},
+		).Decode(&referral)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, userID := range []primitive.ObjectID{referral.ReferrerID, referral.RefereeID} {
+			err := postOnce(ctx, ledger.Entry{
+				Debit:     ledger.Issuance,
+				Credit:    ledger.UserAccount(userID),
+				Amount:    bonus,
+				Reason:    ledger.ReasonReferralBonus,
+				Key:       "referral:" + referral.ID.Hex() + ":" + userID.Hex(),
+				BookingID: &booking.ID,
+			})
+			if err != nil {
+				return err
+			}
+			message := "Your friend completed their first booking, so you both earned " + strconv.Itoa(bonus) + " bonus credits."
+			if userID == referral.RefereeID {
+				message = "You completed your first booking, so you and the friend who invited you earned " + strconv.Itoa(bonus) + " bonus credits."
+			}
+			if notificationCollection != nil {
+				_, err := notificationCollection.InsertOne(ctx, models.Notification{
+					ID:        primitive.NewObjectID(),
+					UserID:    userID,
+					Type:      "referral_rewarded",
+					Title:     "Referral Bonus",
+					Message:   message,
+					Timestamp: time.Now().Unix(),
+					Read:      false,
+					TaskID:    booking.TaskID,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
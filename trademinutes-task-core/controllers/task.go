@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ElioCloud/shared-models/models"
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/ElioCloud/trademinutes-common/httpx"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -31,28 +34,47 @@ func CategoriesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // CreateTaskHandler handles creating a task
-func CreateTaskHandler(db *mongo.Database, jwtSecret string) http.HandlerFunc {
+func CreateTaskHandler(db *mongo.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Extract email from JWT
-		email, err := utils.ExtractEmailFromJWT(r, jwtSecret)
-		if err != nil {
-			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		// Email comes from the JWT validated by middleware.Auth
+		email := authn.Email(r)
+		if email == "" {
+			httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		// Get user details
 		user, err := utils.GetUserByEmail(db, email)
 		if err != nil && err != mongo.ErrNoDocuments {
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			httpx.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// Only verified accounts may publish tasks
+		unverified, err := utils.IsEmailUnverified(db.Collection("MyClusterCol"), bson.M{"email": email})
+		if err != nil {
+			httpx.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if unverified {
+			httpx.Error(w, "Please verify your email address before creating tasks", http.StatusForbidden)
 			return
 		}
 
 		// Decode task from request body
-		var task models.Task
+		var task storedTask
 		if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			httpx.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
+		for i, slot := range task.Availability {
+			if !validSlot(slot) {
+				httpx.Error(w, invalidSlotMessage, http.StatusBadRequest)
+				return
+			}
+			// Seats are counted by bookings, not set by the author
+			task.Availability[i].Booked, task.Availability[i].Taken = 0, false
+		}
 
 		// Set author information
 		task.Author = models.Author{
@@ -68,7 +90,7 @@ func CreateTaskHandler(db *mongo.Database, jwtSecret string) http.HandlerFunc {
 		// Insert into database
 		result, err := taskCollection.InsertOne(context.TODO(), task)
 		if err != nil {
-			http.Error(w, "Failed to create task", http.StatusInternalServerError)
+			httpx.Error(w, "Failed to create task", http.StatusInternalServerError)
 			return
 		}
 
@@ -83,22 +105,18 @@ func GetTaskByIdHandler(w http.ResponseWriter, r *http.Request) {
 	idHex := mux.Vars(r)["id"]
 	id, err := primitive.ObjectIDFromHex(idHex)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid ID"})
+		httpx.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
-	var task models.Task
+	var task storedTask
 	err = taskCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&task)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Task not found"})
+		httpx.Error(w, "Task not found", http.StatusNotFound)
 		return
 	}
 
-	json.NewEncoder(w).Encode(task)
+	json.NewEncoder(w).Encode(withAuthorBadges(context.Background(), []storedTask{task})[0])
 }
 
 // Get all tasks
@@ -106,20 +124,20 @@ func GetAllTasksHandler(db *mongo.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cursor, err := db.Collection("tasks").Find(context.TODO(), bson.D{})
 		if err != nil {
-			http.Error(w, "Failed to fetch tasks", http.StatusInternalServerError)
+			httpx.Error(w, "Failed to fetch tasks", http.StatusInternalServerError)
 			return
 		}
 		defer cursor.Close(context.TODO())
 
-		var tasks []models.Task
+		var tasks []storedTask
 		if err = cursor.All(context.TODO(), &tasks); err != nil {
-			http.Error(w, "Failed to decode tasks", http.StatusInternalServerError)
+			httpx.Error(w, "Failed to decode tasks", http.StatusInternalServerError)
 			return
 		}
 
 		// Filter out tasks whose all availability slots are in the past
 		now := time.Now()
-		var filtered []models.Task
+		var filtered []storedTask
 		for _, task := range tasks {
 			hasFuture := false
 			for _, slot := range task.Availability {
@@ -139,7 +157,7 @@ func GetAllTasksHandler(db *mongo.Database) http.HandlerFunc {
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(filtered)
+		json.NewEncoder(w).Encode(withAuthorBadges(context.TODO(), filtered))
 	}
 }
 
@@ -148,25 +166,57 @@ func UpdateTaskHandler(w http.ResponseWriter, r *http.Request) {
 	idHex := mux.Vars(r)["id"]
 	id, err := primitive.ObjectIDFromHex(idHex)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid ID"})
+		httpx.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeTaskWrite(w, r, id) {
 		return
 	}
 
 	var updates bson.M
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid input"})
+		httpx.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
+	// Ownership is not editable, and keys are field paths rather than update operators
+	for key := range updates {
+		if !updatableTaskField(key) {
+			httpx.Error(w, "Field "+key+" cannot be updated", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Availability is replaced as a whole and checked like a new task's
+	if raw, ok := updates["availability"]; ok {
+		var slots []taskSlot
+		encoded, _ := json.Marshal(raw)
+		if err := json.Unmarshal(encoded, &slots); err != nil {
+			httpx.Error(w, "Invalid availability", http.StatusBadRequest)
+			return
+		}
+		for _, slot := range slots {
+			if !validSlot(slot) {
+				httpx.Error(w, invalidSlotMessage, http.StatusBadRequest)
+				return
+			}
+		}
+		slots, err = replaceSlots(context.Background(), id, slots)
+		if err == errSlotBooked {
+			httpx.Error(w, "A timeslot with bookings cannot be removed or given fewer seats than are booked", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			httpx.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		updates["availability"] = slots
+	}
+
 	_, err = taskCollection.UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": updates})
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Update failed"})
+		httpx.Error(w, "Update failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -174,22 +224,37 @@ func UpdateTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"message": "Task updated"}`))
 }
 
+// updatableTaskField reports whether a task update may set key. The ID and author, and
+// any path into them, are fixed, and operators or positional paths are refused. Slots
+// are only replaced as a whole, so their seat counts cannot be written one by one.
+func updatableTaskField(key string) bool {
+	if key == "" || strings.ContainsAny(key, "$") {
+		return false
+	}
+	for _, fixed := range []string{"_id", "id", "author"} {
+		if key == fixed || strings.HasPrefix(key, fixed+".") {
+			return false
+		}
+	}
+	return !strings.HasPrefix(key, "availability.")
+}
+
 // DeleteTaskHandler deletes a task
 func DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 	idHex := mux.Vars(r)["id"]
 	id, err := primitive.ObjectIDFromHex(idHex)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid ID"})
+		httpx.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeTaskWrite(w, r, id) {
 		return
 	}
 
 	_, err = taskCollection.DeleteOne(context.Background(), bson.M{"_id": id})
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Delete failed"})
+		httpx.Error(w, "Delete failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -197,31 +262,48 @@ func DeleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"message": "Task deleted"}`))
 }
 
+// authorizeTaskWrite lets authors modify their own tasks and moderators any task.
+// It writes the error response and returns false when the caller may not proceed.
+func authorizeTaskWrite(w http.ResponseWriter, r *http.Request, id primitive.ObjectID) bool {
+	var task models.Task
+	if err := taskCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&task); err != nil {
+		httpx.Error(w, "Task not found", http.StatusNotFound)
+		return false
+	}
+
+	email := authn.Email(r)
+	if task.Author.Email != email && !authn.HasRole(r, authn.RoleModerator) {
+		httpx.Error(w, "You can only modify your own tasks", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 // GetUserTasksHandler retrieves tasks for the logged-in user
-func GetUserTasksHandler(db *mongo.Database, jwtSecret string) http.HandlerFunc {
+func GetUserTasksHandler(db *mongo.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Extract email from JWT
-		email, err := utils.ExtractEmailFromJWT(r, jwtSecret)
-		if err != nil {
-			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		// Email comes from the JWT validated by middleware.Auth
+		email := authn.Email(r)
+		if email == "" {
+			httpx.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		// Find tasks where the author email matches the logged-in user's email
 		cursor, err := taskCollection.Find(context.TODO(), bson.M{"author.email": email})
 		if err != nil {
-			http.Error(w, "Failed to fetch user tasks", http.StatusInternalServerError)
+			httpx.Error(w, "Failed to fetch user tasks", http.StatusInternalServerError)
 			return
 		}
 		defer cursor.Close(context.TODO())
 
-		var tasks []models.Task
+		var tasks []storedTask
 		if err = cursor.All(context.TODO(), &tasks); err != nil {
-			http.Error(w, "Failed to decode user tasks", http.StatusInternalServerError)
+			httpx.Error(w, "Failed to decode user tasks", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(tasks)
+		json.NewEncoder(w).Encode(withAuthorBadges(context.TODO(), tasks))
 	}
 }
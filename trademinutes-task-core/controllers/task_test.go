@@ -0,0 +1,32 @@
+package controllers
+
+import "testing"
+
+func TestUpdatableTaskField(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"title", true},
+		{"description", true},
+		{"credits", true},
+		{"availability", true},
+		{"location.city", true},
+		{"authorNote", true},
+		{"", false},
+		{"_id", false},
+		{"id", false},
+		{"author", false},
+		{"author.id", false},
+		{"author.email", false},
+		{"$set", false},
+		{"availability.0.booked", false},
+		{"availability.$.taken", false},
+		{"availability.0.capacity", false},
+	}
+	for _, tt := range tests {
+		if got := updatableTaskField(tt.key); got != tt.want {
+			t.Errorf("updatableTaskField(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ElioCloud/shared-models/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// taskSlot is an availability slot as stored by task-core, with the booking capacity the
+// shared model does not carry. Booked and Taken are kept up to date by bookings.
+type taskSlot struct {
+	models.AvailabilitySlot `bson:",inline"`
+	// Capacity is how many bookers the slot takes, for group sessions. Zero means one.
+	Capacity int  `json:"capacity,omitempty" bson:"capacity,omitempty"`
+	Booked   int  `json:"booked" bson:"booked,omitempty"`
+	Taken    bool `json:"taken" bson:"taken,omitempty"`
+}
+
+// storedTask is a task document with its slots as task-core stores them.
+type storedTask struct {
+	models.Task  `bson:",inline"`
+	Availability []taskSlot `json:"availability" bson:"availability"`
+}
+
+// seats returns how many bookers a slot takes.
+func (s taskSlot) seats() int {
+	if s.Capacity < 1 {
+		return 1
+	}
+	return s.Capacity
+}
+
+// activeStatuses are the statuses of bookings that still hold their timeslot and keep
+// their participants busy during it.
+var activeStatuses = []string{BookingPending, BookingConfirmed, BookingInProgress}
+
+// seatStatuses are the statuses of bookings that use up a seat of their timeslot.
+// Completed bookings and no-shows keep theirs, so a slot that was used is not offered again.
+var seatStatuses = []string{BookingPending, BookingConfirmed, BookingInProgress, BookingCompleted, BookingNoShow}
+
+var (
+	errSlotFull     = errors.New("timeslot is fully booked")
+	errBookerBusy   = errors.New("booker has an overlapping booking")
+	errProviderBusy = errors.New("provider has an overlapping booking")
+	errSlotBooked   = errors.New("timeslot has bookings")
+)
+
+// slotTimes returns when a slot starts and ends. Timeslots carry no time zone, so they are
+// read in the server's.
+func slotTimes(slot models.AvailabilitySlot) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02 15:04", slot.Date+" "+slot.TimeFrom, time.Local)
+	if err != nil {
+		return start, start, err
+	}
+	end, err := time.ParseInLocation("2006-01-02 15:04", slot.Date+" "+slot.TimeTo, time.Local)
+	return start, end, err
+}
+
+// invalidSlotMessage answers a task whose availability fails validSlot.
+const invalidSlotMessage = "Each availability slot needs a date, a start before its end and a non-negative capacity"
+
+// validSlot reports whether a slot has a date and times, ends after it starts and has a
+// capacity that is not negative. A capacity of zero is left out in JSON and means one.
+func validSlot(slot taskSlot) bool {
+	start, end, err := slotTimes(slot.AvailabilitySlot)
+	return err == nil && end.After(start) && slot.Capacity >= 0
+}
+
+// overlaps reports whether two slots share any time. Slots that merely touch do not.
+func overlaps(a, b models.AvailabilitySlot) bool {
+	aStart, aEnd, err := slotTimes(a)
+	if err != nil {
+		return false
+	}
+	bStart, bEnd, err := slotTimes(b)
+	if err != nil {
+		return false
+	}
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
+
+// findSlot returns the task's slot matching a requested timeslot.
+func findSlot(task storedTask, timeslot models.AvailabilitySlot) (taskSlot, bool) {
+	for _, slot := range task.Availability {
+		if slot.AvailabilitySlot == timeslot {
+			return slot, true
+		}
+	}
+	return taskSlot{}, false
+}
+
+// slotBookings is the filter for the bookings of one timeslot of a task.
+func slotBookings(taskID primitive.ObjectID, timeslot models.AvailabilitySlot, statuses []string) bson.M {
+	return bson.M{
+		"taskId":            taskID,
+		"timeslot.date":     timeslot.Date,
+		"timeslot.timeFrom": timeslot.TimeFrom,
+		"timeslot.timeTo":   timeslot.TimeTo,
+		"status":            bson.M{"$in": statuses},
+	}
+}
+
+// busyDuring reports whether a user, as booker or provider, has an active booking that
+// overlaps the booking's timeslot. The provider's other bookings of the same group
+// session do not count.
+func busyDuring(ctx context.Context, userID primitive.ObjectID, booking models.Booking) (bool, error) {
+	cursor, err := bookingCollection.Find(ctx, bson.M{
+		"$or":           []bson.M{{"bookerId": userID}, {"taskOwnerId": userID}},
+		"timeslot.date": booking.Timeslot.Date,
+		"status":        bson.M{"$in": activeStatuses},
+	})
+	if err != nil {
+		return false, err
+	}
+	var others []models.Booking
+	if err := cursor.All(ctx, &others); err != nil {
+		return false, err
+	}
+	for _, other := range others {
+		sameSession := other.TaskID == booking.TaskID && other.Timeslot == booking.Timeslot && other.TaskOwnerID == userID
+		if !sameSession && overlaps(other.Timeslot, booking.Timeslot) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// reserveSlot checks that a new booking's timeslot has a free seat and that neither
+// participant is busy during it. It must run in the booking's transaction, before the
+// booking is inserted. It writes to the task owner, so concurrent bookings of the same
+// provider conflict and are retried one after the other; the booker is written to when
+// their credits are held.
+func reserveSlot(ctx context.Context, booking models.Booking, slot taskSlot) error {
+	_, err := userCollection.UpdateOne(ctx, bson.M{"_id": booking.TaskOwnerID}, bson.M{"$set": bson.M{"lastBookedAt": booking.BookedAt}})
+	if err != nil {
+		return err
+	}
+
+	taken, err := bookingCollection.CountDocuments(ctx, slotBookings(booking.TaskID, booking.Timeslot, seatStatuses))
+	if err != nil {
+		return err
+	}
+	if int(taken) >= slot.seats() {
+		return errSlotFull
+	}
+	if busy, err := busyDuring(ctx, booking.BookerID, booking); err != nil {
+		return err
+	} else if busy {
+		return errBookerBusy
+	}
+	if busy, err := busyDuring(ctx, booking.TaskOwnerID, booking); err != nil {
+		return err
+	} else if busy {
+		return errProviderBusy
+	}
+	return nil
+}
+
+// markSlot records on the task how many seats of a booking's timeslot are taken, and
+// whether it is full. Call it after a booking takes or frees a seat.
+func markSlot(ctx context.Context, booking models.Booking) error {
+	var task storedTask
+	err := taskCollection.FindOne(ctx, bson.M{"_id": booking.TaskID}).Decode(&task)
+	if err == mongo.ErrNoDocuments {
+		// The task has been deleted since
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slot, ok := findSlot(task, booking.Timeslot)
+	if !ok {
+		return nil
+	}
+	taken, err := bookingCollection.CountDocuments(ctx, slotBookings(booking.TaskID, booking.Timeslot, seatStatuses))
+	if err != nil {
+		return err
+	}
+	_, err = taskCollection.UpdateOne(ctx,
+		bson.M{"_id": booking.TaskID},
+		bson.M{"$set": bson.M{
+			"availability.$[slot].booked": taken,
+			"availability.$[slot].taken":  int(taken) >= slot.seats(),
+		}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{
+			"slot.date":     booking.Timeslot.Date,
+			"slot.timeFrom": booking.Timeslot.TimeFrom,
+			"slot.timeTo":   booking.Timeslot.TimeTo,
+		}}}),
+	)
+	return err
+}
+
+// replaceSlots prepares a task's new availability. The seats of each slot are counted
+// from its bookings rather than taken from the author, and a slot with active bookings
+// may not be dropped or given fewer seats than are taken.
+func replaceSlots(ctx context.Context, taskID primitive.ObjectID, slots []taskSlot) ([]taskSlot, error) {
+	var task storedTask
+	if err := taskCollection.FindOne(ctx, bson.M{"_id": taskID}).Decode(&task); err != nil {
+		return nil, err
+	}
+	for _, old := range task.Availability {
+		kept := false
+		for _, slot := range slots {
+			kept = kept || slot.AvailabilitySlot == old.AvailabilitySlot
+		}
+		if kept {
+			continue
+		}
+		active, err := bookingCollection.CountDocuments(ctx, slotBookings(taskID, old.AvailabilitySlot, activeStatuses))
+		if err != nil {
+			return nil, err
+		}
+		if active > 0 {
+			return nil, errSlotBooked
+		}
+	}
+	for i, slot := range slots {
+		taken, err := bookingCollection.CountDocuments(ctx, slotBookings(taskID, slot.AvailabilitySlot, seatStatuses))
+		if err != nil {
+			return nil, err
+		}
+		if int(taken) > slot.seats() {
+			return nil, errSlotBooked
+		}
+		slots[i].Booked, slots[i].Taken = int(taken), int(taken) >= slot.seats()
+	}
+	return slots, nil
+}
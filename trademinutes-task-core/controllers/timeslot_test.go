@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/ElioCloud/shared-models/models"
+)
+
+func TestValidSlot(t *testing.T) {
+	slot := func(date, from, to string, capacity int) taskSlot {
+		return taskSlot{AvailabilitySlot: models.AvailabilitySlot{Date: date, TimeFrom: from, TimeTo: to}, Capacity: capacity}
+	}
+	tests := []struct {
+		name string
+		slot taskSlot
+		want bool
+	}{
+		{"one booker", slot("2026-03-10", "09:00", "10:00", 1), true},
+		{"group session", slot("2026-03-10", "09:00", "10:00", 8), true},
+		{"capacity left out", slot("2026-03-10", "09:00", "10:00", 0), true},
+		{"negative capacity", slot("2026-03-10", "09:00", "10:00", -1), false},
+		{"ends before it starts", slot("2026-03-10", "10:00", "09:00", 1), false},
+		{"ends as it starts", slot("2026-03-10", "10:00", "10:00", 1), false},
+		{"no date", slot("", "09:00", "10:00", 1), false},
+		{"bad time", slot("2026-03-10", "9am", "10:00", 1), false},
+	}
+	for _, tt := range tests {
+		if got := validSlot(tt.slot); got != tt.want {
+			t.Errorf("%s: validSlot = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// A slot left at capacity zero takes one booker
+	if got := slot("2026-03-10", "09:00", "10:00", 0).seats(); got != 1 {
+		t.Errorf("capacity zero takes %d bookers, want 1", got)
+	}
+}
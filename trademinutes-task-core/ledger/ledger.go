@@ -0,0 +1,360 @@
+// Package ledger records every movement of time credits as an immutable journal entry.
+//
+// Each entry moves an amount from a debit account to a credit account: the debit account
+// loses the credits and the credit account receives them. A user's account is their
+// wallet, a booking's escrow account holds its payment until the booking is settled, and
+// the issuance account is where granted credits come from.
+// The balance kept in the user document's credits field is a running total of the
+// entries, so it can always be reconciled against the journal.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Account identifies one side of an entry.
+type Account string
+
+// Issuance is where granted credits come from: starting credits, referral bonuses
+// and the opening balances of wallets that existed before the ledger.
+const Issuance Account = "system:issuance"
+
+const (
+	userAccountPrefix   = "user:"
+	escrowAccountPrefix = "escrow:"
+)
+
+// UserAccount is the wallet of a user.
+func UserAccount(id primitive.ObjectID) Account {
+	return Account(userAccountPrefix + id.Hex())
+}
+
+// Escrow holds the payment for a booking until it is completed, cancelled or rejected.
+func Escrow(bookingID primitive.ObjectID) Account {
+	return Account(escrowAccountPrefix + bookingID.Hex())
+}
+
+// UserID returns the user whose wallet the account is.
+func (a Account) UserID() (primitive.ObjectID, bool) {
+	if !strings.HasPrefix(string(a), userAccountPrefix) {
+		return primitive.NilObjectID, false
+	}
+	id, err := primitive.ObjectIDFromHex(strings.TrimPrefix(string(a), userAccountPrefix))
+	return id, err == nil
+}
+
+// Reasons recorded on entries.
+const (
+	ReasonOpeningBalance  = "opening_balance"
+	ReasonStartingCredits = "starting_credits"
+	ReasonReferralBonus   = "referral_bonus"
+	ReasonBookingPayment  = "booking_payment"
+	ReasonBookingRelease  = "booking_release"
+	ReasonBookingRefund   = "booking_refund"
+	ReasonCancellationFee = "cancellation_fee"
+	ReasonBookingForfeit  = "booking_forfeit"
+)
+
+var (
+	ErrInsufficientCredits = errors.New("not enough credits")
+	ErrNoAccount           = errors.New("account not found")
+	// ErrAlreadyPosted is returned, with the earlier entry, when an entry with the same
+	// key was posted before.
+	ErrAlreadyPosted = errors.New("entry already posted")
+)
+
+// Entry is a journal entry. Entries are never changed or deleted; a mistake is
+// corrected by posting the opposite entry.
+type Entry struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	Debit  Account            `json:"debit" bson:"debit"`
+	Credit Account            `json:"credit" bson:"credit"`
+	Amount int                `json:"amount" bson:"amount"`
+	Reason string             `json:"reason" bson:"reason"`
+	// Key makes posting idempotent: a second entry with the same key is refused.
+	Key       string              `json:"-" bson:"key,omitempty"`
+	BookingID *primitive.ObjectID `json:"bookingId,omitempty" bson:"bookingId,omitempty"`
+	TaskID    *primitive.ObjectID `json:"taskId,omitempty" bson:"taskId,omitempty"`
+	CreatedAt int64               `json:"createdAt" bson:"createdAt"`
+}
+
+var entryCollection *mongo.Collection
+var userCollection *mongo.Collection
+
+// Init sets the journal and users collections and creates the journal's indexes.
+func Init(ctx context.Context, entries, users *mongo.Collection) error {
+	entryCollection = entries
+	userCollection = users
+	_, err := entries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"key": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "debit", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "credit", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	return err
+}
+
+// Transact runs fn in a MongoDB transaction, so that every entry it posts, together with
+// any other write made with the ctx it is given, is applied or discarded as a whole.
+// Transactions need a replica set, which MongoDB Atlas always is.
+func Transact(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := entryCollection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// Lookup returns the entry posted with the key.
+func Lookup(ctx context.Context, key string) (Entry, error) {
+	var e Entry
+	err := entryCollection.FindOne(ctx, bson.M{"key": key}).Decode(&e)
+	return e, err
+}
+
+// Post moves e.Amount credits from e.Debit to e.Credit and records the entry. A user
+// wallet being debited must hold enough credits, otherwise ErrInsufficientCredits is
+// returned and nothing is recorded.
+//
+// Within Transact the whole posting is atomic. Otherwise the journal entry is written
+// after the debit and before the credit; if crediting the receiving wallet fails, the
+// entry stands and the wallet is left for Reconcile to fix.
+func Post(ctx context.Context, e Entry) (Entry, error) {
+	if e.Amount <= 0 {
+		return e, fmt.Errorf("ledger: invalid amount %d", e.Amount)
+	}
+	if e.Debit == e.Credit {
+		return e, fmt.Errorf("ledger: debit and credit are both %s", e.Debit)
+	}
+	inTransaction := mongo.SessionFromContext(ctx) != nil
+	if e.Key != "" {
+		earlier, err := Lookup(ctx, e.Key)
+		if err == nil {
+			return earlier, ErrAlreadyPosted
+		}
+		if err != mongo.ErrNoDocuments {
+			return e, err
+		}
+	}
+
+	debitUser, debitIsUser := e.Debit.UserID()
+	creditUser, creditIsUser := e.Credit.UserID()
+	for _, side := range []struct {
+		id     primitive.ObjectID
+		isUser bool
+	}{{debitUser, debitIsUser}, {creditUser, creditIsUser}} {
+		if side.isUser {
+			if err := open(ctx, side.id); err != nil {
+				return e, err
+			}
+		}
+	}
+
+	if debitIsUser {
+		res, err := userCollection.UpdateOne(ctx,
+			bson.M{"_id": debitUser, "credits": bson.M{"$gte": e.Amount}},
+			bson.M{"$inc": bson.M{"credits": -e.Amount}},
+		)
+		if err != nil {
+			return e, err
+		}
+		if res.MatchedCount == 0 {
+			return e, ErrInsufficientCredits
+		}
+	}
+
+	e.ID = primitive.NewObjectID()
+	e.CreatedAt = time.Now().Unix()
+	if _, err := entryCollection.InsertOne(ctx, e); err != nil {
+		// An aborted transaction takes the debit back with it
+		if inTransaction {
+			return e, err
+		}
+		if debitIsUser {
+			undo(debitUser, e.Amount)
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			if earlier, err := Lookup(ctx, e.Key); err == nil {
+				return earlier, ErrAlreadyPosted
+			}
+			return e, ErrAlreadyPosted
+		}
+		return e, err
+	}
+
+	if creditIsUser {
+		if _, err := userCollection.UpdateOne(ctx, bson.M{"_id": creditUser}, bson.M{"$inc": bson.M{"credits": e.Amount}}); err != nil {
+			if inTransaction {
+				return e, err
+			}
+			log.Printf("Ledger entry %s posted but crediting %s failed, reconcile the wallet: %v", e.ID.Hex(), creditUser.Hex(), err)
+		}
+	}
+	return e, nil
+}
+
+// undo gives back credits taken from a wallet for an entry that was not recorded.
+func undo(userID primitive.ObjectID, amount int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := userCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$inc": bson.M{"credits": amount}}); err != nil {
+		log.Printf("Failed to give back %d credits to %s, reconcile the wallet: %v", amount, userID.Hex(), err)
+	}
+}
+
+// open brings a wallet into the ledger the first time it is used. Wallets created
+// before the ledger carry a balance with no history, so their balance at that moment is
+// recorded as an opening balance. Marking the wallet and reading its balance is one
+// atomic update, so no later change can end up counted twice.
+func open(ctx context.Context, userID primitive.ObjectID) error {
+	var wallet struct {
+		Credits int `bson:"credits"`
+	}
+	err := userCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID, "ledgerOpenedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"ledgerOpenedAt": time.Now().Unix()}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"credits": 1}),
+	).Decode(&wallet)
+	if err == mongo.ErrNoDocuments {
+		count, err := userCollection.CountDocuments(ctx, bson.M{"_id": userID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNoAccount
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if wallet.Credits == 0 {
+		return nil
+	}
+
+	opening := Entry{
+		ID:        primitive.NewObjectID(),
+		Debit:     Issuance,
+		Credit:    UserAccount(userID),
+		Amount:    wallet.Credits,
+		Reason:    ReasonOpeningBalance,
+		Key:       "opening:" + userID.Hex(),
+		CreatedAt: time.Now().Unix(),
+	}
+	if opening.Amount < 0 {
+		opening.Debit, opening.Credit, opening.Amount = opening.Credit, opening.Debit, -opening.Amount
+	}
+	if _, err := entryCollection.InsertOne(ctx, opening); err != nil && !mongo.IsDuplicateKeyError(err) {
+		// Let the next use try again. An aborted transaction undoes the marking by itself.
+		if mongo.SessionFromContext(ctx) == nil {
+			if _, uerr := userCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$unset": bson.M{"ledgerOpenedAt": ""}}); uerr != nil {
+				log.Printf("Failed to reopen wallet %s: %v", userID.Hex(), uerr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Balance sums the entries of an account.
+func Balance(ctx context.Context, account Account) (int, error) {
+	cursor, err := entryCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": []bson.M{{"debit": account}, {"credit": account}}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": nil,
+			"balance": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$credit", account}}, "$amount", bson.M{"$multiply": bson.A{"$amount", -1}},
+			}}},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var result []struct {
+		Balance int `bson:"balance"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Balance, nil
+}
+
+// History returns the entries of an account, newest first. When before is set, only
+// entries older than it are returned, for paging.
+func History(ctx context.Context, account Account, before primitive.ObjectID, limit int64) ([]Entry, error) {
+	filter := bson.M{"$or": []bson.M{{"debit": account}, {"credit": account}}}
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+	cursor, err := entryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	err = cursor.All(ctx, &entries)
+	return entries, err
+}
+
+// Reconciliation compares a wallet's stored balance with the balance of its entries.
+type Reconciliation struct {
+	UserID primitive.ObjectID `json:"userId"`
+	Stored int                `json:"stored"`
+	Ledger int                `json:"ledger"`
+	Drift  int                `json:"drift"`
+}
+
+// Reconcile compares the credits stored on the user with their ledger balance. With fix
+// set, a drifted wallet is reset to the ledger balance, which is authoritative.
+func Reconcile(ctx context.Context, userID primitive.ObjectID, fix bool) (Reconciliation, error) {
+	rec := Reconciliation{UserID: userID}
+	if err := open(ctx, userID); err != nil {
+		return rec, err
+	}
+	var wallet struct {
+		Credits int `bson:"credits"`
+	}
+	if err := userCollection.FindOne(ctx, bson.M{"_id": userID}, options.FindOne().SetProjection(bson.M{"credits": 1})).Decode(&wallet); err != nil {
+		return rec, err
+	}
+	balance, err := Balance(ctx, UserAccount(userID))
+	if err != nil {
+		return rec, err
+	}
+	rec.Stored, rec.Ledger, rec.Drift = wallet.Credits, balance, wallet.Credits-balance
+
+	if fix && rec.Drift != 0 {
+		// Conditional on the balance read above, so a concurrent posting is not lost
+		res, err := userCollection.UpdateOne(ctx,
+			bson.M{"_id": userID, "credits": wallet.Credits},
+			bson.M{"$inc": bson.M{"credits": -rec.Drift}},
+		)
+		if err != nil {
+			return rec, err
+		}
+		if res.ModifiedCount == 1 {
+			log.Printf("Reconciled wallet %s from %d to %d credits", userID.Hex(), rec.Stored, rec.Ledger)
+			rec.Stored, rec.Drift = rec.Ledger, 0
+		}
+	}
+	return rec, nil
+}
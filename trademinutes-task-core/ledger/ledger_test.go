@@ -0,0 +1,51 @@
+package ledger
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAccounts(t *testing.T) {
+	userID := primitive.NewObjectID()
+	bookingID := primitive.NewObjectID()
+
+	tests := []struct {
+		account Account
+		want    primitive.ObjectID
+		isUser  bool
+	}{
+		{UserAccount(userID), userID, true},
+		{Escrow(bookingID), primitive.NilObjectID, false},
+		{Issuance, primitive.NilObjectID, false},
+		{Account("user:not-an-id"), primitive.NilObjectID, false},
+	}
+	for _, tt := range tests {
+		id, ok := tt.account.UserID()
+		if ok != tt.isUser || (ok && id != tt.want) {
+			t.Errorf("%s.UserID() = %s, %v, want %s, %v", tt.account, id.Hex(), ok, tt.want.Hex(), tt.isUser)
+		}
+	}
+	if Escrow(bookingID) == Escrow(primitive.NewObjectID()) {
+		t.Error("two bookings share an escrow account")
+	}
+}
+
+// Invalid entries are refused before anything is read or written, so no database is needed.
+func TestPostRefusesInvalidEntries(t *testing.T) {
+	user := UserAccount(primitive.NewObjectID())
+	tests := []struct {
+		name  string
+		entry Entry
+	}{
+		{"zero amount", Entry{Debit: user, Credit: Issuance, Amount: 0, Reason: ReasonBookingPayment}},
+		{"negative amount", Entry{Debit: Issuance, Credit: user, Amount: -5, Reason: ReasonStartingCredits}},
+		{"same account", Entry{Debit: user, Credit: user, Amount: 5, Reason: ReasonBookingRefund}},
+	}
+	for _, tt := range tests {
+		if _, err := Post(context.Background(), tt.entry); err == nil {
+			t.Errorf("%s: posted", tt.name)
+		}
+	}
+}
@@ -1,50 +1,51 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"time"
 
 	"trademinutes-task-core/config"
 	"trademinutes-task-core/controllers"
+	"trademinutes-task-core/ledger"
 	"trademinutes-task-core/routes"
 
+	"github.com/ElioCloud/trademinutes-common/env"
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/ElioCloud/trademinutes-common/outbox"
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 )
 
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func main() {
 	// Load .env
-	if os.Getenv("ENV") != "production" {
-		if err := godotenv.Load(); err != nil {
-			log.Println(".env file not found, assuming production environment variables")
-		}
-	}
+	env.Load()
+	env.MustRequire("MONGO_URI", "DB_NAME")
 
 	// Connect to MongoDB
 	config.ConnectDB()
 	controllers.SetTaskCollection(config.GetDB().Collection("tasks"))                 // Set task collection
 	controllers.SetBookingCollection(config.GetDB().Collection("bookings"))           // Set booking collection
 	controllers.SetNotificationCollection(config.GetDB().Collection("notifications")) // Set notification collection
-	controllers.SetUserCollection(config.GetDB().Collection("MyClusterCol"))                 // Set user collection for creditschec
+	controllers.SetUserCollection(config.GetDB().Collection("MyClusterCol"))          // Set user collection for creditschec
+	controllers.SetOutboxCollection(config.GetDB().Collection(outbox.Collection))     // Emails are delivered by the auth service
+	controllers.SetReferralCollection(config.GetDB().Collection("referrals"))         // Referrals are recorded by the auth service
 	fmt.Println("✅ Connected to MongoDB:", config.GetDB().Name())
 
+	// Indexes for the credit ledger and for retrying bookings safely
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := ledger.Init(ctx, config.GetDB().Collection("ledger_entries"), config.GetDB().Collection("MyClusterCol")); err != nil {
+		log.Fatalf("Failed to set up the credit ledger: %v", err)
+	}
+	if err := controllers.EnsureBookingIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create booking indexes: %v", err)
+	}
+	cancel()
+
+	// Pending bookings whose timeslot has passed without an answer are expired
+	go controllers.RunBookingExpiry(10 * time.Minute)
+
 	// Create router
 	router := mux.NewRouter()
 
@@ -55,26 +56,24 @@ func main() {
 	})
 
 	// Register routes
-	// Pass all required arguments: router, db, jwtSecret
+	// Pass all required arguments: router, db
 	db := config.GetDB()
-	jwtSecret := os.Getenv("JWT_SECRET") // Make sure you have JWT_SECRET in .env or environment
-	routes.TaskCreationRoutes(router, db, jwtSecret)
-	routes.BookingRoutes(router, db, jwtSecret)
+	routes.TaskCreationRoutes(router, db)
+	routes.BookingRoutes(router, db)
+	routes.CreditRoutes(router)
+	routes.InternalRoutes(router)
 	router.HandleFunc("/api/notifications", controllers.GetNotificationsHandler).Methods("GET")
 	router.HandleFunc("/api/notifications/mark-all-read", controllers.MarkAllNotificationsReadHandler).Methods("PUT")
 
 	// Optional: log unmatched routes
 	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("404 Not Found: %s %s\n", r.Method, r.URL.Path)
-		http.Error(w, "404 not found", http.StatusNotFound)
+		httpx.Error(w, "404 not found", http.StatusNotFound)
 	})
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8084"
-	}
+	port := env.Get("PORT", "8084")
 
 	log.Println("Task service running on :", port)
-	log.Fatal(http.ListenAndServe(":"+port, CORSMiddleware(router)))
+	log.Fatal(http.ListenAndServe(":"+port, httpx.CORS(router)))
 }
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"trademinutes-task-core/config"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+)
+
+// Auth authenticates callers from their access or personal access token. The admin
+// behind an impersonation token is named as task-core in the audit trail.
+var Auth = &authn.Authenticator{
+	Service:       "task-core",
+	DB:            config.GetDB,
+	APITokens:     true,
+	SessionActive: authn.SessionActive(config.GetDB),
+}
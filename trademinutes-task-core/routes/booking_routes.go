@@ -2,16 +2,22 @@ package routes
 
 import (
 	"trademinutes-task-core/controllers"
+	"trademinutes-task-core/middleware"
 
+	"github.com/ElioCloud/trademinutes-common/authn"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func BookingRoutes(router *mux.Router, db *mongo.Database, jwtSecret string) {
+func BookingRoutes(router *mux.Router, db *mongo.Database) {
 	bookingRouter := router.PathPrefix("/api/bookings").Subrouter()
+	bookingRouter.Use(middleware.Auth.Middleware, authn.RequireScope("tasks"))
 	bookingRouter.HandleFunc("/book", controllers.CreateBookingHandler()).Methods("POST")
 	bookingRouter.HandleFunc("", controllers.GetBookingsHandler).Methods("GET")
 	bookingRouter.HandleFunc("/accept", controllers.AcceptBookingHandler()).Methods("POST")
+	bookingRouter.HandleFunc("/reject", controllers.RejectBookingHandler()).Methods("POST")
+	bookingRouter.HandleFunc("/start", controllers.StartBookingHandler()).Methods("POST")
+	bookingRouter.HandleFunc("/no-show", controllers.NoShowBookingHandler()).Methods("POST")
 	bookingRouter.HandleFunc("/cancel", controllers.CancelBookingHandler()).Methods("POST")
 	bookingRouter.HandleFunc("/complete", controllers.CompleteBookingHandler()).Methods("POST")
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"trademinutes-task-core/controllers"
+	"trademinutes-task-core/middleware"
+
+	"github.com/ElioCloud/trademinutes-common/authn"
+	"github.com/gorilla/mux"
+)
+
+// CreditRoutes registers the time-credit ledger endpoints.
+func CreditRoutes(router *mux.Router) {
+	creditRouter := router.PathPrefix("/api/credits").Subrouter()
+	creditRouter.Use(middleware.Auth.Middleware, authn.RequireScope("credits"))
+	creditRouter.HandleFunc("/history", controllers.CreditHistoryHandler).Methods("GET")
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"trademinutes-task-core/controllers"
+
+	"github.com/ElioCloud/trademinutes-common/httpx"
+	"github.com/gorilla/mux"
+)
+
+// InternalRoutes registers service-to-service endpoints used by the auth and profile
+// services.
+func InternalRoutes(router *mux.Router) {
+	internalRouter := router.PathPrefix("/internal").Subrouter()
+	internalRouter.Use(httpx.InternalOnly)
+	internalRouter.HandleFunc("/users/{id}/export", controllers.ExportUserDataHandler).Methods("GET")
+	internalRouter.HandleFunc("/users/{id}", controllers.DeleteUserDataHandler).Methods("DELETE")
+	internalRouter.HandleFunc("/users/{id}/credits/starting", controllers.GrantStartingCreditsHandler).Methods("POST")
+	internalRouter.HandleFunc("/users/{id}/credits/reconcile", controllers.ReconcileCreditsHandler).Methods("GET", "POST")
+}
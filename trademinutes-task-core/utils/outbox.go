@@ -0,0 +1,19 @@
+package utils
+
+import "os"
+
+// Email templates rendered by the auth service's outbox worker.
+const (
+	EmailBookingRequested = "booking_requested"
+	EmailBookingAccepted  = "booking_accepted"
+	EmailBookingCompleted = "booking_completed"
+)
+
+// FrontendURL returns path on the frontend, for links in emails.
+func FrontendURL(path string) string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return base + path
+}